@@ -0,0 +1,168 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// apiKeyPrefix starts every API key, so keys are told apart from access tokens
+	// and recognised when they leak
+	apiKeyPrefix = "b4u_"
+	// defaultAPIKeyDays and maxAPIKeyDays bound how long a new API key works
+	defaultAPIKeyDays = 90
+	maxAPIKeyDays     = 365
+	// apiKeyTouchInterval is how often the last use of a key is written
+	apiKeyTouchInterval = time.Minute
+	maxAPIKeyNameLength = 100
+)
+
+// newAPIKey returns a random API key and its prefix, e.g.
+// b4u_3f9a0c2e_Vb8kV6... where 3f9a0c2e is the prefix
+func newAPIKey() (key string, prefix string, err error) {
+	id := make([]byte, 4)
+	_, err = rand.Read(id)
+	if err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix = hex.EncodeToString(id)
+	return apiKeyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// InsertAPIKey mints an API key acting as the principal, limited to the requested
+// scopes. The principal must hold every scope themselves.
+func (app *application) InsertAPIKey(w http.ResponseWriter, r *http.Request) {
+	p := principalFromContext(r.Context())
+
+	var payload struct {
+		Name          string              `json:"name"`
+		Scopes        []models.Permission `json:"scopes"`
+		ExpiresInDays int                 `json:"expires_in_days"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		app.errorJSON(w, fmt.Errorf("name is required and may have at most %d characters", maxAPIKeyNameLength))
+		return
+	}
+
+	if len(payload.Scopes) == 0 {
+		app.errorJSON(w, errors.New("at least one scope is required"))
+		return
+	}
+	scopes := []models.Permission{}
+	seen := map[models.Permission]bool{}
+	for _, scope := range payload.Scopes {
+		if !models.ValidAPIKeyScope(scope) {
+			app.errorJSON(w, fmt.Errorf("%q cannot be granted to API keys", scope))
+			return
+		}
+		if !p.can(scope) {
+			app.errorJSON(w, fmt.Errorf("you cannot grant %q, your role does not have it", scope), http.StatusForbidden)
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	days := payload.ExpiresInDays
+	if days == 0 {
+		days = defaultAPIKeyDays
+	}
+	if days < 0 || days > maxAPIKeyDays {
+		app.errorJSON(w, fmt.Errorf("expires_in_days must be between 1 and %d", maxAPIKeyDays))
+		return
+	}
+
+	value, prefix, err := newAPIKey()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	key := models.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		Key:       value,
+		Username:  p.Username,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, days),
+	}
+
+	key.ID, err = app.DB.InsertAPIKey(key)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	log.Printf("API key %s (%s) minted by %s", key.Prefix, key.Name, p.Username)
+
+	// the key is only ever shown here, the database keeps its hash
+	resp := JSONResponse{
+		Error:   false,
+		Message: "API key created",
+		Data:    key,
+	}
+
+	_ = app.writeJSON(w, http.StatusCreated, resp)
+}
+
+// AllAPIKeys lists every API key with its prefix and last use, never the key itself
+func (app *application) AllAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.DB.AllAPIKeys()
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKey stops an API key from working straight away
+func (app *application) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid API key id"))
+		return
+	}
+
+	err = app.DB.RevokeAPIKey(id)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	log.Printf("API key %d revoked by %s", id, principalFromContext(r.Context()).Username)
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "API key revoked",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyRequiresOwnerMFA(t *testing.T) {
+	app := newTestApp(t)
+	app.RequireMFA = true
+	newTestUser(t, app, "admin", models.RoleAdmin)
+
+	value, prefix, err := newAPIKey()
+	if err != nil {
+		t.Fatalf("newAPIKey: %v", err)
+	}
+	now := time.Now()
+	_, err = app.DB.InsertAPIKey(models.APIKey{
+		Name:      "building management",
+		Prefix:    prefix,
+		Key:       value,
+		Username:  "admin",
+		Scopes:    []models.Permission{models.PermManageFacilities},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("InsertAPIKey: %v", err)
+	}
+
+	facilities := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/facilities", nil)
+		req.Header.Set("Authorization", "Bearer "+value)
+		rec := httptest.NewRecorder()
+		app.routes().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if status := facilities(); status != http.StatusForbidden {
+		t.Errorf("key of an admin without TOTP = %d, want %d", status, http.StatusForbidden)
+	}
+
+	if err := app.DB.BeginMFAEnrolment("admin", "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("BeginMFAEnrolment: %v", err)
+	}
+	if err := app.DB.EnableMFA("admin", 1, []string{"recovery-code"}); err != nil {
+		t.Fatalf("EnableMFA: %v", err)
+	}
+	if status := facilities(); status != http.StatusOK {
+		t.Errorf("key of an admin with TOTP = %d, want %d", status, http.StatusOK)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"booking-backend/internal/cors"
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository/dbrepo"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// the frontend origin allowed by the CORS policy of test apps, and their -domain
+const (
+	testFrontend = "https://app.example.com"
+	testDomain   = "https://bookings.example.com"
+)
+
+// newTestApp returns an application on the in-memory repository, configured like
+// main configures it
+func newTestApp(t *testing.T) *application {
+	t.Helper()
+
+	keys, err := GenerateKeySet()
+	if err != nil {
+		t.Fatalf("GenerateKeySet: %v", err)
+	}
+	policy, err := cors.New(cors.Config{
+		AllowedOrigins:   []string{testFrontend},
+		AllowedMethods:   cors.DefaultMethods,
+		AllowedHeaders:   cors.DefaultHeaders,
+		AllowCredentials: true,
+	})
+	if err != nil {
+		t.Fatalf("cors.New: %v", err)
+	}
+
+	return &application{
+		Domain:     testDomain,
+		DB:         dbrepo.NewMemoryDBRepo(),
+		BcryptCost: bcrypt.MinCost,
+		notifier:   logNotifier{},
+		cors:       policy,
+		auth: Auth{
+			Issuer:         "booking-api",
+			Audience:       "booking-frontend",
+			Keys:           keys,
+			TokenExpiry:    15 * time.Minute,
+			Leeway:         defaultLeeway,
+			RefreshExpiry:  24 * time.Hour,
+			CookiePath:     "/",
+			CookieName:     "refresh_token",
+			CSRFCookieName: "csrf_token",
+		},
+	}
+}
+
+// newTestUser registers a user with the given role
+func newTestUser(t *testing.T, app *application, username string, role models.Role) *models.User {
+	t.Helper()
+
+	code := "invite-" + username
+	_, err := app.DB.InsertInviteCode(models.InviteCode{Code: code, UnitNumber: "12A", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("InsertInviteCode: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	if _, err := app.DB.RegisterUser(username, string(hash), code); err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	if err := app.DB.UpdateUserRole(username, role); err != nil {
+		t.Fatalf("UpdateUserRole: %v", err)
+	}
+
+	user, err := app.DB.GetUserByName(username)
+	if err != nil {
+		t.Fatalf("GetUserByName: %v", err)
+	}
+	return user
+}
+
+// responseCookie returns the cookie a response sets, nil if it sets none by that name
+func responseCookie(res *http.Response, name string) *http.Cookie {
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// authRequest returns a request with an access token of a new session of user, signed
+// in with a second factor if mfa is set, and body encoded as JSON unless it is nil
+func authRequest(t *testing.T, app *application, user *models.User, mfa bool, method, path string, body interface{}) *http.Request {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	tokens, err := app.startSession(httptest.NewRecorder(), req, user, mfa)
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"booking-backend/internal/models"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
@@ -14,82 +18,160 @@ import (
 type Auth struct {
 	Issuer        string
 	Audience      string
-	Secret        string
+	Keys          *KeySet
 	TokenExpiry   time.Duration
 	RefreshExpiry time.Duration
 	CookieDomain  string
 	CookiePath    string
 	CookieName    string
+	// CSRFCookieName is the cookie holding the CSRF token requests sent with the
+	// refresh cookie have to repeat in their X-CSRF-Token header
+	CSRFCookieName string
+	// Leeway is the clock skew tolerated when verifying tokens
+	Leeway time.Duration
 }
 
 type jwtUser struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"is_admin"`
+	ID       int         `json:"id"`
+	Username string      `json:"username"`
+	Role     models.Role `json:"role"`
+	// MFA is set when the user signed in with a second factor
+	MFA bool `json:"mfa"`
+	// SessionID is the refresh token family the access token belongs to
+	SessionID string `json:"sid"`
 }
 
 type TokenPairs struct {
 	Token        string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	// CSRFToken is the value of the CSRF cookie for the X-CSRF-Token header, the
+	// frontend cannot read the cookie of the API's domain itself
+	CSRFToken string `json:"csrf_token,omitempty"`
 }
 
 type Claims struct {
 	jwt.RegisteredClaims
-	Username string `json:"username"`
+	Username string      `json:"username"`
+	Role     models.Role `json:"role"`
+	// IsAdmin is kept for the frontend, authorization only looks at Role
+	IsAdmin bool `json:"isAdmin"`
+	// Type tells access tokens apart from other tokens the API signs
+	Type string `json:"typ"`
+	// AMR lists how the user authenticated (RFC 8176), pwd and otp for a second factor
+	AMR []string `json:"amr,omitempty"`
+	// SessionID names the session (refresh token family) the token was issued for
+	SessionID string `json:"sid,omitempty"`
 }
 
-func (j *Auth) GenerateTokenPair(user *jwtUser) (TokenPairs, error) {
-	// Create a token
-	token := jwt.New(jwt.SigningMethodHS256)
+// authentication methods carried in the amr claim
+const (
+	amrPassword = "pwd"
+	amrOTP      = "otp"
+)
 
-	// Set the claims
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = user.Username
-	claims["sub"] = fmt.Sprint(user.ID)
-	claims["aud"] = j.Audience
-	claims["iss"] = j.Issuer
-	claims["iat"] = time.Now().UTC().Unix()
-	claims["typ"] = "JWT"
-	claims["isAdmin"] = user.IsAdmin
-
-	// Set the expiry for JWT
-	claims["exp"] = time.Now().UTC().Add(j.TokenExpiry).Unix()
-
-	// Create a signed token
-	signedAccessToken, err := token.SignedString([]byte(j.Secret))
+// mfaChallengeExpiry is how long a user has to enter their code after their password
+const mfaChallengeExpiry = 5 * time.Minute
+
+func (j *Auth) GenerateTokenPair(user *jwtUser) (TokenPairs, error) {
+	signedAccessToken, err := j.GenerateAccessToken(user)
 	if err != nil {
 		return TokenPairs{}, err
 	}
 
-	// Create a refresh token and set claims
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	refreshTokenClaims := refreshToken.Claims.(jwt.MapClaims)
-	refreshTokenClaims["username"] = user.Username
-	refreshTokenClaims["sub"] = fmt.Sprint(user.ID)
-	refreshTokenClaims["iat"] = time.Now().UTC().Unix()
-	refreshTokenClaims["isAdmin"] = user.IsAdmin
-
-	// Set the expiry for the refresh token
-	refreshTokenClaims["exp"] = time.Now().UTC().Add(j.RefreshExpiry).Unix()
-
-	// Create signed refresh token
-	signedRefreshToken, err := refreshToken.SignedString([]byte(j.Secret))
+	refreshToken, err := j.NewRefreshToken()
 	if err != nil {
 		return TokenPairs{}, err
 	}
 
-	// Create TokenPairs and populate with signed tokens
+	// Create TokenPairs and populate with the tokens
 	var tokenPairs = TokenPairs{
 		Token:        signedAccessToken,
-		RefreshToken: signedRefreshToken,
+		RefreshToken: refreshToken,
 	}
-	log.Println("Signed access token: ", tokenPairs.Token)
-	log.Println("Signed refresh token: ", tokenPairs.RefreshToken)
 
 	// Return TokenPairs
 	return tokenPairs, nil
 }
 
+// GenerateAccessToken signs a short-lived access token for the user
+func (j *Auth) GenerateAccessToken(user *jwtUser) (string, error) {
+	now := time.Now().UTC()
+
+	// Set the claims
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.Issuer,
+			Subject:   fmt.Sprint(user.ID),
+			Audience:  jwt.ClaimStrings{j.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			// Set the expiry for JWT
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.TokenExpiry)),
+		},
+		Username:  user.Username,
+		Role:      user.Role,
+		IsAdmin:   user.Role.IsAdmin(),
+		Type:      tokenTypeAccess,
+		AMR:       []string{amrPassword},
+		SessionID: user.SessionID,
+	}
+	if user.MFA {
+		claims.AMR = append(claims.AMR, amrOTP)
+	}
+
+	// Create a token signed with the active key of the key set
+	return j.Keys.Sign(claims)
+}
+
+// MFAAudience is the audience of MFA challenges. It differs from the audience of access
+// tokens, so services that verify access tokens with the published keys reject them.
+func (j *Auth) MFAAudience() string {
+	return j.Audience + "/mfa"
+}
+
+// GenerateMFAChallenge signs the token a user with two-factor authentication receives
+// after their password, to be exchanged with a code at /authenticate/mfa
+func (j *Auth) GenerateMFAChallenge(user *jwtUser) (string, error) {
+	now := time.Now().UTC()
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.Issuer,
+			Subject:   fmt.Sprint(user.ID),
+			Audience:  jwt.ClaimStrings{j.MFAAudience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeExpiry)),
+		},
+		Username: user.Username,
+		Type:     tokenTypeMFAChallenge,
+		AMR:      []string{amrPassword},
+	}
+
+	return j.Keys.Sign(claims)
+}
+
+// NewRefreshToken returns a random opaque refresh token. Refresh tokens are only
+// valid while the database holds their hash, see refresh_tokens.
+func (j *Auth) NewRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewTokenFamily returns the id shared by a refresh token and all tokens it is rotated into
+func (j *Auth) NewTokenFamily() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (j *Auth) GetRefreshCookie(refreshToken string) *http.Cookie {
 	cookie := &http.Cookie{
 		Name:     j.CookieName,
@@ -116,6 +198,46 @@ func (j *Auth) GetRefreshCookie(refreshToken string) *http.Cookie {
 	return cookie
 }
 
+// NewCSRFToken returns a random token for the double-submit CSRF cookie
+func (j *Auth) NewCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GetCSRFCookie returns the cookie holding csrfToken, it lives as long as the refresh
+// cookie it protects
+func (j *Auth) GetCSRFCookie(csrfToken string) *http.Cookie {
+	return &http.Cookie{
+		Name:     j.CSRFCookieName,
+		Path:     j.CookiePath,
+		Value:    csrfToken,
+		Expires:  time.Now().Add(j.RefreshExpiry),
+		MaxAge:   int(j.RefreshExpiry.Seconds()),
+		SameSite: http.SameSiteNoneMode,
+		Domain:   j.CookieDomain,
+		HttpOnly: true,
+		Secure:   true,
+	}
+}
+
+func (j *Auth) GetExpiredCSRFCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     j.CSRFCookieName,
+		Path:     j.CookiePath,
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		SameSite: http.SameSiteNoneMode,
+		Domain:   j.CookieDomain,
+		HttpOnly: true,
+		Secure:   true,
+	}
+}
+
 func (j *Auth) GetExpiredRefreshCookie() *http.Cookie {
 	return &http.Cookie{
 		Name:     j.CookieName,
@@ -162,37 +284,30 @@ func (j *Auth) GetAndVerifyHeaderToken(w http.ResponseWriter, r *http.Request) (
 
 	// JWT token is extracted from the Authorization header.
 	token := headerParts[1]
-	claims := &Claims{}
-
-	// parse the JWT token and fill the claims struct with the claims in the token
-	// and check correct signing method
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			log.Println("Unexpected signing mathod")
-			log.Println("Method: ", token.Header["alg"])
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(j.Secret), nil
-	})
-
-	// checks if the token is expired by examining the error returned from ParseWithClaims.
+
+	// checks the signature, expiry, issuer, audience and type of the token
+	claims, err := j.verifier().Verify(token, tokenTypeAccess)
 	if err != nil {
 		log.Println("Token error: ", err)
-		if strings.HasPrefix(err.Error(), "token is expired by") {
-			log.Println("Expired token")
-			return "", nil, errors.New("expired token")
-		}
 		return "", nil, err
 	}
 
-	// checks whether the issuer (iss) claim in the token matches the expected issuer.
-	// if the issuer is not what's expected, it returns an error.
-	if claims.Issuer != j.Issuer {
-		log.Println("Issuer: ", claims.Issuer)
-		log.Println("Expected issuer: ", j.Issuer)
-		return "", nil, errors.New("invalid issuer")
+	return token, claims, nil
+}
+
+// verifier returns the verifier for the access tokens signed by j
+func (j *Auth) verifier() *TokenVerifier {
+	return &TokenVerifier{
+		Keys:     j.Keys,
+		Issuer:   j.Issuer,
+		Audience: j.Audience,
+		Leeway:   j.Leeway,
 	}
+}
 
-	return token, claims, nil
+// mfaVerifier returns the verifier for the MFA challenges signed by j
+func (j *Auth) mfaVerifier() *TokenVerifier {
+	v := j.verifier()
+	v.Audience = j.MFAAudience()
+	return v
 }
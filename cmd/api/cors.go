@@ -0,0 +1,73 @@
+package main
+
+import (
+	"booking-backend/internal/cors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCORSOrigins are the deployed frontends and the React dev server
+var defaultCORSOrigins = []string{
+	"https://syal-2ae9b.firebaseapp.com",
+	"https://syal-2ae9b.web.app",
+	"http://localhost:3000",
+}
+
+// splitList splits a comma separated flag or environment variable
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// newCORSPolicy builds the CORS policy from the -cors-* flags. The CORS_* environment
+// variables take precedence, so deployments can change the policy without a new
+// Procfile.
+func (app *application) newCORSPolicy() (*cors.Policy, error) {
+	if origins, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		app.CORSOrigins = origins
+	}
+	if methods, ok := os.LookupEnv("CORS_ALLOWED_METHODS"); ok {
+		app.CORSMethods = methods
+	}
+	if headers, ok := os.LookupEnv("CORS_ALLOWED_HEADERS"); ok {
+		app.CORSHeaders = headers
+	}
+	if maxAge, ok := os.LookupEnv("CORS_MAX_AGE"); ok {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil {
+			return nil, fmt.Errorf("CORS_MAX_AGE: %w", err)
+		}
+		app.CORSMaxAge = d
+	}
+	if credentials, ok := os.LookupEnv("CORS_ALLOW_CREDENTIALS"); ok {
+		allow, err := strconv.ParseBool(credentials)
+		if err != nil {
+			return nil, fmt.Errorf("CORS_ALLOW_CREDENTIALS: %w", err)
+		}
+		app.CORSCredentials = allow
+	}
+
+	policy, err := cors.New(cors.Config{
+		AllowedOrigins:   splitList(app.CORSOrigins),
+		AllowedMethods:   splitList(app.CORSMethods),
+		AllowedHeaders:   splitList(app.CORSHeaders),
+		MaxAge:           app.CORSMaxAge,
+		AllowCredentials: app.CORSCredentials,
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Print("CORS origins: ", app.CORSOrigins)
+
+	return policy, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The refresh cookie is sent with cross-site requests (SameSite=None, the frontend and
+// the API have different domains), so the endpoints it authenticates check that the
+// request comes from a trusted frontend and repeats the CSRF cookie in a header.
+
+// csrfHeader carries the double-submitted CSRF token
+const csrfHeader = "X-CSRF-Token"
+
+var (
+	errUntrustedOrigin = errors.New("cross-site request rejected")
+	errInvalidCSRF     = errors.New("missing or invalid CSRF token")
+)
+
+// csrfCookieValue returns the CSRF token in the request's cookie, empty if it has none
+func csrfCookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// requestOrigin returns the origin a browser request was made from, taken from the
+// Origin header or else the Referer. It is empty when the request has neither.
+func requestOrigin(r *http.Request) string {
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		return origin
+	}
+
+	referer, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || referer.Scheme == "" || referer.Host == "" {
+		return ""
+	}
+	return referer.Scheme + "://" + referer.Host
+}
+
+// trustedOrigin reports whether origin is one of the frontends of the API, the
+// CORS origins allowed to send cookies or the -domain
+func (app *application) trustedOrigin(origin string) bool {
+	if app.cors.AllowCredentials() && app.cors.AllowOrigin(origin) {
+		return true
+	}
+	return origin != "" && origin == strings.TrimSuffix(app.Domain, "/")
+}
+
+// csrfCheck only lets through requests from a trusted origin whose X-CSRF-Token
+// header matches their CSRF cookie. Requests without Origin and Referer are
+// rejected, every browser sends one of them with a cross-site POST.
+func (app *application) csrfCheck(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := requestOrigin(r)
+		if !app.trustedOrigin(origin) {
+			log.Printf("Rejected %s %s from origin %q", r.Method, r.URL.Path, origin)
+			app.errorJSON(w, errUntrustedOrigin, http.StatusForbidden)
+			return
+		}
+
+		cookie := csrfCookieValue(r, app.auth.CSRFCookieName)
+		header := r.Header.Get(csrfHeader)
+		if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+			app.errorJSON(w, errInvalidCSRF, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfToken returns the CSRF token for the X-CSRF-Token header, setting a new CSRF
+// cookie if there is none. The frontend asks for it after a reload or a single sign-on;
+// other sites cannot read the response, CORS only lets the frontends do that.
+func (app *application) csrfToken(w http.ResponseWriter, r *http.Request) {
+	token := csrfCookieValue(r, app.auth.CSRFCookieName)
+	if token == "" {
+		var err error
+		token, err = app.auth.NewCSRFToken()
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, app.auth.GetCSRFCookie(token))
+	}
+
+	headers := http.Header{}
+	headers.Set("Cache-Control", "no-store")
+
+	_ = app.writeJSON(w, http.StatusOK, map[string]string{"csrf_token": token}, headers)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sessionCookies signs a user in and returns their refresh and CSRF cookies
+func sessionCookies(t *testing.T, app *application, user *models.User) (refresh, csrf *http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if _, err := app.startSession(rec, httptest.NewRequest(http.MethodPost, "/authenticate", nil), user, false); err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	res := rec.Result()
+
+	refresh = responseCookie(res, app.auth.CookieName)
+	csrf = responseCookie(res, app.auth.CSRFCookieName)
+	if refresh == nil || csrf == nil {
+		t.Fatalf("startSession set cookies %v, want %s and %s", res.Cookies(), app.auth.CookieName, app.auth.CSRFCookieName)
+	}
+	return refresh, csrf
+}
+
+func TestCSRFCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		referer string
+		// header is the X-CSRF-Token sent, the CSRF cookie's value for "cookie"
+		header   string
+		noCookie bool
+		// err is the rejection, nil for accepted requests
+		err error
+	}{
+		{name: "same origin", origin: testFrontend, header: "cookie"},
+		{name: "from the domain", origin: testDomain, header: "cookie"},
+		{name: "Referer of a trusted origin", referer: testFrontend + "/bookings?week=2", header: "cookie"},
+
+		{name: "foreign Origin", origin: "https://evil.example.net", header: "cookie", err: errUntrustedOrigin},
+		{name: "foreign Origin with a trusted Referer", origin: "https://evil.example.net", referer: testFrontend + "/", header: "cookie", err: errUntrustedOrigin},
+		{name: "subdomain of the frontend", origin: "https://evil.app.example.com", header: "cookie", err: errUntrustedOrigin},
+		{name: "other scheme", origin: "http://app.example.com", header: "cookie", err: errUntrustedOrigin},
+		{name: "null Origin", origin: "null", header: "cookie", err: errUntrustedOrigin},
+		{name: "foreign Referer", referer: "https://evil.example.net/" + testFrontend, header: "cookie", err: errUntrustedOrigin},
+		{name: "no Origin or Referer", header: "cookie", err: errUntrustedOrigin},
+
+		{name: "missing X-CSRF-Token", origin: testFrontend, err: errInvalidCSRF},
+		{name: "mismatched X-CSRF-Token", origin: testFrontend, header: "not-the-cookie", err: errInvalidCSRF},
+		{name: "X-CSRF-Token without a CSRF cookie", origin: testFrontend, header: "cookie", noCookie: true, err: errInvalidCSRF},
+		{name: "missing CSRF cookie and X-CSRF-Token", origin: testFrontend, noCookie: true, err: errInvalidCSRF},
+	}
+
+	endpoints := []struct {
+		path   string
+		status int
+	}{
+		{"/refresh", http.StatusOK},
+		{"/logout", http.StatusAccepted},
+	}
+
+	for _, endpoint := range endpoints {
+		for _, tt := range tests {
+			t.Run(endpoint.path+"/"+tt.name, func(t *testing.T) {
+				app := newTestApp(t)
+				handler := app.routes()
+				refresh, csrf := sessionCookies(t, app, newTestUser(t, app, "alice", models.RoleResident))
+
+				req := httptest.NewRequest(http.MethodPost, endpoint.path, nil)
+				req.AddCookie(refresh)
+				if !tt.noCookie {
+					req.AddCookie(csrf)
+				}
+				if tt.origin != "" {
+					req.Header.Set("Origin", tt.origin)
+				}
+				if tt.referer != "" {
+					req.Header.Set("Referer", tt.referer)
+				}
+				switch tt.header {
+				case "":
+				case "cookie":
+					req.Header.Set(csrfHeader, csrf.Value)
+				default:
+					req.Header.Set(csrfHeader, tt.header)
+				}
+
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if tt.err == nil {
+					if rec.Code != endpoint.status {
+						t.Fatalf("POST %s = %d %s, want %d", endpoint.path, rec.Code, rec.Body, endpoint.status)
+					}
+					return
+				}
+
+				var payload JSONResponse
+				if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				if rec.Code != http.StatusForbidden || payload.Message != tt.err.Error() {
+					t.Errorf("POST %s = %d %q, want %d %q", endpoint.path, rec.Code, payload.Message, http.StatusForbidden, tt.err)
+				}
+				if len(rec.Result().Cookies()) != 0 {
+					t.Errorf("rejected POST %s set cookies %v", endpoint.path, rec.Result().Cookies())
+				}
+
+				// the rejected request neither used up nor revoked the refresh token
+				retry := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+				retry.AddCookie(refresh)
+				retry.AddCookie(csrf)
+				retry.Header.Set("Origin", testFrontend)
+				retry.Header.Set(csrfHeader, csrf.Value)
+				rec = httptest.NewRecorder()
+				handler.ServeHTTP(rec, retry)
+				if rec.Code != http.StatusOK {
+					t.Errorf("refresh after the rejected POST %s = %d %s, want %d", endpoint.path, rec.Code, rec.Body, http.StatusOK)
+				}
+			})
+		}
+	}
+}
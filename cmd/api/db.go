@@ -1,15 +1,42 @@
 package main
 
 import (
+	"booking-backend/internal/migrations"
+	"booking-backend/internal/repository"
+	"booking-backend/internal/repository/dbrepo"
 	"database/sql"
+	"io/fs"
+	"strings"
 
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	_ "modernc.org/sqlite"
 )
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", dsn)
+// sqliteScheme prefixes DSNs that point at a SQLite file, e.g. sqlite:///var/lib/book4u.db
+const sqliteScheme = "sqlite:"
+
+func (app *application) usesSQLite() bool {
+	return strings.HasPrefix(app.DSN, sqliteScheme)
+}
+
+// sqliteSource turns a sqlite: DSN into a modernc.org/sqlite data source with the
+// pragmas the repository relies on
+func sqliteSource(dsn string) string {
+	path := strings.TrimPrefix(strings.TrimPrefix(dsn, sqliteScheme), "//")
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	return "file:" + path + separator +
+		"_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+}
+
+func openDB(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -22,11 +49,39 @@ func openDB(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
+// connectToDB opens the database named by the DSN, SQLite for sqlite: DSNs and Postgres otherwise
 func (app *application) connectToDB() (*sql.DB, error) {
-	connection, err := openDB(app.DSN)
+	if app.usesSQLite() {
+		connection, err := openDB("sqlite", sqliteSource(app.DSN))
+		if err != nil {
+			return nil, err
+		}
+
+		// SQLite allows a single writer, one connection serialises transactions
+		connection.SetMaxOpenConns(1)
+		return connection, nil
+	}
+
+	connection, err := openDB("pgx", app.DSN)
 	if err != nil {
 		return nil, err
 	}
 
 	return connection, nil
-}
\ No newline at end of file
+}
+
+// newDBRepo wraps an open connection in the repository matching the DSN
+func (app *application) newDBRepo(conn *sql.DB) repository.DatabaseRepo {
+	if app.usesSQLite() {
+		return &dbrepo.SQLiteDBRepo{DB: conn}
+	}
+	return &dbrepo.PostgresDBRepo{DB: conn}
+}
+
+// migrationFiles returns the migrations written for the database named by the DSN
+func (app *application) migrationFiles() fs.FS {
+	if app.usesSQLite() {
+		return migrations.SQLite
+	}
+	return migrations.Postgres
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AllFacilities lists the facilities residents can currently book
+func (app *application) AllFacilities(w http.ResponseWriter, r *http.Request) {
+	facilities, err := app.DB.AllFacilities(false)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, facilities)
+}
+
+func (app *application) GetFacility(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid facility id"))
+		return
+	}
+
+	facility, err := app.DB.GetFacilityByID(id)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	// archived facilities are only visible to admins
+	if !facility.Active {
+		app.errorJSON(w, errors.New("facility not found"), http.StatusNotFound)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, facility)
+}
+
+// AdminFacilities lists every facility, including archived ones
+func (app *application) AdminFacilities(w http.ResponseWriter, r *http.Request) {
+	facilities, err := app.DB.AllFacilities(true)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, facilities)
+}
+
+func (app *application) InsertFacility(w http.ResponseWriter, r *http.Request) {
+	var facility models.Facility
+
+	err := app.readJSON(w, r, &facility)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = validateFacility(&facility)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	// new facilities are always bookable, archiving is a separate action
+	facility.Active = true
+
+	id, err := app.DB.InsertFacility(facility)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Facility created",
+		Data:    map[string]int{"id": id},
+	}
+
+	app.writeJSON(w, http.StatusCreated, resp)
+}
+
+func (app *application) UpdateFacility(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid facility id"))
+		return
+	}
+
+	var facility models.Facility
+
+	err = app.readJSON(w, r, &facility)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = validateFacility(&facility)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	facility.ID = id
+	err = app.DB.UpdateFacility(facility)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Facility updated",
+	}
+
+	app.writeJSON(w, http.StatusAccepted, resp)
+}
+
+func (app *application) ArchiveFacility(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid facility id"))
+		return
+	}
+
+	err = app.DB.ArchiveFacility(id)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Facility archived",
+	}
+
+	app.writeJSON(w, http.StatusAccepted, resp)
+}
+
+// validateFacility normalises the facility in place and checks the required fields
+func validateFacility(facility *models.Facility) error {
+	facility.Name = strings.TrimSpace(facility.Name)
+	if facility.Name == "" {
+		return errors.New("facility name is required")
+	}
+
+	if facility.Capacity < 0 {
+		return errors.New("facility capacity cannot be negative")
+	}
+
+	return facility.Rules.Validate()
+}
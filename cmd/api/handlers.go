@@ -2,12 +2,16 @@ package main
 
 import (
 	"booking-backend/internal/models"
+	"booking-backend/internal/passwords"
+	"booking-backend/internal/repository"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
-
-	"github.com/golang-jwt/jwt/v4"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // all handlers take 2 arguements
@@ -35,8 +39,17 @@ func (app *application) Home(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) BookingManagement(w http.ResponseWriter, r *http.Request) {
-	username := r.Header.Get("Username")
-	recurringbookings, approvedbookings, requestedbookings, err := app.DB.ManageBookings(username)
+	p := principalFromContext(r.Context())
+
+	// staff see everyone's bookings, unless they sent an API key without the scope
+	var recurringbookings, approvedbookings []*models.SubmittedBooking
+	var requestedbookings []*models.RequestedBooking
+	var err error
+	if p.can(models.PermViewAllBookings) {
+		recurringbookings, approvedbookings, requestedbookings, err = app.DB.AdminBookings()
+	} else {
+		recurringbookings, approvedbookings, requestedbookings, err = app.DB.UserBookings(p.Username)
+	}
 	if err != nil {
 		// handle the error properly, return some http status, log the error etc.
 		fmt.Println(err)
@@ -44,8 +57,8 @@ func (app *application) BookingManagement(w http.ResponseWriter, r *http.Request
 	}
 
 	data := map[string]interface{}{
-		"recurringbookings":  recurringbookings,
-		"approvedbookings": approvedbookings,
+		"recurringbookings": recurringbookings,
+		"approvedbookings":  approvedbookings,
 		"requestedbookings": requestedbookings,
 	}
 
@@ -64,9 +77,30 @@ func (app *application) InsertBooking(w http.ResponseWriter, r *http.Request) {
 		app.errorJSON(w, err)
 		return
 	}
+
+	// bookings are always requested for the signed in user
+	p := principalFromContext(r.Context())
+	if booking.Username != "" && booking.Username != p.Username {
+		app.errorJSON(w, errors.New("bookings can only be requested for yourself"), http.StatusForbidden)
+		return
+	}
+	booking.Username = p.Username
+
+	// and for the unit they registered with
+	user, err := app.DB.GetUserByName(p.Username)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if booking.UnitNumber != "" && booking.UnitNumber != user.UnitNumber {
+		app.errorJSON(w, errors.New("bookings can only be requested for your own unit"), http.StatusForbidden)
+		return
+	}
+	booking.UnitNumber = user.UnitNumber
+
 	err = app.DB.InsertBookingRequest(booking)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.repoErrorJSON(w, err)
 		return
 	}
 
@@ -79,28 +113,50 @@ func (app *application) InsertBooking(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) ApproveBooking(w http.ResponseWriter, r *http.Request) {
-	var booking models.RequestedBooking
-	log.Println("Booking: ", booking)
-	err := app.readJSON(w, r, &booking)
+	var payload models.RequestedBooking
+	err := app.readJSON(w, r, &payload)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	if booking.Recurring {
-		err = app.DB.ApproveRecurringBookingRequest(booking)
-	} else {
-		err = app.DB.ApproveBookingRequest(booking)
+	// only the id is taken from the body, the request is approved as it was stored
+	booking, err := app.DB.GetBookingRequest(payload.ID)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	log.Println("Booking: ", booking)
+
+	if !booking.Recurring {
+		err = app.DB.ApproveBookingRequest(*booking)
+		if err != nil {
+			app.repoErrorJSON(w, err)
+			return
+		}
+
+		resp := JSONResponse{
+			Error:   false,
+			Message: "Booking approved",
+		}
+
+		app.writeJSON(w, http.StatusAccepted, resp)
+		return
 	}
 
+	// with ?fail_on_conflict=true an overlapping occurrence fails the whole approval
+	failOnConflict, _ := strconv.ParseBool(r.URL.Query().Get("fail_on_conflict"))
+
+	report, err := app.DB.ApproveRecurringBookingRequest(*booking, failOnConflict)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.repoErrorJSON(w, err)
 		return
 	}
 
 	resp := JSONResponse{
 		Error:   false,
-		Message: "Booking requested",
+		Message: fmt.Sprintf("Booking approved, %d occurrences created and %d skipped", report.Created, report.Skipped),
+		Data:    report,
 	}
 
 	app.writeJSON(w, http.StatusAccepted, resp)
@@ -114,7 +170,16 @@ func (app *application) DeletePending(w http.ResponseWriter, r *http.Request) {
 		app.errorJSON(w, err)
 		return
 	}
-	err = app.DB.DeleteBookingRequest(booking)
+	stored, err := app.DB.GetBookingRequest(booking.ID)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	if !app.authorizeOwner(w, r, stored.Username, models.PermManageAllBookings) {
+		return
+	}
+
+	err = app.DB.DeleteBookingRequest(*stored)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -136,7 +201,16 @@ func (app *application) DeleteApproved(w http.ResponseWriter, r *http.Request) {
 		app.errorJSON(w, err)
 		return
 	}
-	err = app.DB.DeleteApprovedBooking(booking)
+	stored, err := app.DB.GetApprovedBooking(booking.ID)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	if !app.authorizeOwner(w, r, stored.Username, models.PermManageAllBookings) {
+		return
+	}
+
+	err = app.DB.DeleteApprovedBooking(*stored)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -158,7 +232,25 @@ func (app *application) DeleteRecurring(w http.ResponseWriter, r *http.Request)
 		app.errorJSON(w, err)
 		return
 	}
-	err = app.DB.DeleteRecurringBooking(booking)
+	stored, err := app.DB.GetRecurringBooking(booking.ID)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	if !app.authorizeOwner(w, r, stored.Username, models.PermManageAllBookings) {
+		return
+	}
+
+	if stored.SeriesID != nil {
+		// occurrences of a series are cancelled through it so the series records the gap
+		err = app.DB.CancelSeriesOccurrence(models.OccurrenceChange{
+			SeriesID:     *stored.SeriesID,
+			OccurrenceID: stored.ID,
+			Scope:        models.ScopeThis,
+		})
+	} else {
+		err = app.DB.DeleteRecurringBooking(*stored)
+	}
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -172,7 +264,34 @@ func (app *application) DeleteRecurring(w http.ResponseWriter, r *http.Request)
 	app.writeJSON(w, http.StatusAccepted, resp)
 }
 
+// dummyHash is the password hash checked for usernames that do not exist, so they take
+// as long to reject as a wrong password. It has to use the cost real hashes are made
+// with, otherwise unknown usernames are answered faster.
+type dummyHash struct {
+	mu   sync.Mutex
+	cost int
+	hash string
+}
+
+// dummyPasswordHash returns a hash made with the configured bcrypt cost, rebuilding it
+// when the cost has changed
+func (app *application) dummyPasswordHash() (string, error) {
+	app.dummyHash.mu.Lock()
+	defer app.dummyHash.mu.Unlock()
+
+	if app.dummyHash.hash == "" || app.dummyHash.cost != app.BcryptCost {
+		hash, err := passwords.Hash("no such user", app.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		app.dummyHash.hash = hash
+		app.dummyHash.cost = app.BcryptCost
+	}
+	return app.dummyHash.hash, nil
+}
 
+// authenticate signs a user in. Unknown usernames and wrong passwords get the same
+// answer, and repeated failures slow down and then lock further attempts.
 func (app *application) authenticate(w http.ResponseWriter, r *http.Request) {
 	// read json payload
 	var requestPayload struct {
@@ -185,46 +304,88 @@ func (app *application) authenticate(w http.ResponseWriter, r *http.Request) {
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
-	// validate user against database
-	user, err := app.DB.GetUserByName(requestPayload.Username)
+
+	username := requestPayload.Username
+	ip := app.clientIP(r)
+	now := time.Now()
+
+	// the attempt is counted before the password is checked, attempts that have to wait
+	// are rejected without checking it and do not count as failures
+	attempt, wait, err := app.reserveLogin(username, ip, now)
 	if err != nil {
-		app.errorJSON(w, errors.New("username does not exist"), http.StatusBadRequest)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		app.auditLogin(username, ip, models.LoginThrottled)
+		app.tooManyAttemptsJSON(w, wait)
+		return
+	}
+
+	// validate user against database
+	user, err := app.DB.GetUserByName(username)
+	if err != nil && err != sql.ErrNoRows {
+		app.returnLogin(attempt)
+		app.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// check password
-	valid, err := user.PasswordMatches(requestPayload.Password)
+	valid := false
+	if user != nil {
+		valid, err = user.PasswordMatches(requestPayload.Password)
+	} else {
+		var hash string
+		hash, err = app.dummyPasswordHash()
+		if err == nil {
+			_, err = (&models.User{Password: hash}).PasswordMatches(requestPayload.Password)
+		}
+	}
 	if err != nil || !valid {
-		app.errorJSON(w, errors.New("invalid credentials"), http.StatusBadRequest)
+		app.auditLogin(username, ip, models.LoginFailed)
+		err = app.loginFailed(attempt, now)
+		if err != nil {
+			log.Println("Error recording sign in failure: ", err)
+		}
+		app.errorJSON(w, errors.New("invalid username or password"), http.StatusBadRequest)
 		return
 	}
 
-	// create a jwt user
-	u := jwtUser{
-		ID:       user.ID,
-		Username: user.Username,
-		IsAdmin:  user.IsAdmin,
+	app.rehashPassword(user, requestPayload.Password)
+
+	// users with two-factor authentication get a challenge for their code instead of tokens
+	mfa, err := app.DB.GetUserMFA(user.Username)
+	if err != nil && !errors.Is(err, repository.ErrMFANotEnrolled) {
+		app.returnLogin(attempt)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if mfa != nil && mfa.Enabled() {
+		app.returnLogin(attempt)
+		app.auditLogin(username, ip, models.LoginMFARequired)
+		app.mfaChallengeJSON(w, user)
+		return
 	}
 
-	// generate tokens
-	tokens, err := app.auth.GenerateTokenPair(&u)
+	app.loginSucceeded(attempt)
+	app.auditLogin(username, ip, models.LoginSucceeded)
+
+	tokens, err := app.startSession(w, r, user, false)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	refreshCookie := app.auth.GetRefreshCookie(tokens.RefreshToken)
-	http.SetCookie(w, refreshCookie)
-
 	app.writeJSON(w, http.StatusAccepted, tokens)
 }
 
 func (app *application) register(w http.ResponseWriter, r *http.Request) {
 	// read json payload
+	// accounts are always created as residents, staff are promoted by an admin afterwards
 	var requestPayload struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Admin    bool   `json:"admin"`
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
 	}
 
 	err := app.readJSON(w, r, &requestPayload)
@@ -233,91 +394,170 @@ func (app *application) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if requestPayload.Username == "" || requestPayload.Password == "" || requestPayload.InviteCode == "" {
+		app.errorJSON(w, errors.New("username, password and invite code are required"), http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := app.hashNewPassword(requestPayload.Password, requestPayload.Username)
+	if err != nil {
+		app.passwordErrorJSON(w, err)
+		return
+	}
+
 	// register user
-	user, _ := app.DB.RegisterUser(requestPayload.Username, requestPayload.Password, requestPayload.Admin)
+	user, err := app.DB.RegisterUser(requestPayload.Username, passwordHash, requestPayload.InviteCode)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	tokens, err := app.startSession(w, r, user, false)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusAccepted, tokens)
+}
+
+// JWKS publishes the public keys access tokens are signed with, so other services can
+// verify them. Retired keys stay listed until tokens signed with them have expired.
+func (app *application) JWKS(w http.ResponseWriter, r *http.Request) {
+	headers := http.Header{}
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	_ = app.writeJSON(w, http.StatusOK, map[string]interface{}{"keys": app.auth.Keys.JWKS()}, headers)
+}
+
+// startSession issues a token pair for the user, storing its refresh token as the
+// first of a new family, and sets the refresh cookie. The family is the new session,
+// recorded with the client of the request.
+func (app *application) startSession(w http.ResponseWriter, r *http.Request, user *models.User, mfa bool) (TokenPairs, error) {
+	familyID, err := app.auth.NewTokenFamily()
+	if err != nil {
+		return TokenPairs{}, err
+	}
 
 	// create a jwt user
 	u := jwtUser{
-		ID:       user.ID,
-		Username: user.Username,
-		IsAdmin:  user.IsAdmin,
+		ID:        user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		MFA:       mfa,
+		SessionID: familyID,
 	}
 
 	// generate tokens
 	tokens, err := app.auth.GenerateTokenPair(&u)
 	if err != nil {
-		app.errorJSON(w, err)
-		return
+		return TokenPairs{}, err
+	}
+
+	err = app.DB.InsertRefreshToken(models.RefreshToken{
+		Token:     tokens.RefreshToken,
+		FamilyID:  familyID,
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(app.auth.RefreshExpiry),
+		MFA:       mfa,
+		UserAgent: r.UserAgent(),
+		IPAddress: app.clientIP(r),
+	})
+	if err != nil {
+		return TokenPairs{}, err
 	}
 
 	refreshCookie := app.auth.GetRefreshCookie(tokens.RefreshToken)
 	http.SetCookie(w, refreshCookie)
 
-	app.writeJSON(w, http.StatusAccepted, tokens)
+	// a new session gets a new CSRF token, so a token planted before sign in is useless
+	tokens.CSRFToken, err = app.auth.NewCSRFToken()
+	if err != nil {
+		return TokenPairs{}, err
+	}
+	http.SetCookie(w, app.auth.GetCSRFCookie(tokens.CSRFToken))
+
+	return tokens, nil
 }
 
+// refreshToken exchanges the refresh cookie for a new token pair. The refresh token is
+// used up, presenting it again revokes every token issued from it.
 func (app *application) refreshToken(w http.ResponseWriter, r *http.Request) {
-	for _, cookie := range r.Cookies() {
-		// log.Println("Request Host: ", r.Host)
-		// log.Println("Request Path: ", r.URL.Path)
-		// log.Println("Cookie name: ", cookie.Name)
-		// log.Println("App cookie name: ", app.auth.CookieName)
-		if cookie.Name == app.auth.CookieName {
-			log.Println("Cookie name passed")
-			claims := &Claims{}
-			refreshToken := cookie.Value
-
-			// parse the token to get the claims
-			_, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-				log.Println("Success claim parsing")
-				return []byte(app.JWTSecret), nil
-			})
-			if err != nil {
-				log.Println("Unauthorized")
-				app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
-				return
-			}
-
-			// get the username from the token claims
-			username := claims.Username
-			if err != nil {
-				log.Println("Unknown user")
-				app.errorJSON(w, errors.New("unknown user"), http.StatusUnauthorized)
-				return
-			}
-
-			// check if user still exists
-			user, err := app.DB.GetUserByName(username)
-
-			if err != nil {
-				log.Println("Unknown user")
-				app.errorJSON(w, errors.New("unknown user"), http.StatusUnauthorized)
-				return
-			}
-
-			u := jwtUser{
-				ID:       user.ID,
-				Username: user.Username,
-				IsAdmin:  user.IsAdmin,
-			}
-
-			tokenPairs, err := app.auth.GenerateTokenPair(&u)
-
-			if err != nil {
-				log.Println("Error generating token")
-				app.errorJSON(w, errors.New("error generating tokens"), http.StatusUnauthorized)
-				return
-			}
-
-			log.Println("Sucess token generation")
-			http.SetCookie(w, app.auth.GetRefreshCookie(tokenPairs.RefreshToken))
-
-			app.writeJSON(w, http.StatusOK, tokenPairs)
+	cookie, err := r.Cookie(app.auth.CookieName)
+	if err != nil {
+		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, err := app.auth.NewRefreshToken()
+	if err != nil {
+		app.errorJSON(w, errors.New("error generating tokens"), http.StatusInternalServerError)
+		return
+	}
+
+	stored, err := app.DB.RotateRefreshToken(cookie.Value, models.RefreshToken{
+		Token:     refreshToken,
+		ExpiresAt: time.Now().Add(app.auth.RefreshExpiry),
+		UserAgent: r.UserAgent(),
+		IPAddress: app.clientIP(r),
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenReused) {
+			log.Println("Refresh token reused, session revoked")
 		}
+		http.SetCookie(w, app.auth.GetExpiredRefreshCookie())
+		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	// check if user still exists
+	user, err := app.DB.GetUserByName(stored.Username)
+	if err != nil {
+		log.Println("Unknown user")
+		app.errorJSON(w, errors.New("unknown user"), http.StatusUnauthorized)
+		return
+	}
+
+	u := jwtUser{
+		ID:        user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		MFA:       stored.MFA,
+		SessionID: stored.FamilyID,
+	}
+
+	accessToken, err := app.auth.GenerateAccessToken(&u)
+	if err != nil {
+		log.Println("Error generating token")
+		app.errorJSON(w, errors.New("error generating tokens"), http.StatusUnauthorized)
+		return
 	}
+
+	http.SetCookie(w, app.auth.GetRefreshCookie(refreshToken))
+
+	// csrfCheck has made sure the cookie is there, it lives as long as the new refresh cookie
+	csrfToken := csrfCookieValue(r, app.auth.CSRFCookieName)
+	http.SetCookie(w, app.auth.GetCSRFCookie(csrfToken))
+
+	app.writeJSON(w, http.StatusOK, TokenPairs{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		CSRFToken:    csrfToken,
+	})
 }
 
+// logout revokes the session of the refresh cookie and expires the cookie
 func (app *application) logout(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(app.auth.CookieName)
+	if err == nil {
+		err = app.DB.RevokeRefreshToken(cookie.Value)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	http.SetCookie(w, app.auth.GetExpiredRefreshCookie())
+	http.SetCookie(w, app.auth.GetExpiredCSRFCookie())
 	w.WriteHeader(http.StatusAccepted)
 }
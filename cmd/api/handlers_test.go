@@ -0,0 +1,62 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInsertBookingUnitNumber(t *testing.T) {
+	tests := []struct {
+		name       string
+		unitNumber string
+		wantStatus int
+	}{
+		{"unit left out", "", http.StatusAccepted},
+		{"own unit", "12A", http.StatusAccepted},
+		{"another unit", "3C", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			user := newTestUser(t, app, "alice", models.RoleResident)
+			if _, err := app.DB.InsertFacility(models.Facility{Name: "Function Room", Active: true}); err != nil {
+				t.Fatalf("InsertFacility: %v", err)
+			}
+
+			day := time.Now().UTC().AddDate(0, 0, 14)
+			start := time.Date(day.Year(), day.Month(), day.Day(), 19, 0, 0, 0, time.UTC)
+			rec := httptest.NewRecorder()
+			app.routes().ServeHTTP(rec, authRequest(t, app, user, false, http.MethodPut, "/admin/add-booking", models.Booking{
+				Name:       "Alice",
+				UnitNumber: tt.unitNumber,
+				StartDate:  start,
+				EndDate:    start.Add(time.Hour),
+				StartTime:  start.Format(time.RFC3339),
+				EndTime:    start.Add(time.Hour).Format(time.RFC3339),
+				Purpose:    "yoga",
+				Facility:   "Function Room",
+			}))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("add-booking = %d %s, want %d", rec.Code, rec.Body, tt.wantStatus)
+			}
+
+			_, _, requested, err := app.DB.UserBookings("alice")
+			if err != nil {
+				t.Fatalf("UserBookings: %v", err)
+			}
+			if tt.wantStatus != http.StatusAccepted {
+				if len(requested) != 0 {
+					t.Errorf("rejected request was stored: %+v", requested)
+				}
+				return
+			}
+			if len(requested) != 1 || requested[0].UnitNumber != "12A" {
+				t.Errorf("requested bookings = %+v, want one for unit 12A", requested)
+			}
+		})
+	}
+}
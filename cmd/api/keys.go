@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys
+const minRSABits = 2048
+
+// signingKey is a key of the key set. Private is nil for retired keys that only
+// verify tokens issued before a rotation.
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet holds the keys access tokens are signed and verified with. During a rotation
+// the old and the new key are both in the set, tokens are signed with the active key
+// and verified with whichever key their kid header names.
+type KeySet struct {
+	keys    map[string]*signingKey
+	signing *signingKey
+}
+
+// LoadKeySet reads every <kid>.pem file in dir. Files holding a PKCS#8 or PKCS#1
+// private key (RSA or Ed25519) can sign, files holding only a PKIX public key can
+// only verify. activeKID names the signing key, the last kid in sort order if empty.
+func LoadKeySet(dir, activeKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{keys: map[string]*signingKey{}}
+	var signers []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := parseSigningKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		ks.keys[kid] = key
+		if key.Private != nil {
+			signers = append(signers, kid)
+		}
+	}
+
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no private signing key in %s", dir)
+	}
+
+	if activeKID == "" {
+		sort.Strings(signers)
+		activeKID = signers[len(signers)-1]
+	}
+
+	active, ok := ks.keys[activeKID]
+	if !ok || active.Private == nil {
+		return nil, fmt.Errorf("signing key %q is not a private key in %s", activeKID, dir)
+	}
+	ks.signing = active
+
+	return ks, nil
+}
+
+// ParseKeySet reads a single private key in PEM, as kept in a config var where there
+// is no key directory. Without a kid the key is named after a hash of its public key,
+// so replacing the key also replaces the kid.
+func ParseKeySet(data []byte, kid string) (*KeySet, error) {
+	key, err := parseSigningKey(kid, data)
+	if err != nil {
+		return nil, err
+	}
+	if key.Private == nil {
+		return nil, errors.New("the signing key must be a private key")
+	}
+
+	if key.ID == "" {
+		der, err := x509.MarshalPKIXPublicKey(key.Public)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		key.ID = base64.RawURLEncoding.EncodeToString(sum[:9])
+	}
+
+	return &KeySet{
+		keys:    map[string]*signingKey{key.ID: key},
+		signing: key,
+	}, nil
+}
+
+// GenerateKeySet returns a key set with a single Ed25519 key that only lives as long
+// as the process, tokens it signed are rejected after a restart
+func GenerateKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	kid := make([]byte, 8)
+	_, err = rand.Read(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		ID:      "ephemeral-" + base64.RawURLEncoding.EncodeToString(kid),
+		Method:  jwt.SigningMethodEdDSA,
+		Private: private,
+		Public:  public,
+	}
+
+	return &KeySet{
+		keys:    map[string]*signingKey{key.ID: key},
+		signing: key,
+	}, nil
+}
+
+// parseSigningKey decodes the PEM block of a key file
+func parseSigningKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, expected RSA or Ed25519", parsed)
+	}
+
+	if rsaKey, ok := key.Public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key has %d bits, at least %d are required", rsaKey.N.BitLen(), minRSABits)
+	}
+
+	return key, nil
+}
+
+// Sign signs the token with the active key and names it in the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.Private)
+}
+
+// Keyfunc returns the public key a token was signed with, for jwt.ParseWithClaims.
+// The algorithm must match the key so an RSA key cannot be used as an HMAC secret.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+// JSONWebKey is the public part of a signing key as published in the JWKS (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA keys
+	Modulus  string `json:"n,omitempty"`
+	Exponent string `json:"e,omitempty"`
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS lists the public keys of every key in the set, ordered by kid
+func (ks *KeySet) JWKS() []JSONWebKey {
+	ids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		ids = append(ids, kid)
+	}
+	sort.Strings(ids)
+
+	keys := make([]JSONWebKey, 0, len(ids))
+	for _, kid := range ids {
+		key := ks.keys[kid]
+		jwk := JSONWebKey{
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+		}
+
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		keys = append(keys, jwk)
+	}
+
+	return keys
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestLoadKeySet(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	privatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	publicDER, err := x509.MarshalPKIXPublicKey(edKey.Public())
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+
+	tests := []struct {
+		name string
+		app  *application
+		// wantKID is the kid tokens are signed with, "ephemeral" for a temporary key
+		// and "" when loading fails
+		wantKID string
+	}{
+		{"temporary key in development", &application{Env: "development"}, "ephemeral"},
+		{"no key in production", &application{Env: "production"}, ""},
+		{"config var in production", &application{Env: "production", JWTPrivateKey: privatePEM, JWTSigningKey: "2026-10"}, "2026-10"},
+		{"config var without a kid", &application{Env: "production", JWTPrivateKey: privatePEM}, "hashed"},
+		{"public key in the config var", &application{Env: "production", JWTPrivateKey: publicPEM}, ""},
+		{"missing key directory", &application{Env: "production", JWTKeys: t.TempDir()}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := tt.app.loadKeySet()
+			if tt.wantKID == "" {
+				if err == nil {
+					t.Errorf("loadKeySet succeeded with kid %s, want an error", keys.signing.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadKeySet: %v", err)
+			}
+
+			kid := keys.signing.ID
+			switch tt.wantKID {
+			case "ephemeral":
+				if !strings.HasPrefix(kid, "ephemeral-") {
+					t.Errorf("kid = %s, want a temporary key", kid)
+				}
+			case "hashed":
+				// the same key gets the same kid on every start
+				again, err := tt.app.loadKeySet()
+				if err != nil || again.signing.ID != kid || strings.HasPrefix(kid, "ephemeral-") {
+					t.Errorf("kids = %s and %v, want the same hash of the key", kid, again)
+				}
+			default:
+				if kid != tt.wantKID {
+					t.Errorf("kid = %s, want %s", kid, tt.wantKID)
+				}
+			}
+		})
+	}
+}
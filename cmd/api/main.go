@@ -1,72 +1,202 @@
 package main
 
 import (
+	"booking-backend/internal/cors"
+	"booking-backend/internal/oidc"
+	"booking-backend/internal/passwords"
 	"booking-backend/internal/repository"
 	"booking-backend/internal/repository/dbrepo"
+	"errors"
 	"flag"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+	_ "time/tzdata" // facility time zones must resolve on hosts without a zoneinfo database
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type application struct {
-	Domain       string
-	DSN          string
-	DB           repository.DatabaseRepo
-	auth         Auth
-	JWTSecret    string
-	JWTIssuer    string
-	JWTAudience  string
-	CookieDomain string
+	Domain        string
+	Store         string
+	DSN           string
+	DB            repository.DatabaseRepo
+	auth          Auth
+	notifier      Notifier
+	NotifyFile    string
+	JWTKeys       string
+	JWTPrivateKey string
+	JWTSigningKey string
+	JWTIssuer     string
+	JWTAudience   string
+	CookieDomain  string
+	ProxyHeaders  bool
+	RequireMFA    bool
+	// Env is development or production, production refuses to start with a temporary
+	// signing key
+	Env string
+	// PasswordPolicy is checked for every new password, BcryptCost is used to hash them
+	PasswordPolicy passwords.Policy
+	BcryptCost     int
+	// single sign-on with an OpenID Connect provider, disabled when OIDCIssuer is empty
+	OIDCIssuer        string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string
+	OIDCUnitClaim     string
+	OIDCAutoProvision bool
+	oidc              *oidc.Provider
+	dummyHash         dummyHash
+	// browsers may call the API from the CORS origins, see newCORSPolicy
+	CORSOrigins     string
+	CORSMethods     string
+	CORSHeaders     string
+	CORSMaxAge      time.Duration
+	CORSCredentials bool
+	cors            *cors.Policy
 }
 
 func main() {
 	// set application config
 	var app application
 
-	// read from command line
-	dsn, exists := os.LookupEnv("DATABASE_URL")
-	if !exists {
-		log.Print("DATABASE_URL not set, setting to localhost")
-		flag.StringVar(
-			&app.DSN,
-			"dsn",
-			"host=localhost port = 5432 user=syal password=syal dbname=bookings sslmode=disable timezone=UTC connect_timeout=5",
-			"Postgres connection string",
-		)
-		flag.Parse()
-	} else {
-		app.DSN = dsn
-	}
-
-	flag.StringVar(&app.JWTSecret, "jwt-secret", "secret", "signing secret")
+	// read from command line, DATABASE_URL takes precedence over the dsn flag
+	flag.StringVar(&app.Store, "store", "db", "storage backend: db (Postgres or SQLite, chosen by the dsn) or memory")
+	flag.StringVar(
+		&app.DSN,
+		"dsn",
+		"host=localhost port = 5432 user=syal password=syal dbname=bookings sslmode=disable timezone=UTC connect_timeout=5",
+		"Postgres connection string, or sqlite:path/to/file.db for SQLite",
+	)
+	flag.StringVar(&app.Env, "env", "development", "development or production, production requires signing keys")
+	flag.StringVar(&app.JWTKeys, "jwt-keys", "", "directory of <kid>.pem signing keys, JWT_PRIVATE_KEY or a temporary key is used if empty")
+	flag.StringVar(&app.JWTSigningKey, "jwt-signing-key", "", "kid of the key new tokens are signed with, the last kid if empty")
 	flag.StringVar(&app.JWTIssuer, "jwt-issuer", "https://syal-2ae9b.firebaseapp.com", "signing issuer")
 	flag.StringVar(&app.JWTAudience, "jwt-audience", "https://syal-2ae9b.firebaseapp.com", "signing audience")
 	flag.StringVar(&app.CookieDomain, "cookie-domain", "bookingsyal-cbd544b30b67.herokuapp.com", "cookie domain")
 	// flag.StringVar(&app.CookieDomain, "cookie-domain", "localhost", "cookie domain")
+	flag.IntVar(&app.PasswordPolicy.MinLength, "password-min-length", passwords.DefaultPolicy.MinLength, "minimum number of characters of new passwords")
+	flag.IntVar(&app.PasswordPolicy.MaxLength, "password-max-length", passwords.DefaultPolicy.MaxLength, "maximum number of bytes of new passwords, at most 72")
+	flag.IntVar(&app.PasswordPolicy.MinClasses, "password-min-classes", passwords.DefaultPolicy.MinClasses, "character classes (lower, upper, digit, symbol) new passwords must use")
+	flag.IntVar(&app.BcryptCost, "bcrypt-cost", bcrypt.DefaultCost, "bcrypt cost of new password hashes, older hashes are upgraded on sign in")
+	flag.BoolVar(&app.ProxyHeaders, "proxy-headers", false, "take the client address from X-Forwarded-For, only safe behind a proxy such as the Heroku router that every request passes")
+	flag.BoolVar(&app.RequireMFA, "require-mfa", false, "require facility managers and admins to sign in with TOTP")
+	flag.StringVar(&app.NotifyFile, "notify-file", "", "file password reset links are written to, the log if empty")
+	flag.StringVar(&app.OIDCIssuer, "oidc-issuer", "", "issuer URL of the OpenID Connect provider, single sign-on is disabled if empty")
+	flag.StringVar(&app.OIDCClientID, "oidc-client-id", "", "client id registered with the OpenID Connect provider")
+	flag.StringVar(&app.OIDCRedirectURL, "oidc-redirect-url", "", "URL of /oidc/callback registered with the OpenID Connect provider")
+	flag.StringVar(&app.OIDCUnitClaim, "oidc-unit-claim", "unit_number", "ID token claim holding the unit number of provisioned residents")
+	flag.BoolVar(&app.OIDCAutoProvision, "oidc-auto-provision", false, "create a resident on the first single sign-on of an unknown user whose ID token has the unit claim")
+	flag.StringVar(&app.CORSOrigins, "cors-origins", strings.Join(defaultCORSOrigins, ","), "comma separated origins allowed to call the API from a browser, https://*.example.com allows subdomains")
+	flag.StringVar(&app.CORSMethods, "cors-methods", strings.Join(cors.DefaultMethods, ","), "comma separated methods allowed in cross-origin requests")
+	flag.StringVar(&app.CORSHeaders, "cors-headers", strings.Join(cors.DefaultHeaders, ","), "comma separated request headers allowed in cross-origin requests, * for any")
+	flag.DurationVar(&app.CORSMaxAge, "cors-max-age", cors.DefaultMaxAge, "how long browsers may cache a CORS preflight")
+	flag.BoolVar(&app.CORSCredentials, "cors-credentials", true, "let the CORS origins send cookies, needed for the refresh cookie")
 	flag.StringVar(&app.Domain, "domain", "https://syal-2ae9b.firebaseapp.com", "domain")
 	flag.Parse()
 
-	// connect to database
-	conn, err := app.connectToDB()
+	if app.Env != "development" && app.Env != "production" {
+		log.Fatalf("unknown env %q, expected development or production", app.Env)
+	}
 
+	err := app.PasswordPolicy.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = passwords.ValidateCost(app.BcryptCost)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// hash once now so the first sign in of an unknown username is not the one that waits
+	_, err = app.dummyPasswordHash()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	app.DB = &dbrepo.PostgresDBRepo{DB: conn}
-	defer app.DB.Connection().Close() // closes when main finishes running
+	dsn, exists := os.LookupEnv("DATABASE_URL")
+	if !exists {
+		log.Print("DATABASE_URL not set, using dsn flag")
+	} else {
+		app.DSN = dsn
+	}
+
+	// secrets are only read from the environment so they do not show up in ps
+	app.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	app.JWTPrivateKey = os.Getenv("JWT_PRIVATE_KEY")
+
+	// `api migrate ...` manages the schema instead of starting the server
+	if flag.Arg(0) == "migrate" {
+		err := app.migrate(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// `api users ...` invites residents and assigns roles from the command line
+	if flag.Arg(0) == "users" {
+		err := app.users(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	switch app.Store {
+	case "db":
+		// connect to database
+		conn, err := app.connectToDB()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		app.DB = app.newDBRepo(conn)
+		defer conn.Close() // closes when main finishes running
+	case "memory":
+		log.Print("Using in-memory store, data is lost on exit")
+		app.DB = dbrepo.NewMemoryDBRepo()
+	default:
+		log.Fatalf("unknown store %q, expected db or memory", app.Store)
+	}
+
+	keys, err := app.loadKeySet()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	app.auth = Auth{
 		Issuer:        app.JWTIssuer,
 		Audience:      app.JWTAudience,
-		Secret:        app.JWTSecret,
+		Keys:          keys,
 		TokenExpiry:   time.Minute * 15,
+		Leeway:        defaultLeeway,
 		RefreshExpiry: time.Hour * 24,
 		CookiePath:    "/",
 		CookieName:    "refresh_token",
 		CookieDomain:  app.CookieDomain,
+		// double-submit CSRF token for the endpoints authenticated by the refresh cookie
+		CSRFCookieName: "csrf_token",
+	}
+
+	// there is no mail delivery yet, reset links are left for an admin to pass on
+	app.notifier = logNotifier{}
+	if app.NotifyFile != "" {
+		app.notifier = &fileNotifier{Path: app.NotifyFile}
+	}
+
+	app.oidc, err = app.newOIDCProvider()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if app.oidc != nil {
+		log.Print("Single sign-on with ", app.OIDCIssuer)
+	}
+
+	app.cors, err = app.newCORSPolicy()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	port, exists := os.LookupEnv("PORT")
@@ -82,3 +212,27 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// loadKeySet loads the signing keys from the -jwt-keys directory or the JWT_PRIVATE_KEY
+// config var. Outside production a temporary key is generated when neither is set.
+func (app *application) loadKeySet() (*KeySet, error) {
+	var keys *KeySet
+	var err error
+	switch {
+	case app.JWTKeys != "":
+		keys, err = LoadKeySet(app.JWTKeys, app.JWTSigningKey)
+	case app.JWTPrivateKey != "":
+		keys, err = ParseKeySet([]byte(app.JWTPrivateKey), app.JWTSigningKey)
+	case app.Env == "production":
+		return nil, errors.New("no signing key, set -jwt-keys or JWT_PRIVATE_KEY")
+	default:
+		log.Print("No -jwt-keys directory or JWT_PRIVATE_KEY, signing with a temporary key; tokens are invalidated on restart")
+		return GenerateKeySet()
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Print("Signing tokens with key ", keys.signing.ID)
+
+	return keys, nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"booking-backend/internal/totp"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// totpIssuer names the API in authenticator apps
+	totpIssuer = "Book4U"
+	// totpSkew is how many periods a code may be off, for clocks that are not in sync
+	totpSkew = 1
+	// recoveryCodeCount is how many recovery codes a user receives when enabling TOTP
+	recoveryCodeCount = 10
+)
+
+// newRecoveryCodes returns single-use codes for signing in without the authenticator,
+// e.g. 7kq2m-4xdpz
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes = append(codes, code[0:5]+"-"+code[5:10])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts codes typed in upper case or with surrounding spaces
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// mfaChallengeJSON answers a correct password of a user with two-factor authentication
+// with a challenge token, exchanged for the token pair at /authenticate/mfa
+func (app *application) mfaChallengeJSON(w http.ResponseWriter, user *models.User) {
+	challenge, err := app.auth.GenerateMFAChallenge(&jwtUser{
+		ID:       user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+	})
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}{
+		MFARequired: true,
+		MFAToken:    challenge,
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, resp)
+}
+
+// authenticateMFA completes a sign in with a TOTP code or a recovery code. Wrong codes
+// count as failed sign ins of the user.
+func (app *application) authenticateMFA(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	claims, err := app.auth.mfaVerifier().Verify(payload.MFAToken, tokenTypeMFAChallenge)
+	if err != nil {
+		app.errorJSON(w, errors.New("sign in has expired, please enter your password again"), http.StatusUnauthorized)
+		return
+	}
+
+	username := claims.Username
+	ip := app.clientIP(r)
+	now := time.Now()
+
+	// the attempt is counted before the code is checked, like a password
+	attempt, wait, err := app.reserveLogin(username, ip, now)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		app.auditLogin(username, ip, models.LoginThrottled)
+		app.tooManyAttemptsJSON(w, wait)
+		return
+	}
+
+	user, err := app.DB.GetUserByName(username)
+	if err != nil {
+		app.returnLogin(attempt)
+		app.errorJSON(w, errors.New("unknown user"), http.StatusUnauthorized)
+		return
+	}
+	mfa, err := app.DB.GetUserMFA(username)
+	if err != nil || !mfa.Enabled() {
+		app.returnLogin(attempt)
+		app.errorJSON(w, errors.New("two-factor authentication is not set up"), http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case payload.Code != "":
+		step, ok := totp.Validate(mfa.Secret, payload.Code, now, totpSkew)
+		err = errors.New("invalid code")
+		if ok {
+			err = app.DB.UseTOTPStep(username, step)
+		}
+	case payload.RecoveryCode != "":
+		err = app.DB.UseRecoveryCode(username, normalizeRecoveryCode(payload.RecoveryCode))
+	default:
+		app.returnLogin(attempt)
+		app.errorJSON(w, errors.New("code or recovery code is required"))
+		return
+	}
+	if err != nil {
+		app.auditLogin(username, ip, models.LoginMFAFailed)
+		failureErr := app.loginFailed(attempt, now)
+		if failureErr != nil {
+			log.Println("Error recording sign in failure: ", failureErr)
+		}
+		if !errors.Is(err, repository.ErrTOTPCodeReused) {
+			err = errors.New("invalid code")
+		}
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	app.loginSucceeded(attempt)
+	app.auditLogin(username, ip, models.LoginSucceeded)
+
+	tokens, err := app.startSession(w, r, user, true)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, tokens)
+}
+
+// MFAStatus tells the signed in user whether two-factor authentication is enabled and
+// whether their role requires it
+func (app *application) MFAStatus(w http.ResponseWriter, r *http.Request) {
+	p := principalFromContext(r.Context())
+
+	enabled := false
+	mfa, err := app.DB.GetUserMFA(p.Username)
+	if err == nil {
+		enabled = mfa.Enabled()
+	} else if !errors.Is(err, repository.ErrMFANotEnrolled) {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := struct {
+		Enabled  bool `json:"enabled"`
+		Required bool `json:"required"`
+	}{
+		Enabled:  enabled,
+		Required: app.RequireMFA && mfaRequired(p.Role),
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
+
+// BeginMFAEnrolment creates a TOTP secret for the signed in user. The frontend shows
+// the provisioning URI as a QR code, TOTP is enabled once a code is confirmed.
+func (app *application) BeginMFAEnrolment(w http.ResponseWriter, r *http.Request) {
+	p := principalFromContext(r.Context())
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.DB.BeginMFAEnrolment(p.Username, secret)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, p.Username, secret),
+	}
+
+	_ = app.writeJSON(w, http.StatusCreated, resp)
+}
+
+// EnableMFA confirms the enrolment with a code from the authenticator app and returns
+// the recovery codes, which are only shown here. The caller receives a new token pair
+// that carries the second factor.
+func (app *application) EnableMFA(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	p := principalFromContext(r.Context())
+	mfa, err := app.DB.GetUserMFA(p.Username)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	if mfa.Enabled() {
+		app.repoErrorJSON(w, repository.ErrMFAAlreadyEnabled)
+		return
+	}
+
+	step, ok := totp.Validate(mfa.Secret, payload.Code, time.Now(), totpSkew)
+	if !ok {
+		app.errorJSON(w, errors.New("invalid code"))
+		return
+	}
+
+	recoveryCodes, err := newRecoveryCodes()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.DB.EnableMFA(p.Username, step, recoveryCodes)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	user, err := app.DB.GetUserByName(p.Username)
+	if err != nil {
+		app.errorJSON(w, errors.New("unknown user"), http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := app.startSession(w, r, user, true)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	resp := struct {
+		TokenPairs
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		TokenPairs:    tokens,
+		RecoveryCodes: recoveryCodes,
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
+
+// DisableMFA turns two-factor authentication off after checking the user's password.
+// Users whose role requires it cannot turn it off.
+func (app *application) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	p := principalFromContext(r.Context())
+	if app.RequireMFA && mfaRequired(p.Role) {
+		app.errorJSON(w, errors.New("two-factor authentication is required for your role"), http.StatusForbidden)
+		return
+	}
+
+	user, err := app.DB.GetUserByName(p.Username)
+	if err != nil {
+		app.errorJSON(w, errors.New("unknown user"), http.StatusUnauthorized)
+		return
+	}
+
+	valid, err := user.PasswordMatches(payload.Password)
+	if err != nil || !valid {
+		app.errorJSON(w, errors.New("password is incorrect"), http.StatusForbidden)
+		return
+	}
+
+	err = app.DB.DisableMFA(p.Username)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Two-factor authentication disabled",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
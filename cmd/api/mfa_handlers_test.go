@@ -0,0 +1,52 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"booking-backend/internal/totp"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateMFARejectsReusedCode(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "alice", models.RoleResident)
+	const secret = "JBSWY3DPEHPK3PXP"
+	if err := app.DB.BeginMFAEnrolment("alice", secret); err != nil {
+		t.Fatalf("BeginMFAEnrolment: %v", err)
+	}
+	if err := app.DB.EnableMFA("alice", 1, []string{"recovery-code"}); err != nil {
+		t.Fatalf("EnableMFA: %v", err)
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	handler := app.routes()
+
+	signIn := func() *httptest.ResponseRecorder {
+		challenge, err := app.auth.GenerateMFAChallenge(&jwtUser{ID: user.ID, Username: user.Username, Role: user.Role})
+		if err != nil {
+			t.Fatalf("GenerateMFAChallenge: %v", err)
+		}
+		body, _ := json.Marshal(map[string]string{"mfa_token": challenge, "code": code})
+		req := httptest.NewRequest(http.MethodPost, "/authenticate/mfa", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := signIn(); rec.Code != http.StatusAccepted {
+		t.Fatalf("first use of the code = %d %s, want %d", rec.Code, rec.Body, http.StatusAccepted)
+	}
+	rec := signIn()
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), repository.ErrTOTPCodeReused.Error()) {
+		t.Errorf("second use of the code = %d %s, want %d with %q", rec.Code, rec.Body, http.StatusBadRequest, repository.ErrTOTPCodeReused)
+	}
+}
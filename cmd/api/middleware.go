@@ -1,41 +1,132 @@
 package main
 
 import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
-func (app *application) enableCORS(h http.Handler) http.Handler {
+// authCheck verifies the access token and stores its principal in the request context
+func (app *application) authCheck(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		allowedOrigins := map[string]bool{
-			"https://syal-2ae9b.firebaseapp.com": true,
-			"https://syal-2ae9b.web.app":         true,
-			"http://localhost:3000":               true,
+		_, claims, err := app.auth.GetAndVerifyHeaderToken(w, r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
 		}
-		origin := r.Header.Get("Origin")
-		log.Print("Origin: ", origin);
-		log.Print("Allowed: ", allowedOrigins[origin]);
-		if _, ok := allowedOrigins[origin]; ok {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, X-CSRF-Token, Authorization, Username")
+		p, err := principalFromClaims(claims)
+		if err != nil {
+			log.Println("Invalid principal: ", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
 		}
 
-		if r.Method == "OPTIONS" {
+		// an access token would otherwise outlive signing out of its session until it
+		// expires
+		active, err := app.DB.SessionActive(p.Username, p.SessionID)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		h.ServeHTTP(w, r)
+
+		next.ServeHTTP(w, r.WithContext(contextWithPrincipal(r.Context(), p)))
 	})
 }
 
-func (app *application) authCheck(next http.Handler) http.Handler {
+// apiKeyAuthCheck is authCheck for routes other systems may call, it also accepts an
+// API key as the bearer token. The key acts as its owner with their current role,
+// limited to the key's scopes, and counts as signed in with a second factor while the
+// owner has TOTP enabled.
+func (app *application) apiKeyAuthCheck(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, _, err := app.auth.GetAndVerifyHeaderToken(w, r)
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer "+apiKeyPrefix) {
+			app.authCheck(next).ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Authorization")
+
+		key, err := app.DB.GetAPIKey(strings.TrimPrefix(authHeader, "Bearer "))
+		if errors.Is(err, repository.ErrInvalidAPIKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
 		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		if !key.Active(now) {
+			log.Printf("Inactive API key %s used", key.Prefix)
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+
+		user, err := app.DB.GetUserByName(key.Username)
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+			err = app.DB.TouchAPIKey(key.ID, app.clientIP(r))
+			if err != nil {
+				log.Println("Recording API key use: ", err)
+			}
+		}
+
+		p := &principal{
+			ID:       user.ID,
+			Username: user.Username,
+			Role:     user.Role,
+			APIKey:   key,
+		}
+		if app.RequireMFA && mfaRequired(user.Role) {
+			mfa, err := app.DB.GetUserMFA(user.Username)
+			if err != nil && !errors.Is(err, repository.ErrMFANotEnrolled) {
+				app.errorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
+			p.MFA = err == nil && mfa.Enabled()
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithPrincipal(r.Context(), p)))
 	})
 }
+
+// requirePermission only lets through requests whose principal has permission perm,
+// it must run after authCheck or apiKeyAuthCheck
+func (app *application) requirePermission(perm models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := principalFromContext(r.Context())
+			if p == nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !p.can(perm) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			// staff without a second factor may only reach /me to set it up
+			if app.RequireMFA && mfaRequired(p.Role) && !p.MFA {
+				app.errorJSON(w, errors.New("two-factor authentication is required for your role"), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// aliceBookings gives alice a pending request and an approved booking and returns
+// their ids
+func aliceBookings(t *testing.T, app *application) (pending, approved int) {
+	t.Helper()
+
+	if _, err := app.DB.InsertFacility(models.Facility{Name: "Function Room", Active: true}); err != nil {
+		t.Fatalf("InsertFacility: %v", err)
+	}
+
+	day := time.Now().UTC().AddDate(0, 0, 14)
+	for i, purpose := range []string{"yoga", "birthday"} {
+		start := time.Date(day.Year(), day.Month(), day.Day(), 10+2*i, 0, 0, 0, time.UTC)
+		err := app.DB.InsertBookingRequest(models.Booking{
+			Username:   "alice",
+			Name:       "Alice",
+			UnitNumber: "12A",
+			StartDate:  start,
+			EndDate:    start.Add(time.Hour),
+			StartTime:  start.Format(time.RFC3339),
+			EndTime:    start.Add(time.Hour).Format(time.RFC3339),
+			Purpose:    purpose,
+			Facility:   "Function Room",
+		})
+		if err != nil {
+			t.Fatalf("InsertBookingRequest: %v", err)
+		}
+	}
+
+	_, _, requested, err := app.DB.UserBookings("alice")
+	if err != nil || len(requested) != 2 {
+		t.Fatalf("UserBookings = %d requests, %v, want 2", len(requested), err)
+	}
+	for _, request := range requested {
+		if request.Purpose == "yoga" {
+			pending = request.ID
+			continue
+		}
+		if err := app.DB.ApproveBookingRequest(*request); err != nil {
+			t.Fatalf("ApproveBookingRequest: %v", err)
+		}
+	}
+
+	_, bookings, _, err := app.DB.UserBookings("alice")
+	if err != nil || len(bookings) != 1 {
+		t.Fatalf("UserBookings = %d approved bookings, %v, want 1", len(bookings), err)
+	}
+	return pending, bookings[0].ID
+}
+
+func TestRoleChecks(t *testing.T) {
+	tests := []struct {
+		name string
+		// user sends the request, nobody signs in if it is empty
+		user   string
+		mfa    bool
+		method string
+		path   string
+		// body returns the payload for alice's bookings, none if nil
+		body       func(pending, approved int) interface{}
+		requireMFA bool
+		wantStatus int
+	}{
+		{name: "approve signed out", method: http.MethodPut, path: "/admin/approve-booking", body: pendingBooking, wantStatus: http.StatusUnauthorized},
+		{name: "resident approves their own request", user: "alice", method: http.MethodPut, path: "/admin/approve-booking", body: pendingBooking, wantStatus: http.StatusForbidden},
+		{name: "facility manager approves", user: "manager", method: http.MethodPut, path: "/admin/approve-booking", body: pendingBooking, wantStatus: http.StatusAccepted},
+		{name: "admin approves", user: "admin", method: http.MethodPut, path: "/admin/approve-booking", body: pendingBooking, wantStatus: http.StatusAccepted},
+		{name: "facility manager approves without TOTP", user: "manager", method: http.MethodPut, path: "/admin/approve-booking", body: pendingBooking, requireMFA: true, wantStatus: http.StatusForbidden},
+		{name: "facility manager approves with TOTP", user: "manager", mfa: true, method: http.MethodPut, path: "/admin/approve-booking", body: pendingBooking, requireMFA: true, wantStatus: http.StatusAccepted},
+		{name: "resident is not held to TOTP", user: "alice", method: http.MethodPut, path: "/admin/delete-pending", body: pendingBooking, requireMFA: true, wantStatus: http.StatusAccepted},
+
+		{name: "resident deletes their own request", user: "alice", method: http.MethodPut, path: "/admin/delete-pending", body: pendingBooking, wantStatus: http.StatusAccepted},
+		{name: "resident deletes another's request", user: "bob", method: http.MethodPut, path: "/admin/delete-pending", body: pendingBooking, wantStatus: http.StatusForbidden},
+		{name: "facility manager deletes a request", user: "manager", method: http.MethodPut, path: "/admin/delete-pending", body: pendingBooking, wantStatus: http.StatusAccepted},
+		{name: "resident deletes their own booking", user: "alice", method: http.MethodPut, path: "/admin/delete-approved", body: approvedBooking, wantStatus: http.StatusAccepted},
+		{name: "resident deletes another's booking", user: "bob", method: http.MethodPut, path: "/admin/delete-approved", body: approvedBooking, wantStatus: http.StatusForbidden},
+		{name: "admin deletes a booking", user: "admin", method: http.MethodPut, path: "/admin/delete-approved", body: approvedBooking, wantStatus: http.StatusAccepted},
+
+		{name: "resident adds a facility", user: "alice", method: http.MethodPost, path: "/admin/facilities", body: newFacility, wantStatus: http.StatusForbidden},
+		{name: "facility manager adds a facility", user: "manager", method: http.MethodPost, path: "/admin/facilities", body: newFacility, wantStatus: http.StatusForbidden},
+		{name: "admin adds a facility", user: "admin", method: http.MethodPost, path: "/admin/facilities", body: newFacility, wantStatus: http.StatusCreated},
+		{name: "resident invites", user: "alice", method: http.MethodPost, path: "/admin/invites", body: newInvite, wantStatus: http.StatusForbidden},
+		{name: "facility manager invites", user: "manager", method: http.MethodPost, path: "/admin/invites", body: newInvite, wantStatus: http.StatusForbidden},
+		{name: "admin invites", user: "admin", method: http.MethodPost, path: "/admin/invites", body: newInvite, wantStatus: http.StatusCreated},
+		{name: "facility manager promotes", user: "manager", method: http.MethodPut, path: "/admin/users/bob/role", body: promotion, wantStatus: http.StatusForbidden},
+		{name: "admin promotes", user: "admin", method: http.MethodPut, path: "/admin/users/bob/role", body: promotion, wantStatus: http.StatusOK},
+		{name: "admin promotes to admin", user: "admin", method: http.MethodPut, path: "/admin/users/bob/role", body: func(int, int) interface{} {
+			return map[string]models.Role{"role": models.RoleAdmin}
+		}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.RequireMFA = tt.requireMFA
+			users := map[string]*models.User{
+				"alice":   newTestUser(t, app, "alice", models.RoleResident),
+				"bob":     newTestUser(t, app, "bob", models.RoleResident),
+				"manager": newTestUser(t, app, "manager", models.RoleFacilityManager),
+				"admin":   newTestUser(t, app, "admin", models.RoleAdmin),
+			}
+			pending, approved := aliceBookings(t, app)
+
+			var body interface{}
+			if tt.body != nil {
+				body = tt.body(pending, approved)
+			}
+			var req *http.Request
+			if tt.user == "" {
+				req = httptest.NewRequest(tt.method, tt.path, nil)
+			} else {
+				req = authRequest(t, app, users[tt.user], tt.mfa, tt.method, tt.path, body)
+			}
+
+			rec := httptest.NewRecorder()
+			app.routes().ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, rec.Code, rec.Body, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func pendingBooking(pending, _ int) interface{} {
+	return models.RequestedBooking{ID: pending}
+}
+
+func approvedBooking(_, approved int) interface{} {
+	return models.SubmittedBooking{ID: approved}
+}
+
+func newFacility(int, int) interface{} {
+	return models.Facility{Name: "Roof Terrace"}
+}
+
+func newInvite(int, int) interface{} {
+	return map[string]string{"unit_number": "7B"}
+}
+
+func promotion(int, int) interface{} {
+	return map[string]models.Role{"role": models.RoleFacilityManager}
+}
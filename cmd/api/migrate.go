@@ -0,0 +1,83 @@
+package main
+
+import (
+	"booking-backend/internal/migrations"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: api migrate up|down|status|to N"
+
+// migrate runs the `api migrate` subcommand against the configured database
+func (app *application) migrate(args []string) error {
+	valid := len(args) == 1 && (args[0] == "up" || args[0] == "down" || args[0] == "status") ||
+		len(args) == 2 && args[0] == "to"
+	if !valid {
+		return errors.New(migrateUsage)
+	}
+
+	conn, err := app.connectToDB()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	migrator, err := migrations.New(conn, app.migrationFiles())
+	if err != nil {
+		return err
+	}
+
+	var done []int
+	switch args[0] {
+	case "up":
+		done, err = migrator.Up()
+	case "down":
+		done, err = migrator.Down()
+	case "to":
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			return fmt.Errorf("invalid migration version %q", args[1])
+		}
+		done, err = migrator.To(version)
+	case "status":
+		return printMigrationStatus(migrator)
+	}
+
+	for _, version := range done {
+		fmt.Println("migrated", version)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	fmt.Println("database is at version", version)
+
+	return nil
+}
+
+func printMigrationStatus(migrator *migrations.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notifier delivers messages to users outside the API, such as password reset links.
+// Until residents have a contact address on record the API ships with stand-ins that
+// leave the message for an admin to pass on.
+type Notifier interface {
+	SendPasswordReset(user *models.User, link string, expiresAt time.Time) error
+}
+
+// logNotifier writes messages to the server log
+type logNotifier struct{}
+
+func (logNotifier) SendPasswordReset(user *models.User, link string, expiresAt time.Time) error {
+	log.Printf("Password reset for %s (unit %s), valid until %s: %s",
+		user.Username, user.UnitNumber, expiresAt.Format(time.RFC3339), link)
+	return nil
+}
+
+// fileNotifier appends messages to a file, one per line
+type fileNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (n *fileNotifier) SendPasswordReset(user *models.User, link string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s password-reset %s unit=%s expires=%s %s\n",
+		time.Now().UTC().Format(time.RFC3339), user.Username, user.UnitNumber, expiresAt.UTC().Format(time.RFC3339), link)
+	return err
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/oidc"
+	"booking-backend/internal/repository"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// oidcLoginExpiry is how long a user has to sign in at the identity provider
+	oidcLoginExpiry = 10 * time.Minute
+	// oidcStateCookie ties a single sign-on to the browser that started it, it holds the
+	// hash of the state
+	oidcStateCookie = "oidc_state"
+	// maxUsernameAttempts is how many numbered variants of a taken username are tried
+	// for a provisioned user before a random suffix is used
+	maxUsernameAttempts = 10
+)
+
+// sso_error values the frontend receives when a single sign-on fails
+const (
+	ssoErrorDenied    = "access_denied"
+	ssoErrorExpired   = "expired"
+	ssoErrorNoAccount = "no_account"
+	ssoErrorFailed    = "failed"
+)
+
+var errSSODisabled = errors.New("single sign-on is not configured")
+
+// newOIDCProvider configures the identity provider from the -oidc flags, nil when no
+// issuer is set
+func (app *application) newOIDCProvider() (*oidc.Provider, error) {
+	if app.OIDCIssuer == "" {
+		return nil, nil
+	}
+
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       app.OIDCIssuer,
+		ClientID:     app.OIDCClientID,
+		ClientSecret: app.OIDCClientSecret,
+		RedirectURL:  app.OIDCRedirectURL,
+		Scopes:       []string{"profile", "email"},
+	})
+}
+
+// safeReturnPath only lets users be sent back to a path of the frontend, not to
+// another site
+func safeReturnPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, `\`) {
+		return "/"
+	}
+	return path
+}
+
+// oidcLogin starts a single sign-on by redirecting to the identity provider. The
+// optional return_to parameter is the frontend path the user ends up on.
+func (app *application) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.errorJSON(w, errSSODisabled, http.StatusNotFound)
+		return
+	}
+
+	login := models.OIDCLogin{
+		ReturnTo:  safeReturnPath(r.URL.Query().Get("return_to")),
+		ExpiresAt: time.Now().Add(oidcLoginExpiry),
+	}
+
+	var err error
+	for _, value := range []*string{&login.State, &login.Nonce, &login.CodeVerifier} {
+		*value, err = oidc.RandomToken()
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	authURL, err := app.oidc.AuthCodeURL(r.Context(), login.State, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		log.Println("Error contacting the identity provider: ", err)
+		app.errorJSON(w, errors.New("the identity provider is not available"), http.StatusBadGateway)
+		return
+	}
+
+	err = app.DB.InsertOIDCLogin(login)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, oidcStateCookieFor(subjectHash(login.State), oidcLoginExpiry))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallback completes a single sign-on when the identity provider redirects back.
+// The user is looked up by their subject, or provisioned as a resident, and sent to
+// the frontend with the refresh cookie set, which /refresh exchanges for an access
+// token. Failures are passed to the frontend's login page as sso_error.
+func (app *application) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.errorJSON(w, errSSODisabled, http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	ip := app.clientIP(r)
+
+	// only the browser that started the sign-on may complete it, otherwise a callback URL
+	// of someone else's sign-on would sign the user in to their account
+	http.SetCookie(w, oidcStateCookieFor("", -1))
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(subjectHash(query.Get("state")))) != 1 {
+		log.Println("Single sign-on callback without the state cookie of its browser")
+		app.ssoErrorRedirect(w, r, ssoErrorFailed)
+		return
+	}
+
+	// the state is used up whatever the outcome, so the redirect cannot be replayed
+	login, err := app.DB.TakeOIDCLogin(query.Get("state"))
+	if err != nil {
+		if !errors.Is(err, repository.ErrInvalidOIDCState) {
+			log.Println("Error looking up single sign-on: ", err)
+		}
+		app.ssoErrorRedirect(w, r, ssoErrorExpired)
+		return
+	}
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		log.Printf("Identity provider declined single sign-on: %s %s", providerErr, query.Get("error_description"))
+		app.ssoErrorRedirect(w, r, ssoErrorDenied)
+		return
+	}
+
+	tokens, err := app.oidc.Exchange(r.Context(), query.Get("code"), login.CodeVerifier)
+	if err != nil {
+		log.Println("Error exchanging single sign-on code: ", err)
+		app.ssoErrorRedirect(w, r, ssoErrorFailed)
+		return
+	}
+
+	idToken, err := app.oidc.VerifyIDToken(r.Context(), tokens.IDToken, login.Nonce)
+	if err != nil {
+		log.Println("Error verifying ID token: ", err)
+		app.ssoErrorRedirect(w, r, ssoErrorFailed)
+		return
+	}
+
+	user, err := app.identityUser(idToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			app.auditLogin(idToken.Subject, ip, models.LoginFailed)
+			app.ssoErrorRedirect(w, r, ssoErrorNoAccount)
+			return
+		}
+		log.Println("Error looking up single sign-on user: ", err)
+		app.ssoErrorRedirect(w, r, ssoErrorFailed)
+		return
+	}
+
+	// a second factor at the provider counts, otherwise users with TOTP still enter a code
+	mfa := idToken.MultiFactor()
+	if !mfa {
+		enrolment, err := app.DB.GetUserMFA(user.Username)
+		if err != nil && !errors.Is(err, repository.ErrMFANotEnrolled) {
+			log.Println("Error looking up two-factor authentication: ", err)
+			app.ssoErrorRedirect(w, r, ssoErrorFailed)
+			return
+		}
+		if enrolment != nil && enrolment.Enabled() {
+			app.auditLogin(user.Username, ip, models.LoginMFARequired)
+			app.mfaChallengeRedirect(w, r, user)
+			return
+		}
+	}
+
+	app.auditLogin(user.Username, ip, models.LoginSucceeded)
+
+	_, err = app.startSession(w, r, user, mfa)
+	if err != nil {
+		log.Println("Error starting session: ", err)
+		app.ssoErrorRedirect(w, r, ssoErrorFailed)
+		return
+	}
+
+	http.Redirect(w, r, app.Domain+login.ReturnTo, http.StatusSeeOther)
+}
+
+// identityUser returns the user linked to the subject of an ID token. Unknown subjects
+// are provisioned as residents when -oidc-auto-provision is set and the token names
+// their unit, otherwise ErrUserNotFound is returned.
+func (app *application) identityUser(idToken *oidc.IDToken) (*models.User, error) {
+	issuer := app.oidc.Issuer()
+
+	user, err := app.DB.GetUserByIdentity(issuer, idToken.Subject)
+	if err == nil || !errors.Is(err, repository.ErrUserNotFound) || !app.OIDCAutoProvision {
+		return user, err
+	}
+
+	// the unit claim stands in for the invite code a registration needs, without it
+	// anyone with an account at the provider would become a resident
+	unitNumber := strings.TrimSpace(idToken.Claim(app.OIDCUnitClaim))
+	if unitNumber == "" {
+		log.Printf("Not provisioning subject %s of %s, the ID token has no %s claim", idToken.Subject, issuer, app.OIDCUnitClaim)
+		return nil, err
+	}
+
+	base := ssoUsername(idToken)
+	for i := 1; ; i++ {
+		identity := models.UserIdentity{Issuer: issuer, Subject: idToken.Subject, Username: base}
+		switch {
+		case i > maxUsernameAttempts:
+			identity.Username = base + "-" + subjectHash(fmt.Sprint(idToken.Subject, time.Now().UnixNano()))[:6]
+		case i > 1:
+			identity.Username = fmt.Sprintf("%s-%d", base, i)
+		}
+
+		user, err = app.DB.ProvisionIdentityUser(identity, unitNumber)
+		switch {
+		case err == nil:
+			log.Printf("Provisioned %s for subject %s of %s", user.Username, idToken.Subject, issuer)
+			return user, nil
+		case errors.Is(err, repository.ErrDuplicateIdentity):
+			// a concurrent sign in of the same user provisioned them first
+			return app.DB.GetUserByIdentity(issuer, idToken.Subject)
+		case !errors.Is(err, repository.ErrDuplicateUsername) || i > maxUsernameAttempts:
+			return nil, err
+		}
+	}
+}
+
+// ssoUsername picks the username of a provisioned user from the provider's
+// preferred_username or email claims, or the subject if they are missing
+func ssoUsername(idToken *oidc.IDToken) string {
+	name := idToken.PreferredUsername
+	if name == "" && idToken.EmailVerified {
+		name, _, _ = strings.Cut(idToken.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "sso-" + subjectHash(idToken.Subject)[:12]
+	}
+	if b.Len() > 64 {
+		return b.String()[:64]
+	}
+	return b.String()
+}
+
+func subjectHash(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(sum[:])
+}
+
+// oidcStateCookieFor returns the cookie holding the hash of a sign-on's state. It is Lax
+// so the browser sends it along when the identity provider redirects back.
+func oidcStateCookieFor(stateHash string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/oidc",
+		Value:    stateHash,
+		MaxAge:   int(maxAge.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		Secure:   true,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
+	}
+	return cookie
+}
+
+// ssoErrorRedirect sends the user back to the frontend's login page with the reason the
+// single sign-on failed
+func (app *application) ssoErrorRedirect(w http.ResponseWriter, r *http.Request, reason string) {
+	http.Redirect(w, r, app.Domain+"/login?sso_error="+url.QueryEscape(reason), http.StatusSeeOther)
+}
+
+// mfaChallengeRedirect sends a user with TOTP to the frontend's login page with a
+// challenge token for /authenticate/mfa. The token is in the fragment so it is not
+// sent to any server or logged.
+func (app *application) mfaChallengeRedirect(w http.ResponseWriter, r *http.Request, user *models.User) {
+	challenge, err := app.auth.GenerateMFAChallenge(&jwtUser{
+		ID:       user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+	})
+	if err != nil {
+		log.Println("Error generating challenge: ", err)
+		app.ssoErrorRedirect(w, r, ssoErrorFailed)
+		return
+	}
+
+	http.Redirect(w, r, app.Domain+"/login#mfa_token="+url.QueryEscape(challenge), http.StatusSeeOther)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/oidc"
+	"booking-backend/internal/oidc/oidctest"
+	"booking-backend/internal/repository"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testCallbackURL is where the identity provider sends users back to the API
+const testCallbackURL = "https://api.example.com/oidc/callback"
+
+// newSSOTestApp returns a test app signing users in with a mock identity provider
+func newSSOTestApp(t *testing.T) (*application, *oidctest.Server) {
+	t.Helper()
+
+	idp := oidctest.NewServer("booking-api", "client-secret")
+	t.Cleanup(idp.Close)
+
+	app := newTestApp(t)
+	provider, err := oidc.NewProvider(oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  testCallbackURL,
+		Scopes:       []string{"profile", "email"},
+	})
+	if err != nil {
+		t.Fatalf("oidc.NewProvider: %v", err)
+	}
+	app.oidc = provider
+	app.OIDCAutoProvision = true
+	app.OIDCUnitClaim = "unit_number"
+
+	return app, idp
+}
+
+// ssoBrowser follows a single sign-on like a browser, keeping the state cookie of the
+// login it started
+type ssoBrowser struct {
+	t       *testing.T
+	handler http.Handler
+	state   *http.Cookie
+}
+
+// login starts a sign-on at /oidc/login and returns the identity provider's URL
+func (b *ssoBrowser) login(returnTo string) string {
+	b.t.Helper()
+
+	rec := httptest.NewRecorder()
+	b.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oidc/login?return_to="+url.QueryEscape(returnTo), nil))
+	if rec.Code != http.StatusFound {
+		b.t.Fatalf("GET /oidc/login = %d %s, want %d", rec.Code, rec.Body, http.StatusFound)
+	}
+
+	b.state = responseCookie(rec.Result(), oidcStateCookie)
+	if b.state == nil || b.state.Value == "" {
+		b.t.Fatalf("GET /oidc/login set cookies %v, want %s", rec.Result().Cookies(), oidcStateCookie)
+	}
+	return rec.Header().Get("Location")
+}
+
+// authorize visits the identity provider and returns the callback it redirects to
+func (b *ssoBrowser) authorize(authURL string) string {
+	b.t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		b.t.Fatalf("GET %s: %v", authURL, err)
+	}
+	res.Body.Close()
+
+	callback := res.Header.Get("Location")
+	if res.StatusCode != http.StatusFound || !strings.HasPrefix(callback, testCallbackURL+"?") {
+		b.t.Fatalf("identity provider answered %d to %s, want a redirect to %s", res.StatusCode, callback, testCallbackURL)
+	}
+	return callback
+}
+
+// callback delivers the identity provider's redirect to the API with the state cookie
+func (b *ssoBrowser) callback(callback string) *http.Response {
+	b.t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	if b.state != nil {
+		req.AddCookie(b.state)
+	}
+	rec := httptest.NewRecorder()
+	b.handler.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+// signIn runs a whole sign-on
+func (b *ssoBrowser) signIn(returnTo string) *http.Response {
+	b.t.Helper()
+	return b.callback(b.authorize(b.login(returnTo)))
+}
+
+// expectSSOError checks that a callback sent the user to the login page with reason
+// and did not sign them in
+func expectSSOError(t *testing.T, app *application, res *http.Response, reason string) {
+	t.Helper()
+
+	want := testDomain + "/login?sso_error=" + reason
+	if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != want {
+		t.Errorf("callback = %d to %q, want %d to %q", res.StatusCode, res.Header.Get("Location"), http.StatusSeeOther, want)
+	}
+	if cookie := responseCookie(res, app.auth.CookieName); cookie != nil {
+		t.Errorf("failed callback set the refresh cookie")
+	}
+}
+
+// expectSession checks that a callback signed the user in and sent them to returnTo
+func expectSession(t *testing.T, app *application, res *http.Response, returnTo string) {
+	t.Helper()
+
+	if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != testDomain+returnTo {
+		t.Fatalf("callback = %d to %q, want %d to %q", res.StatusCode, res.Header.Get("Location"), http.StatusSeeOther, testDomain+returnTo)
+	}
+	if cookie := responseCookie(res, app.auth.CookieName); cookie == nil || cookie.Value == "" {
+		t.Errorf("callback did not set the refresh cookie")
+	}
+	if cookie := responseCookie(res, oidcStateCookie); cookie == nil || cookie.MaxAge >= 0 {
+		t.Errorf("callback did not clear the %s cookie", oidcStateCookie)
+	}
+}
+
+func TestOIDCProvisioning(t *testing.T) {
+	app, idp := newSSOTestApp(t)
+	browser := &ssoBrowser{t: t, handler: app.routes()}
+	newTestUser(t, app, "alice", models.RoleResident)
+
+	// the preferred username is taken by a registered user, and then by the first
+	// provisioned user
+	for _, tt := range []struct{ subject, username string }{
+		{"subject-1", "alice-2"},
+		{"subject-2", "alice-3"},
+		{"subject-1", "alice-2"},
+	} {
+		idp.SignIn(oidctest.User{Subject: tt.subject, Claims: map[string]interface{}{
+			"preferred_username": "Alice",
+			"unit_number":        "7B",
+		}})
+		expectSession(t, app, browser.signIn("/bookings"), "/bookings")
+
+		user, err := app.DB.GetUserByIdentity(idp.Issuer(), tt.subject)
+		if err != nil {
+			t.Fatalf("GetUserByIdentity(%s): %v", tt.subject, err)
+		}
+		if user.Username != tt.username || user.UnitNumber != "7B" || user.Role != models.RoleResident {
+			t.Errorf("%s signed in as %s of unit %s with role %s, want %s of unit 7B, a resident",
+				tt.subject, user.Username, user.UnitNumber, user.Role, tt.username)
+		}
+	}
+
+	existing, err := app.DB.GetUserByName("alice")
+	if err != nil || existing.UnitNumber != "12A" {
+		t.Errorf("registered user alice = %+v, %v, want them unchanged", existing, err)
+	}
+
+	// without a unit nothing ties the subject to the building, so no account is created
+	for _, claims := range []map[string]interface{}{
+		{"preferred_username": "mallory"},
+		{"preferred_username": "mallory", "unit_number": "  "},
+	} {
+		idp.SignIn(oidctest.User{Subject: "subject-3", Claims: claims})
+		expectSSOError(t, app, browser.signIn("/bookings"), ssoErrorNoAccount)
+		if _, err := app.DB.GetUserByIdentity(idp.Issuer(), "subject-3"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("subject without a unit claim %v: GetUserByIdentity error = %v, want ErrUserNotFound", claims, err)
+		}
+	}
+}
+
+func TestOIDCWithoutProvisioning(t *testing.T) {
+	app, idp := newSSOTestApp(t)
+	app.OIDCAutoProvision = false
+	browser := &ssoBrowser{t: t, handler: app.routes()}
+
+	idp.SignIn(oidctest.User{Subject: "subject-1", Claims: map[string]interface{}{"preferred_username": "alice"}})
+	expectSSOError(t, app, browser.signIn("/"), ssoErrorNoAccount)
+
+	// a linked account signs in
+	newTestUser(t, app, "alice", models.RoleResident)
+	err := app.DB.InsertUserIdentity(models.UserIdentity{Issuer: idp.Issuer(), Subject: "subject-1", Username: "alice"})
+	if err != nil {
+		t.Fatalf("InsertUserIdentity: %v", err)
+	}
+	expectSession(t, app, browser.signIn("/"), "/")
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(claims map[string]interface{})
+	}{
+		{"nonce of another sign-on", func(claims map[string]interface{}) { claims["nonce"] = "another-nonce" }},
+		{"without nonce", func(claims map[string]interface{}) { delete(claims, "nonce") }},
+		{"wrong audience", func(claims map[string]interface{}) { claims["aud"] = "another-client" }},
+		{"wrong issuer", func(claims map[string]interface{}) { claims["iss"] = "https://idp.example.net" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, idp := newSSOTestApp(t)
+			browser := &ssoBrowser{t: t, handler: app.routes()}
+
+			idp.Tamper = tt.tamper
+			expectSSOError(t, app, browser.signIn("/"), ssoErrorFailed)
+			if _, err := app.DB.GetUserByIdentity(idp.Issuer(), "oidctest-user"); err == nil {
+				t.Errorf("the rejected ID token provisioned a user")
+			}
+		})
+	}
+}
+
+func TestOIDCDenied(t *testing.T) {
+	app, idp := newSSOTestApp(t)
+	browser := &ssoBrowser{t: t, handler: app.routes()}
+
+	idp.Deny()
+	expectSSOError(t, app, browser.signIn("/"), ssoErrorDenied)
+}
+
+func TestOIDCPKCE(t *testing.T) {
+	app, _ := newSSOTestApp(t)
+	handler := app.routes()
+	victim := &ssoBrowser{t: t, handler: handler}
+	attacker := &ssoBrowser{t: t, handler: handler}
+
+	authURL, err := url.Parse(victim.login("/"))
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	query := authURL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf("authorization URL %s has no S256 code challenge", authURL)
+	}
+
+	// a code stolen from the victim's sign-on, injected into the attacker's, is
+	// exchanged with the attacker's verifier and refused by the provider
+	stolen, err := url.Parse(victim.authorize(authURL.String()))
+	if err != nil {
+		t.Fatalf("parse callback: %v", err)
+	}
+	injected, err := url.Parse(attacker.authorize(attacker.login("/")))
+	if err != nil {
+		t.Fatalf("parse callback: %v", err)
+	}
+	q := injected.Query()
+	q.Set("code", stolen.Query().Get("code"))
+	injected.RawQuery = q.Encode()
+
+	expectSSOError(t, app, attacker.callback(injected.String()), ssoErrorFailed)
+}
+
+func TestOIDCState(t *testing.T) {
+	t.Run("replayed", func(t *testing.T) {
+		app, idp := newSSOTestApp(t)
+		idp.SignIn(oidctest.User{Subject: "subject-1", Claims: map[string]interface{}{"unit_number": "7B"}})
+		browser := &ssoBrowser{t: t, handler: app.routes()}
+
+		callback := browser.authorize(browser.login("/"))
+		expectSession(t, app, browser.callback(callback), "/")
+
+		// even with the state cookie kept, the state is used up
+		expectSSOError(t, app, browser.callback(callback), ssoErrorExpired)
+	})
+
+	t.Run("without the state cookie", func(t *testing.T) {
+		app, idp := newSSOTestApp(t)
+		idp.SignIn(oidctest.User{Subject: "subject-1", Claims: map[string]interface{}{"unit_number": "7B"}})
+		browser := &ssoBrowser{t: t, handler: app.routes()}
+
+		callback := browser.authorize(browser.login("/"))
+		state := browser.state
+		browser.state = nil
+		expectSSOError(t, app, browser.callback(callback), ssoErrorFailed)
+
+		// the sign-on is not used up by the rejected callback
+		browser.state = state
+		expectSession(t, app, browser.callback(callback), "/")
+	})
+
+	t.Run("state cookie of another sign-on", func(t *testing.T) {
+		app, _ := newSSOTestApp(t)
+		handler := app.routes()
+		victim := &ssoBrowser{t: t, handler: handler}
+		attacker := &ssoBrowser{t: t, handler: handler}
+
+		// the attacker gets the victim's browser to complete the attacker's sign-on
+		victim.login("/")
+		callback := attacker.authorize(attacker.login("/"))
+		expectSSOError(t, app, victim.callback(callback), ssoErrorFailed)
+	})
+
+	t.Run("unknown state", func(t *testing.T) {
+		app, _ := newSSOTestApp(t)
+		browser := &ssoBrowser{t: t, handler: app.routes()}
+
+		browser.state = oidcStateCookieFor(subjectHash("made-up"), oidcLoginExpiry)
+		expectSSOError(t, app, browser.callback(testCallbackURL+"?state=made-up&code=made-up"), ssoErrorExpired)
+	})
+}
+
+func TestOIDCMFAChallenge(t *testing.T) {
+	app, idp := newSSOTestApp(t)
+	browser := &ssoBrowser{t: t, handler: app.routes()}
+
+	user := newTestUser(t, app, "alice", models.RoleResident)
+	err := app.DB.InsertUserIdentity(models.UserIdentity{Issuer: idp.Issuer(), Subject: "subject-1", Username: "alice"})
+	if err != nil {
+		t.Fatalf("InsertUserIdentity: %v", err)
+	}
+	if err := app.DB.BeginMFAEnrolment("alice", "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("BeginMFAEnrolment: %v", err)
+	}
+	if err := app.DB.EnableMFA("alice", 1, []string{"recovery-code"}); err != nil {
+		t.Fatalf("EnableMFA: %v", err)
+	}
+
+	// a password at the provider is not enough for a user with TOTP
+	idp.SignIn(oidctest.User{Subject: "subject-1", Claims: map[string]interface{}{"amr": []string{"pwd"}}})
+	res := browser.signIn("/bookings")
+
+	location := res.Header.Get("Location")
+	prefix := testDomain + "/login#mfa_token="
+	if res.StatusCode != http.StatusSeeOther || !strings.HasPrefix(location, prefix) {
+		t.Fatalf("callback = %d to %q, want %d to %s...", res.StatusCode, location, http.StatusSeeOther, prefix)
+	}
+	if cookie := responseCookie(res, app.auth.CookieName); cookie != nil {
+		t.Errorf("callback set the refresh cookie before the second factor")
+	}
+
+	challenge, err := url.QueryUnescape(strings.TrimPrefix(location, prefix))
+	if err != nil {
+		t.Fatalf("unescape challenge: %v", err)
+	}
+	claims, err := app.auth.mfaVerifier().Verify(challenge, tokenTypeMFAChallenge)
+	if err != nil {
+		t.Fatalf("verify challenge: %v", err)
+	}
+	if claims.Username != "alice" || claims.Subject != strconv.Itoa(user.ID) {
+		t.Errorf("challenge is for %s (subject %s), want alice (subject %d)", claims.Username, claims.Subject, user.ID)
+	}
+	if _, err := app.auth.verifier().Verify(challenge, tokenTypeAccess); err == nil {
+		t.Errorf("the MFA challenge is accepted as an access token")
+	}
+
+	// a second factor at the provider counts
+	idp.SignIn(oidctest.User{Subject: "subject-1", Claims: map[string]interface{}{"amr": []string{"pwd", "mfa"}}})
+	expectSession(t, app, browser.signIn("/bookings"), "/bookings")
+}
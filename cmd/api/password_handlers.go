@@ -0,0 +1,214 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/passwords"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// resetExpiry is how long a password reset token can be used
+const resetExpiry = time.Hour
+
+// newResetToken returns a random password reset token
+func newResetToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashNewPassword checks a new password against the password policy and hashes it
+// with the configured bcrypt cost. username may be empty when it is not known.
+func (app *application) hashNewPassword(password, username string) (string, error) {
+	err := app.PasswordPolicy.Check(password, username)
+	if err != nil {
+		return "", err
+	}
+	return passwords.Hash(password, app.BcryptCost)
+}
+
+// passwordErrorJSON answers 422 with the failed rule for passwords the policy rejects
+func (app *application) passwordErrorJSON(w http.ResponseWriter, err error) error {
+	var policyErr *passwords.PolicyError
+	if errors.As(err, &policyErr) {
+		payload := JSONResponse{
+			Error:   true,
+			Message: policyErr.Error(),
+			Data:    policyErr,
+		}
+		return app.writeJSON(w, http.StatusUnprocessableEntity, payload)
+	}
+	return app.errorJSON(w, err, http.StatusInternalServerError)
+}
+
+// rehashPassword replaces a password hash made with a lower bcrypt cost than the
+// configured one, after the user signed in with the password. Failures only delay the
+// upgrade to the next sign in.
+func (app *application) rehashPassword(user *models.User, password string) {
+	if !passwords.NeedsRehash(user.Password, app.BcryptCost) {
+		return
+	}
+
+	hash, err := passwords.Hash(password, app.BcryptCost)
+	if err == nil {
+		err = app.DB.RehashPassword(user.Username, hash)
+	}
+	if err != nil {
+		log.Println("Error rehashing password: ", err)
+	}
+}
+
+// forgotPassword sends a password reset link to the user. The response is the same
+// whether or not the username exists, so it cannot be used to find accounts.
+func (app *application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Username string `json:"username"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if payload.Username == "" {
+		app.errorJSON(w, errors.New("username is required"))
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "If the account exists, a password reset link has been sent",
+	}
+
+	user, err := app.DB.GetUserByName(payload.Username)
+	if err != nil {
+		_ = app.writeJSON(w, http.StatusAccepted, resp)
+		return
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	reset := models.PasswordReset{
+		Token:     token,
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(resetExpiry),
+	}
+	err = app.DB.InsertPasswordReset(reset)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	link := app.Domain + "/reset-password?token=" + url.QueryEscape(token)
+	err = app.notifier.SendPasswordReset(user, link, reset.ExpiresAt)
+	if err != nil {
+		log.Println("Error sending password reset: ", err)
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, resp)
+}
+
+// resetPassword sets a new password with a reset token, signing the user out of every session
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if payload.Token == "" || payload.Password == "" {
+		app.errorJSON(w, errors.New("token and password are required"))
+		return
+	}
+
+	// the reset token is only looked up with the new password, the username is unknown here
+	passwordHash, err := app.hashNewPassword(payload.Password, "")
+	if err != nil {
+		app.passwordErrorJSON(w, err)
+		return
+	}
+
+	err = app.DB.ResetPassword(payload.Token, passwordHash)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Password reset, please sign in again",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
+
+// ChangePassword sets a new password for the signed in user after checking the current
+// one. Every other session is signed out, the caller receives a new token pair.
+func (app *application) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if payload.CurrentPassword == "" || payload.NewPassword == "" {
+		app.errorJSON(w, errors.New("current and new password are required"))
+		return
+	}
+
+	p := principalFromContext(r.Context())
+	user, err := app.DB.GetUserByName(p.Username)
+	if err != nil {
+		app.errorJSON(w, errors.New("unknown user"), http.StatusUnauthorized)
+		return
+	}
+
+	valid, err := user.PasswordMatches(payload.CurrentPassword)
+	if err != nil || !valid {
+		app.errorJSON(w, errors.New("current password is incorrect"), http.StatusForbidden)
+		return
+	}
+
+	passwordHash, err := app.hashNewPassword(payload.NewPassword, user.Username)
+	if err != nil {
+		app.passwordErrorJSON(w, err)
+		return
+	}
+
+	err = app.DB.UpdatePassword(user.Username, passwordHash)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	tokens, err := app.startSession(w, r, user, p.MFA)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, tokens)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"booking-backend/internal/models"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -17,24 +18,72 @@ func (app *application) routes() http.Handler {
 
 	// application logs when panic with backtraces
 	mux.Use(middleware.Recoverer)
-	mux.Use(app.enableCORS)
+	mux.Use(app.cors.Handler)
 
 	mux.Get("/", app.Home)
+	mux.Get("/.well-known/jwks.json", app.JWKS)
 	mux.Post("/authenticate", app.authenticate)
+	mux.Post("/authenticate/mfa", app.authenticateMFA)
 	mux.Post("/register", app.register)
-	mux.Get("/refresh", app.refreshToken)
-	mux.Get("/logout", app.logout)
+	mux.Get("/csrf", app.csrfToken)
+	mux.With(app.csrfCheck).Post("/refresh", app.refreshToken)
+	mux.With(app.csrfCheck).Post("/logout", app.logout)
+	mux.Post("/password/forgot", app.forgotPassword)
+	mux.Post("/password/reset", app.resetPassword)
+	mux.Get("/oidc/login", app.oidcLogin)
+	mux.Get("/oidc/callback", app.oidcCallback)
+	mux.Get("/facilities", app.AllFacilities)
+	mux.Get("/facilities/{id}", app.GetFacility)
 
-	mux.Route("/admin", func(mux chi.Router) {
+	mux.Route("/me", func(mux chi.Router) {
 		mux.Use(app.authCheck)
 
-		mux.Put("/add-booking", app.InsertBooking)
-		mux.Put("/approve-booking", app.ApproveBooking)
-		mux.Get("/booking-management", app.BookingManagement)
-		mux.Put("/delete-pending", app.DeletePending)
-		mux.Put("/delete-approved", app.DeleteApproved)
-		mux.Put("/delete-recurring", app.DeleteRecurring)
+		mux.Put("/password", app.ChangePassword)
+		mux.Get("/sessions", app.UserSessions)
+		mux.Delete("/sessions", app.RevokeAllSessions)
+		mux.Delete("/sessions/{id}", app.RevokeSession)
+		mux.Get("/mfa", app.MFAStatus)
+		mux.Post("/mfa/totp", app.BeginMFAEnrolment)
+		mux.Post("/mfa/totp/verify", app.EnableMFA)
+		mux.Delete("/mfa/totp", app.DisableMFA)
+	})
+
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Use(app.apiKeyAuthCheck)
+
+		// handlers of bookings owned by a user check that the principal may access them
+		mux.With(app.requirePermission(models.PermRequestBooking)).Put("/add-booking", app.InsertBooking)
+		mux.With(app.requirePermission(models.PermApproveBookings)).Put("/approve-booking", app.ApproveBooking)
+		mux.With(app.requirePermission(models.PermManageOwnBookings)).Get("/booking-management", app.BookingManagement)
+		mux.With(app.requirePermission(models.PermManageOwnBookings)).Put("/delete-pending", app.DeletePending)
+		mux.With(app.requirePermission(models.PermManageOwnBookings)).Put("/delete-approved", app.DeleteApproved)
+		mux.With(app.requirePermission(models.PermManageOwnBookings)).Put("/delete-recurring", app.DeleteRecurring)
+		mux.With(app.requirePermission(models.PermManageOwnBookings)).Get("/series/{id}", app.GetBookingSeries)
+		mux.With(app.requirePermission(models.PermManageOwnBookings)).Put("/series/{id}/cancel", app.CancelBookingSeries)
+		mux.With(app.requirePermission(models.PermManageOwnBookings)).Put("/series/{id}/occurrences/{occurrenceID}", app.UpdateSeriesOccurrence)
+		mux.With(app.requirePermission(models.PermManageOwnBookings)).Put("/series/{id}/occurrences/{occurrenceID}/cancel", app.CancelSeriesOccurrence)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.requirePermission(models.PermManageFacilities))
+
+			mux.Get("/facilities", app.AdminFacilities)
+			mux.Post("/facilities", app.InsertFacility)
+			mux.Put("/facilities/{id}", app.UpdateFacility)
+			mux.Put("/facilities/{id}/archive", app.ArchiveFacility)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.requirePermission(models.PermManageUsers))
 
+			mux.Post("/invites", app.InsertInviteCode)
+			mux.Put("/users/{username}/role", app.UpdateUserRole)
+			mux.Put("/users/{username}/unlock", app.UnlockUser)
+			mux.Get("/users/{username}/sessions", app.AdminUserSessions)
+			mux.Delete("/users/{username}/sessions", app.ForceLogout)
+			mux.Get("/api-keys", app.AllAPIKeys)
+			mux.Post("/api-keys", app.InsertAPIKey)
+			mux.Delete("/api-keys/{id}", app.RevokeAPIKey)
+		})
 	})
 
 	return mux
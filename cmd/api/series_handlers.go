@@ -0,0 +1,150 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetBookingSeries returns a recurring booking series with all its occurrences
+func (app *application) GetBookingSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid series id"))
+		return
+	}
+
+	series, err := app.DB.GetBookingSeries(id)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	if !app.authorizeOwner(w, r, series.Username, models.PermViewAllBookings) {
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, series)
+}
+
+// seriesChange reads an occurrence change from the request body and the URL
+func (app *application) seriesChange(w http.ResponseWriter, r *http.Request) (models.OccurrenceChange, error) {
+	var change models.OccurrenceChange
+
+	seriesID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return change, errors.New("invalid series id")
+	}
+
+	occurrenceID, err := strconv.Atoi(chi.URLParam(r, "occurrenceID"))
+	if err != nil {
+		return change, errors.New("invalid occurrence id")
+	}
+
+	err = app.readJSON(w, r, &change)
+	if err != nil {
+		return change, err
+	}
+
+	change.SeriesID = seriesID
+	change.OccurrenceID = occurrenceID
+
+	return change, nil
+}
+
+// authorizeSeries answers 404 or 403 and returns false unless the request's principal
+// may change the series
+func (app *application) authorizeSeries(w http.ResponseWriter, r *http.Request, id int) bool {
+	series, err := app.DB.GetBookingSeries(id)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return false
+	}
+	return app.authorizeOwner(w, r, series.Username, models.PermManageAllBookings)
+}
+
+// UpdateSeriesOccurrence moves an occurrence, the following ones or the whole series
+func (app *application) UpdateSeriesOccurrence(w http.ResponseWriter, r *http.Request) {
+	change, err := app.seriesChange(w, r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if !app.authorizeSeries(w, r, change.SeriesID) {
+		return
+	}
+
+	// moved occurrences are written to the approved bookings, which would skip approval,
+	// so only staff who approve bookings themselves may change their time or length.
+	// Residents may still change the purpose.
+	if (change.StartTime != "" || change.EndTime != "") && !principalFromContext(r.Context()).can(models.PermManageAllBookings) {
+		app.errorJSON(w, errors.New("moving approved bookings needs approval, cancel them and request a new booking instead"), http.StatusForbidden)
+		return
+	}
+
+	err = app.DB.UpdateSeriesOccurrence(change)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Booking series updated",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
+
+// CancelSeriesOccurrence cancels an occurrence, the following ones or the whole series
+func (app *application) CancelSeriesOccurrence(w http.ResponseWriter, r *http.Request) {
+	change, err := app.seriesChange(w, r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if !app.authorizeSeries(w, r, change.SeriesID) {
+		return
+	}
+
+	err = app.DB.CancelSeriesOccurrence(change)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Booking series cancelled",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
+
+// CancelBookingSeries cancels a series with all its occurrences
+func (app *application) CancelBookingSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid series id"))
+		return
+	}
+
+	if !app.authorizeSeries(w, r, id) {
+		return
+	}
+
+	err = app.DB.DeleteBookingSeries(id)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Booking series cancelled",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestSeries approves a weekly series of four occurrences for username, starting
+// at 19:00 in two weeks
+func newTestSeries(t *testing.T, app *application, username string) *models.BookingSeries {
+	t.Helper()
+
+	if _, err := app.DB.InsertFacility(models.Facility{Name: "Function Room", Active: true}); err != nil {
+		t.Fatalf("InsertFacility: %v", err)
+	}
+
+	day := time.Now().UTC().AddDate(0, 0, 14)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 19, 0, 0, 0, time.UTC)
+	err := app.DB.InsertBookingRequest(models.Booking{
+		Username:   username,
+		Name:       "Resident " + username,
+		UnitNumber: "12A",
+		StartDate:  start,
+		EndDate:    start.Add(time.Hour),
+		StartTime:  start.Format(time.RFC3339),
+		EndTime:    start.Add(time.Hour).Format(time.RFC3339),
+		Purpose:    "yoga",
+		Facility:   "Function Room",
+		Recurring:  true,
+		RRule:      "FREQ=WEEKLY;COUNT=4",
+	})
+	if err != nil {
+		t.Fatalf("InsertBookingRequest: %v", err)
+	}
+
+	_, _, requested, err := app.DB.UserBookings(username)
+	if err != nil || len(requested) != 1 {
+		t.Fatalf("UserBookings = %d requests, %v", len(requested), err)
+	}
+	if _, err := app.DB.ApproveRecurringBookingRequest(*requested[0], false); err != nil {
+		t.Fatalf("ApproveRecurringBookingRequest: %v", err)
+	}
+
+	recurring, _, _, err := app.DB.UserBookings(username)
+	if err != nil || len(recurring) != 4 {
+		t.Fatalf("UserBookings = %d occurrences, %v", len(recurring), err)
+	}
+	series, err := app.DB.GetBookingSeries(*recurring[0].SeriesID)
+	if err != nil {
+		t.Fatalf("GetBookingSeries: %v", err)
+	}
+	return series
+}
+
+func TestUpdateSeriesOccurrence(t *testing.T) {
+	tests := []struct {
+		name  string
+		role  models.Role
+		scope string
+		// move shifts the occurrences by an hour, otherwise only the purpose changes
+		move   bool
+		status int
+	}{
+		{"resident moves one", models.RoleResident, models.ScopeThis, true, http.StatusForbidden},
+		{"resident moves the following", models.RoleResident, models.ScopeFollowing, true, http.StatusForbidden},
+		{"resident moves all", models.RoleResident, models.ScopeAll, true, http.StatusForbidden},
+		{"resident renames all", models.RoleResident, models.ScopeAll, false, http.StatusOK},
+		{"resident renames one", models.RoleResident, models.ScopeThis, false, http.StatusOK},
+		{"facility manager moves all", models.RoleFacilityManager, models.ScopeAll, true, http.StatusOK},
+		{"admin moves one", models.RoleAdmin, models.ScopeThis, true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			resident := newTestUser(t, app, "alice", models.RoleResident)
+			actor := resident
+			if tt.role != models.RoleResident {
+				actor = newTestUser(t, app, "staff", tt.role)
+			}
+			series := newTestSeries(t, app, "alice")
+			occurrence := series.Occurrences[1]
+
+			change := map[string]string{"scope": tt.scope, "purpose": "pilates"}
+			start, err := time.Parse(time.RFC3339, occurrence.StartTime)
+			if err != nil {
+				t.Fatalf("parse start: %v", err)
+			}
+			if tt.move {
+				change["start_time"] = start.Add(time.Hour).Format(time.RFC3339)
+				change["end_time"] = start.Add(2 * time.Hour).Format(time.RFC3339)
+			}
+
+			path := fmt.Sprintf("/admin/series/%d/occurrences/%d", series.ID, occurrence.ID)
+			rec := httptest.NewRecorder()
+			app.routes().ServeHTTP(rec, authRequest(t, app, actor, true, http.MethodPut, path, change))
+			if rec.Code != tt.status {
+				t.Fatalf("PUT %s = %d %s, want %d", path, rec.Code, rec.Body, tt.status)
+			}
+
+			updated, err := app.DB.GetBookingSeries(series.ID)
+			if err != nil {
+				t.Fatalf("GetBookingSeries: %v", err)
+			}
+			got, err := time.Parse(time.RFC3339, updated.Occurrences[1].StartTime)
+			if err != nil {
+				t.Fatalf("parse start: %v", err)
+			}
+			if moved := !got.Equal(start); moved != (tt.move && tt.status == http.StatusOK) {
+				t.Errorf("occurrence starts at %s after the change, it started at %s", got, start)
+			}
+			if tt.status == http.StatusOK && updated.Occurrences[1].Purpose != "pilates" {
+				t.Errorf("occurrence purpose = %q, want pilates", updated.Occurrences[1].Purpose)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// userAgentBrowsers and userAgentSystems name the client in a User-Agent header, the
+// first match wins so more specific tokens come first
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+var userAgentSystems = []struct{ token, name string }{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// describeDevice summarises a User-Agent header for the session list, e.g.
+// "Firefox on Windows"
+func describeDevice(userAgent string) string {
+	browser := ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
+
+// sessionsJSON writes the active sessions of a user, marking the one of the principal
+func (app *application) sessionsJSON(w http.ResponseWriter, p *principal, username string) {
+	sessions, err := app.DB.UserSessions(username)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	for _, session := range sessions {
+		session.Device = describeDevice(session.UserAgent)
+		session.Current = username == p.Username && session.ID != "" && session.ID == p.SessionID
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, sessions)
+}
+
+// UserSessions lists the devices the signed in user is signed in on
+func (app *application) UserSessions(w http.ResponseWriter, r *http.Request) {
+	p := principalFromContext(r.Context())
+	app.sessionsJSON(w, p, p.Username)
+}
+
+// RevokeSession signs the user out of one of their sessions. Ending the current
+// session also expires the refresh and CSRF cookies, like logout.
+func (app *application) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	p := principalFromContext(r.Context())
+	sessionID := chi.URLParam(r, "id")
+
+	err := app.DB.RevokeSession(p.Username, sessionID)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	if sessionID == p.SessionID {
+		http.SetCookie(w, app.auth.GetExpiredRefreshCookie())
+		http.SetCookie(w, app.auth.GetExpiredCSRFCookie())
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Signed out of the session",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
+
+// RevokeAllSessions signs the user out everywhere, or with ?keep_current=true
+// everywhere except the device making the request
+func (app *application) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	p := principalFromContext(r.Context())
+
+	keep := ""
+	if r.URL.Query().Get("keep_current") == "true" {
+		if p.SessionID == "" {
+			app.errorJSON(w, errors.New("the current session is not known, please sign in again"))
+			return
+		}
+		keep = p.SessionID
+	}
+
+	err := app.DB.RevokeUserSessions(p.Username, keep)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	if keep == "" {
+		http.SetCookie(w, app.auth.GetExpiredRefreshCookie())
+		http.SetCookie(w, app.auth.GetExpiredCSRFCookie())
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Signed out of all sessions",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
+
+// managedUser looks up the user named in the URL and answers 404 or 403 unless the
+// principal may act on their account
+func (app *application) managedUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	p := principalFromContext(r.Context())
+	username := chi.URLParam(r, "username")
+
+	user, err := app.DB.GetUserByName(username)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if user.Username != p.Username && !p.Role.CanManage(user.Role) {
+		app.errorJSON(w, errors.New("you are not allowed to manage this user"), http.StatusForbidden)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// AdminUserSessions lists the sessions of a user for an admin
+func (app *application) AdminUserSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.managedUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.sessionsJSON(w, principalFromContext(r.Context()), user.Username)
+}
+
+// ForceLogout ends every session of a user. Their access tokens are rejected from the
+// next request on.
+func (app *application) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.managedUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.DB.RevokeUserSessions(user.Username, "")
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+	log.Printf("Sessions of %s ended by %s", user.Username, principalFromContext(r.Context()).Username)
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "User signed out of all sessions",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
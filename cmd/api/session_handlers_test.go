@@ -0,0 +1,110 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// currentSession returns the id of the session the access token of req belongs to
+func currentSession(t *testing.T, app *application, req *http.Request) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	app.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /me/sessions = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var sessions []models.Session
+	if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("decode sessions: %v", err)
+	}
+	for _, session := range sessions {
+		if session.Current {
+			return session.ID
+		}
+	}
+	t.Fatalf("sessions %+v, want a current one", sessions)
+	return ""
+}
+
+func TestRevokedSessionRejectsAccessToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// revoke returns the request ending session, the one of alice's access token
+		revoke func(t *testing.T, app *application, token, session string) *http.Request
+		// expiresCookies is whether the response signs the requesting device out
+		expiresCookies bool
+	}{
+		{
+			name: "revoke the session",
+			revoke: func(t *testing.T, app *application, token, session string) *http.Request {
+				alice, _ := app.DB.GetUserByName("alice")
+				return authRequest(t, app, alice, false, http.MethodDelete, "/me/sessions/"+session, nil)
+			},
+		},
+		{
+			name: "revoke the current session",
+			revoke: func(t *testing.T, app *application, token, session string) *http.Request {
+				req := httptest.NewRequest(http.MethodDelete, "/me/sessions/"+session, nil)
+				req.Header.Set("Authorization", token)
+				return req
+			},
+			expiresCookies: true,
+		},
+		{
+			name: "revoke all sessions",
+			revoke: func(t *testing.T, app *application, token, session string) *http.Request {
+				alice, _ := app.DB.GetUserByName("alice")
+				return authRequest(t, app, alice, false, http.MethodDelete, "/me/sessions", nil)
+			},
+			expiresCookies: true,
+		},
+		{
+			name: "admin signs the user out",
+			revoke: func(t *testing.T, app *application, token, session string) *http.Request {
+				admin := newTestUser(t, app, "root", models.RoleAdmin)
+				return authRequest(t, app, admin, true, http.MethodDelete, "/admin/users/alice/sessions", nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			alice := newTestUser(t, app, "alice", models.RoleResident)
+			token := authRequest(t, app, alice, false, http.MethodGet, "/me/sessions", nil).Header.Get("Authorization")
+			get := func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/me/sessions", nil)
+				req.Header.Set("Authorization", token)
+				return req
+			}
+			session := currentSession(t, app, get())
+
+			req := tt.revoke(t, app, token, session)
+			rec := httptest.NewRecorder()
+			app.routes().ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s %s = %d, want %d: %s", req.Method, req.URL.Path, rec.Code, http.StatusOK, rec.Body)
+			}
+
+			res := rec.Result()
+			for _, name := range []string{app.auth.CookieName, app.auth.CSRFCookieName} {
+				cookie := responseCookie(res, name)
+				expired := cookie != nil && cookie.MaxAge < 0
+				if expired != tt.expiresCookies {
+					t.Errorf("%s cookie %v, want it expired: %v", name, cookie, tt.expiresCookies)
+				}
+			}
+
+			rec = httptest.NewRecorder()
+			app.routes().ServeHTTP(rec, get())
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("access token of the ended session = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loginLimit slows down password guessing for one username or IP address. Past
+// FreeAttempts, every failure doubles the wait before the next attempt, and LockAfter
+// failures lock the key for LockFor.
+type loginLimit struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// LockAfter is the number of failures that locks the key, 0 never locks it
+	LockAfter int
+	LockFor   time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// userLoginLimit applies to each username, whether or not it exists, so locking does
+// not reveal which accounts do
+var userLoginLimit = loginLimit{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     5 * time.Minute,
+	LockAfter:    10,
+	LockFor:      15 * time.Minute,
+	Window:       time.Hour,
+}
+
+// ipLoginLimit applies to each client IP address. Residents of a building may share
+// one, so it allows more attempts and never locks.
+var ipLoginLimit = loginLimit{
+	FreeAttempts: 20,
+	BaseDelay:    time.Second,
+	MaxDelay:     15 * time.Minute,
+	Window:       time.Hour,
+}
+
+func userThrottleKey(username string) string {
+	return "user:" + username
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// retryAfter returns how long the key has to wait before its next attempt, 0 if it
+// may try now
+func (l loginLimit) retryAfter(throttle *models.LoginThrottle, now time.Time) time.Duration {
+	if throttle.LockedUntil != nil && now.Before(*throttle.LockedUntil) {
+		return throttle.LockedUntil.Sub(now)
+	}
+	if throttle.Failures <= l.FreeAttempts || now.Sub(throttle.LastFailureAt) >= l.Window {
+		return 0
+	}
+
+	delay := l.MaxDelay
+	if doublings := throttle.Failures - l.FreeAttempts - 1; doublings < 30 {
+		delay = l.BaseDelay << doublings
+	}
+	if delay > l.MaxDelay {
+		delay = l.MaxDelay
+	}
+
+	wait := throttle.LastFailureAt.Add(delay).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// clientIP returns the address of the client. With -proxy-headers the connection comes
+// from a router such as Heroku's, which appends the client's address to X-Forwarded-For;
+// without it the header is ignored, since clients could set it to anything.
+func (app *application) clientIP(r *http.Request) string {
+	if app.ProxyHeaders {
+		forwarded := r.Header.Get("X-Forwarded-For")
+		if forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginAttempt is a sign in attempt that has been counted as a failure of its username
+// and address before its password or code is checked. Counting first means parallel
+// attempts each see the ones before them, instead of all passing a check made before
+// any of them failed.
+type loginAttempt struct {
+	username     string
+	ip           string
+	userFailures int
+}
+
+// reserveLogin counts an attempt for username from ip. It returns how long the attempt
+// has to wait, the longer of the waits of the username and of the address; attempts that
+// have to wait are not counted.
+func (app *application) reserveLogin(username, ip string, now time.Time) (*loginAttempt, time.Duration, error) {
+	attempt := &loginAttempt{username: username, ip: ip}
+
+	userThrottle, wait, err := app.reserveLoginKey(userThrottleKey(username), userLoginLimit, now)
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+	attempt.userFailures = userThrottle.Failures
+
+	_, wait, err = app.reserveLoginKey(ipThrottleKey(ip), ipLoginLimit, now)
+	if err != nil || wait > 0 {
+		app.returnLoginFailure(userThrottleKey(username))
+		return nil, wait, err
+	}
+
+	return attempt, 0, nil
+}
+
+// reserveLoginKey counts an attempt against key unless it has to wait. The wait is
+// decided on the throttle as it was just before the count: when the count skipped
+// ahead, other attempts were counted in between, the last of them just now.
+func (app *application) reserveLoginKey(key string, limit loginLimit, now time.Time) (*models.LoginThrottle, time.Duration, error) {
+	before, err := app.DB.GetLoginThrottle(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if wait := limit.retryAfter(before, now); wait > 0 {
+		return nil, wait, nil
+	}
+
+	throttle, err := app.DB.RecordLoginFailure(key, limit.Window)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	previous := *throttle
+	previous.Failures--
+	if previous.Failures == before.Failures {
+		previous.LastFailureAt = before.LastFailureAt
+	}
+	if wait := limit.retryAfter(&previous, now); wait > 0 {
+		app.returnLoginFailure(key)
+		return nil, wait, nil
+	}
+
+	return throttle, 0, nil
+}
+
+// returnLoginFailure takes back an attempt counted against key, failures to do so are
+// only logged
+func (app *application) returnLoginFailure(key string) {
+	err := app.DB.ReturnLoginFailure(key)
+	if err != nil {
+		log.Println("Error taking back sign in failure: ", err)
+	}
+}
+
+// loginFailed keeps the attempt counted, locking the username once it reaches the limit
+func (app *application) loginFailed(a *loginAttempt, now time.Time) error {
+	if userLoginLimit.LockAfter > 0 && a.userFailures >= userLoginLimit.LockAfter {
+		return app.DB.LockLogin(userThrottleKey(a.username), now.Add(userLoginLimit.LockFor))
+	}
+	return nil
+}
+
+// returnLogin takes the attempt back when it was not a failure: the password was right
+// but a second factor is still due, or the attempt could not be checked
+func (app *application) returnLogin(a *loginAttempt) {
+	app.returnLoginFailure(userThrottleKey(a.username))
+	app.returnLoginFailure(ipThrottleKey(a.ip))
+}
+
+// loginSucceeded forgets the failures of the username and takes the attempt back from
+// the address
+func (app *application) loginSucceeded(a *loginAttempt) {
+	err := app.DB.ClearLoginThrottle(userThrottleKey(a.username))
+	if err != nil {
+		log.Println("Error clearing sign in failures: ", err)
+	}
+	app.returnLoginFailure(ipThrottleKey(a.ip))
+}
+
+// tooManyAttemptsJSON answers 429 with the seconds to wait in Retry-After
+func (app *application) tooManyAttemptsJSON(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	app.errorJSON(w, errors.New("too many failed sign in attempts, try again later"), http.StatusTooManyRequests)
+}
+
+// auditLogin adds a sign in attempt to the audit trail, failures to record it are only logged
+func (app *application) auditLogin(username, ip, outcome string) {
+	err := app.DB.RecordLoginAttempt(models.LoginAttempt{
+		Username:  username,
+		IPAddress: ip,
+		Outcome:   outcome,
+	})
+	if err != nil {
+		log.Println("Error recording sign in attempt: ", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// parallelAttempts posts the payloads to path at the same time and counts the answers
+// by status
+func parallelAttempts(t *testing.T, app *application, path string, payloads []interface{}) map[int]int {
+	t.Helper()
+
+	handler := app.routes()
+	statuses := make(chan int, len(payloads))
+	var wg sync.WaitGroup
+	for _, payload := range payloads {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			statuses <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	return counts
+}
+
+// expectThrottled checks that of the parallel attempts no more were checked than
+// sequential ones could have been, and that the checked ones are all that was counted
+func expectThrottled(t *testing.T, app *application, counts map[int]int, attempts int) {
+	t.Helper()
+
+	checked := counts[http.StatusBadRequest]
+	if checked > userLoginLimit.FreeAttempts+1 || checked+counts[http.StatusTooManyRequests] != attempts {
+		t.Fatalf("answers = %v, want at most %d checked and the rest throttled", counts, userLoginLimit.FreeAttempts+1)
+	}
+
+	throttle, err := app.DB.GetLoginThrottle(userThrottleKey("alice"))
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if throttle.Failures != checked {
+		t.Errorf("failures of alice = %d, want the %d checked attempts", throttle.Failures, checked)
+	}
+}
+
+func TestParallelSignInsAreThrottled(t *testing.T) {
+	const attempts = 12
+
+	t.Run("password", func(t *testing.T) {
+		app := newTestApp(t)
+		newTestUser(t, app, "alice", models.RoleResident)
+
+		payloads := make([]interface{}, attempts)
+		for i := range payloads {
+			payloads[i] = map[string]string{"username": "alice", "password": "wrong"}
+		}
+		expectThrottled(t, app, parallelAttempts(t, app, "/authenticate", payloads), attempts)
+	})
+
+	t.Run("second factor", func(t *testing.T) {
+		app := newTestApp(t)
+		user := newTestUser(t, app, "alice", models.RoleResident)
+		if err := app.DB.BeginMFAEnrolment("alice", "JBSWY3DPEHPK3PXP"); err != nil {
+			t.Fatalf("BeginMFAEnrolment: %v", err)
+		}
+		if err := app.DB.EnableMFA("alice", 1, []string{"recovery-code"}); err != nil {
+			t.Fatalf("EnableMFA: %v", err)
+		}
+		challenge, err := app.auth.GenerateMFAChallenge(&jwtUser{ID: user.ID, Username: user.Username, Role: user.Role})
+		if err != nil {
+			t.Fatalf("GenerateMFAChallenge: %v", err)
+		}
+
+		payloads := make([]interface{}, attempts)
+		for i := range payloads {
+			payloads[i] = map[string]string{"mfa_token": challenge, "recovery_code": "wrong-code"}
+		}
+		expectThrottled(t, app, parallelAttempts(t, app, "/authenticate/mfa", payloads), attempts)
+	})
+}
+
+func TestSignInReturnsCountedAttempt(t *testing.T) {
+	app := newTestApp(t)
+	newTestUser(t, app, "alice", models.RoleResident)
+	handler := app.routes()
+
+	signIn := func(password string) int {
+		body, _ := json.Marshal(map[string]string{"username": "alice", "password": password})
+		req := httptest.NewRequest(http.MethodPost, "/authenticate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if status := signIn("wrong"); status != http.StatusBadRequest {
+		t.Fatalf("wrong password = %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := signIn("correct horse battery staple"); status != http.StatusAccepted {
+		t.Fatalf("right password = %d, want %d", status, http.StatusAccepted)
+	}
+
+	// the success forgets the failures of the username and does not count against the address
+	throttle, err := app.DB.GetLoginThrottle(userThrottleKey("alice"))
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if throttle.Failures != 0 {
+		t.Errorf("failures of alice after signing in = %d, want 0", throttle.Failures)
+	}
+	throttle, err = app.DB.GetLoginThrottle(ipThrottleKey("192.0.2.1"))
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if throttle.Failures != 1 {
+		t.Errorf("failures of the address after signing in = %d, want the 1 wrong password", throttle.Failures)
+	}
+
+	// a locked username is answered without checking the password
+	if _, err := app.DB.RecordLoginFailure(userThrottleKey("alice"), time.Hour); err != nil {
+		t.Fatalf("RecordLoginFailure: %v", err)
+	}
+	if err := app.DB.LockLogin(userThrottleKey("alice"), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("LockLogin: %v", err)
+	}
+	if status := signIn("correct horse battery staple"); status != http.StatusTooManyRequests {
+		t.Errorf("locked username = %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// inviteExpiry is how long a new invite code can be used to register
+const inviteExpiry = time.Hour * 24 * 7
+
+// newInviteCode returns a random code that is easy to read out or type, e.g. 7KQ2-M4XD-PZ9A-3WHE
+func newInviteCode() (string, error) {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := base32.StdEncoding.EncodeToString(b)
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// InsertInviteCode creates a single-use invite code tying a new account to a unit number
+func (app *application) InsertInviteCode(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		UnitNumber string `json:"unit_number"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	unitNumber := strings.TrimSpace(payload.UnitNumber)
+	if unitNumber == "" {
+		app.errorJSON(w, errors.New("unit number is required"))
+		return
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	invite := models.InviteCode{
+		Code:       code,
+		UnitNumber: unitNumber,
+		CreatedBy:  principalFromContext(r.Context()).Username,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(inviteExpiry),
+	}
+
+	invite.ID, err = app.DB.InsertInviteCode(invite)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	// the code is only ever shown here, the database keeps its hash
+	resp := JSONResponse{
+		Error:   false,
+		Message: "Invite code created",
+		Data:    invite,
+	}
+
+	_ = app.writeJSON(w, http.StatusCreated, resp)
+}
+
+// UpdateUserRole promotes or demotes a user. Admins manage the roles below their own,
+// nobody can change their own role.
+func (app *application) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Role models.Role `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if !payload.Role.Valid() {
+		app.errorJSON(w, errors.New("unknown role"))
+		return
+	}
+
+	p := principalFromContext(r.Context())
+	username := chi.URLParam(r, "username")
+	if username == p.Username {
+		app.errorJSON(w, errors.New("you cannot change your own role"), http.StatusForbidden)
+		return
+	}
+
+	user, err := app.DB.GetUserByName(username)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !p.Role.CanAssign(user.Role, payload.Role) {
+		app.errorJSON(w, errors.New("you are not allowed to assign this role"), http.StatusForbidden)
+		return
+	}
+
+	err = app.DB.UpdateUserRole(username, payload.Role)
+	if err != nil {
+		app.repoErrorJSON(w, err)
+		return
+	}
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "User role updated",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
+
+// UnlockUser lifts the sign in lock of a user and forgets their failed attempts
+func (app *application) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	_, err := app.DB.GetUserByName(username)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.DB.ClearLoginThrottle(userThrottleKey(username))
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Sign in for %s unlocked by %s", username, principalFromContext(r.Context()).Username)
+
+	resp := JSONResponse{
+		Error:   false,
+		Message: "User unlocked",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, resp)
+}
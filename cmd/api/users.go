@@ -0,0 +1,76 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const usersUsage = "usage: api users invite UNIT_NUMBER | api users role USERNAME ROLE | api users link USERNAME SUBJECT"
+
+// users runs the `api users` subcommand, which bootstraps accounts before anyone can
+// sign in as an admin: invite the first residents and promote one of them
+func (app *application) users(args []string) error {
+	valid := len(args) == 2 && args[0] == "invite" || len(args) == 3 && (args[0] == "role" || args[0] == "link")
+	if !valid {
+		return errors.New(usersUsage)
+	}
+	if args[0] == "link" && app.OIDCIssuer == "" {
+		return errors.New("linking an identity needs the -oidc-issuer it belongs to")
+	}
+
+	conn, err := app.connectToDB()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	repo := app.newDBRepo(conn)
+
+	switch args[0] {
+	case "invite":
+		code, err := newInviteCode()
+		if err != nil {
+			return err
+		}
+
+		invite := models.InviteCode{
+			Code:       code,
+			UnitNumber: args[1],
+			ExpiresAt:  time.Now().Add(inviteExpiry),
+		}
+		_, err = repo.InsertInviteCode(invite)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("invite code for %s: %s (valid until %s)\n", invite.UnitNumber, code, invite.ExpiresAt.Format(time.RFC3339))
+	case "role":
+		role := models.Role(args[2])
+		if !role.Valid() {
+			return fmt.Errorf("unknown role %q", args[2])
+		}
+
+		err = repo.UpdateUserRole(args[1], role)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s is now %s\n", args[1], role)
+	case "link":
+		// existing residents keep their account when they start signing in with the provider
+		err = repo.InsertUserIdentity(models.UserIdentity{
+			Issuer:   app.OIDCIssuer,
+			Subject:  args[2],
+			Username: args[1],
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s signs in as %s of %s\n", args[1], args[2], app.OIDCIssuer)
+	}
+
+	return nil
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
 	"net/http"
 )
 
@@ -68,4 +71,62 @@ func (app *application) errorJSON(w http.ResponseWriter, err error, status ...in
 	payload.Message = err.Error()
 
 	return app.writeJSON(w, statusCode, payload)
-}
\ No newline at end of file
+}
+
+// repoErrorJSON writes errors coming back from the repository, mapping typed errors
+// to a status code and attaching their details so the frontend can display them. Other
+// errors are logged and answered with a generic 500, their text may name tables or
+// constraints.
+func (app *application) repoErrorJSON(w http.ResponseWriter, err error) error {
+	var conflictErr *repository.ConflictError
+	if errors.As(err, &conflictErr) {
+		payload := JSONResponse{
+			Error:   true,
+			Message: conflictErr.Error(),
+			Data:    conflictErr.Conflict,
+		}
+		return app.writeJSON(w, http.StatusConflict, payload)
+	}
+
+	var ruleErr *models.RuleViolation
+	if errors.As(err, &ruleErr) {
+		payload := JSONResponse{
+			Error:   true,
+			Message: ruleErr.Error(),
+			Data:    ruleErr,
+		}
+		return app.writeJSON(w, http.StatusUnprocessableEntity, payload)
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrFacilityNotFound),
+		errors.Is(err, repository.ErrBookingRequestNotFound),
+		errors.Is(err, repository.ErrBookingNotFound),
+		errors.Is(err, repository.ErrBookingSeriesNotFound),
+		errors.Is(err, repository.ErrOccurrenceNotFound),
+		errors.Is(err, repository.ErrUserNotFound),
+		errors.Is(err, repository.ErrMFANotEnrolled),
+		errors.Is(err, repository.ErrSessionNotFound),
+		errors.Is(err, repository.ErrAPIKeyNotFound):
+		return app.errorJSON(w, err, http.StatusNotFound)
+	case errors.Is(err, repository.ErrDuplicateFacility),
+		errors.Is(err, repository.ErrDuplicateUsername),
+		errors.Is(err, repository.ErrDuplicateIdentity),
+		errors.Is(err, repository.ErrMFAAlreadyEnabled):
+		return app.errorJSON(w, err, http.StatusConflict)
+	case errors.Is(err, repository.ErrFacilityArchived),
+		errors.Is(err, repository.ErrInvalidInviteCode),
+		errors.Is(err, repository.ErrInvalidResetToken),
+		errors.Is(err, repository.ErrTOTPCodeReused),
+		errors.Is(err, repository.ErrInvalidRecoveryCode):
+		return app.errorJSON(w, err)
+	}
+
+	var inputErr *repository.InvalidInputError
+	if errors.As(err, &inputErr) {
+		return app.errorJSON(w, err)
+	}
+
+	log.Println("Error from the repository: ", err)
+	return app.errorJSON(w, errors.New("internal server error"), http.StatusInternalServerError)
+}
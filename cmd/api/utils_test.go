@@ -0,0 +1,51 @@
+package main
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRepoErrorJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantMessage string
+	}{
+		{"not found", repository.ErrBookingNotFound, http.StatusNotFound, repository.ErrBookingNotFound.Error()},
+		{"wrapped not found", fmt.Errorf("approve: %w", repository.ErrBookingRequestNotFound), http.StatusNotFound, "approve: booking request not found"},
+		{"duplicate", repository.ErrDuplicateFacility, http.StatusConflict, repository.ErrDuplicateFacility.Error()},
+		{"overlap", &repository.ConflictError{Conflict: models.BookingConflict{Kind: "approved", BookingID: 7, Facility: "Gym"}}, http.StatusConflict, ""},
+		{"rule violation", &models.RuleViolation{Rule: "max_length", Message: "too long"}, http.StatusUnprocessableEntity, ""},
+		{"invalid input", repository.InvalidInput(errors.New("invalid start time")), http.StatusBadRequest, "invalid start time"},
+		{"used invite", repository.ErrInvalidInviteCode, http.StatusBadRequest, repository.ErrInvalidInviteCode.Error()},
+		{"database failure", errors.New(`pq: duplicate key value violates unique constraint "users_pkey"`), http.StatusInternalServerError, "internal server error"},
+	}
+
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if err := app.repoErrorJSON(rec, tt.err); err != nil {
+				t.Fatalf("repoErrorJSON: %v", err)
+			}
+
+			var resp JSONResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if rec.Code != tt.wantStatus || !resp.Error {
+				t.Errorf("status = %d (error %v), want %d", rec.Code, resp.Error, tt.wantStatus)
+			}
+			if tt.wantMessage != "" && resp.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", resp.Message, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// token types, carried in the typ claim so a token issued for one purpose cannot be
+// presented for another. Refresh tokens are opaque random strings, not JWTs.
+const (
+	tokenTypeAccess       = "access"
+	tokenTypeMFAChallenge = "mfa_challenge"
+)
+
+// defaultLeeway is the clock skew tolerated between the servers issuing and verifying tokens
+const defaultLeeway = 30 * time.Second
+
+var (
+	errTokenMalformed   = errors.New("malformed token")
+	errTokenSignature   = errors.New("invalid token signature")
+	errTokenExpired     = errors.New("expired token")
+	errTokenNotValidYet = errors.New("token is not valid yet")
+	errTokenIssuedLater = errors.New("token is issued in the future")
+	errTokenIssuer      = errors.New("invalid issuer")
+	errTokenAudience    = errors.New("invalid audience")
+	errTokenType        = errors.New("invalid token type")
+	errTokenSubject     = errors.New("token has no subject")
+)
+
+// TokenVerifier checks the signature and the claims of the JWTs the API issues.
+// exp, iat, iss, aud, sub and typ are required, nbf is checked when present.
+type TokenVerifier struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew for exp, nbf and iat
+	Leeway time.Duration
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+}
+
+func (v *TokenVerifier) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+// Verify parses a token of the given type and returns its claims
+func (v *TokenVerifier) Verify(token string, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+
+	// the claims are validated below with leeway, the parser only checks the signature
+	// and that the algorithm is one the key set signs with
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithoutClaimsValidation(),
+	)
+	_, err := parser.ParseWithClaims(token, claims, v.Keys.Keyfunc)
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorMalformed != 0 {
+			return nil, errTokenMalformed
+		}
+		return nil, fmt.Errorf("%w: %v", errTokenSignature, err)
+	}
+
+	err = v.validate(claims, tokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *TokenVerifier) validate(claims *Claims, tokenType string) error {
+	now := v.now()
+
+	if claims.ExpiresAt == nil || !now.Before(claims.ExpiresAt.Add(v.Leeway)) {
+		return errTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(v.Leeway).Before(claims.NotBefore.Time) {
+		return errTokenNotValidYet
+	}
+	if claims.IssuedAt == nil || now.Add(v.Leeway).Before(claims.IssuedAt.Time) {
+		return errTokenIssuedLater
+	}
+
+	if claims.Issuer != v.Issuer {
+		return errTokenIssuer
+	}
+	if !claims.VerifyAudience(v.Audience, true) {
+		return errTokenAudience
+	}
+	if claims.Type != tokenType {
+		return errTokenType
+	}
+	if claims.Subject == "" {
+		return errTokenSubject
+	}
+
+	return nil
+}
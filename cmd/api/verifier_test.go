@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// testKeySet loads an RSA key, which signs, and an Ed25519 key from files the way
+// LoadKeySet reads them in production. It also returns the private keys and the PEM
+// of the RSA public key, which anyone can fetch from the JWKS.
+func testKeySet(t *testing.T) (*KeySet, *rsa.PrivateKey, ed25519.PrivateKey, []byte) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+
+	dir := t.TempDir()
+	for kid, key := range map[string]interface{}{"rsa": rsaKey, "ed": edKey} {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("marshal %s key: %v", kid, err)
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+			t.Fatalf("write %s key: %v", kid, err)
+		}
+	}
+
+	keys, err := LoadKeySet(dir, "rsa")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal RSA public key: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	return keys, rsaKey, edKey, publicPEM
+}
+
+// signToken signs claims with any method and kid, unlike KeySet.Sign
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims *Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign %s token: %v", method.Alg(), err)
+	}
+	return signed
+}
+
+func TestTokenVerifier(t *testing.T) {
+	keys, rsaKey, edKey, publicPEM := testKeySet(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	verifier := &TokenVerifier{
+		Keys:     keys,
+		Issuer:   "booking-api",
+		Audience: "booking-frontend",
+		Leeway:   defaultLeeway,
+		Now:      func() time.Time { return now },
+	}
+
+	// validClaims are the claims GenerateAccessToken issues, tests change one of them
+	validClaims := func() *Claims {
+		return &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "booking-api",
+				Subject:   "42",
+				Audience:  jwt.ClaimStrings{"booking-frontend"},
+				IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+				NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+				ExpiresAt: jwt.NewNumericDate(now.Add(14 * time.Minute)),
+			},
+			Username: "alice",
+			Role:     "resident",
+			Type:     tokenTypeAccess,
+			AMR:      []string{amrPassword},
+		}
+	}
+	signed := func(claims *Claims) string {
+		token, err := keys.Sign(claims)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return token
+	}
+	withClaims := func(change func(c *Claims)) string {
+		claims := validClaims()
+		change(claims)
+		return signed(claims)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("sign none token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+		// principalErr is set for tokens that verify but do not name a user
+		principalErr bool
+	}{
+		{name: "valid", token: signed(validClaims())},
+		{name: "valid EdDSA from a key that no longer signs", token: signToken(t, jwt.SigningMethodEdDSA, "ed", edKey, validClaims())},
+
+		{name: "expired", token: withClaims(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }), err: errTokenExpired},
+		{name: "expired within the leeway", token: withClaims(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) })},
+		{name: "without exp", token: withClaims(func(c *Claims) { c.ExpiresAt = nil }), err: errTokenExpired},
+
+		{name: "nbf in the future", token: withClaims(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }), err: errTokenNotValidYet},
+		{name: "nbf within the leeway", token: withClaims(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second)) })},
+		{name: "without nbf", token: withClaims(func(c *Claims) { c.NotBefore = nil })},
+
+		{name: "iat beyond the leeway", token: withClaims(func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) }), err: errTokenIssuedLater},
+		{name: "iat within the leeway", token: withClaims(func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(10 * time.Second)) })},
+		{name: "without iat", token: withClaims(func(c *Claims) { c.IssuedAt = nil }), err: errTokenIssuedLater},
+
+		{name: "wrong iss", token: withClaims(func(c *Claims) { c.Issuer = "someone-else" }), err: errTokenIssuer},
+		{name: "without iss", token: withClaims(func(c *Claims) { c.Issuer = "" }), err: errTokenIssuer},
+		{name: "wrong aud", token: withClaims(func(c *Claims) { c.Audience = jwt.ClaimStrings{"another-service"} }), err: errTokenAudience},
+		{name: "MFA challenge aud", token: withClaims(func(c *Claims) { c.Audience = jwt.ClaimStrings{"booking-frontend/mfa"} }), err: errTokenAudience},
+		{name: "without aud", token: withClaims(func(c *Claims) { c.Audience = nil }), err: errTokenAudience},
+		{name: "one of several aud", token: withClaims(func(c *Claims) { c.Audience = jwt.ClaimStrings{"another-service", "booking-frontend"} })},
+
+		{name: "wrong typ", token: withClaims(func(c *Claims) { c.Type = tokenTypeMFAChallenge }), err: errTokenType},
+		{name: "without typ", token: withClaims(func(c *Claims) { c.Type = "" }), err: errTokenType},
+
+		{name: "without sub", token: withClaims(func(c *Claims) { c.Subject = "" }), err: errTokenSubject},
+		{name: "non-numeric sub", token: withClaims(func(c *Claims) { c.Subject = "alice" }), principalErr: true},
+
+		{name: "alg none", token: unsigned, err: errTokenSignature},
+		{name: "alg none with a kid", token: signToken(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, validClaims()), err: errTokenSignature},
+		{name: "HS256 keyed with the RSA public key", token: signToken(t, jwt.SigningMethodHS256, "rsa", publicPEM, validClaims()), err: errTokenSignature},
+		{name: "EdDSA under the kid of the RSA key", token: signToken(t, jwt.SigningMethodEdDSA, "rsa", edKey, validClaims()), err: errTokenSignature},
+		{name: "RS384", token: signToken(t, jwt.SigningMethodRS384, "rsa", rsaKey, validClaims()), err: errTokenSignature},
+		{name: "unknown kid", token: signToken(t, jwt.SigningMethodRS256, "retired", rsaKey, validClaims()), err: errTokenSignature},
+		{name: "without kid", token: signToken(t, jwt.SigningMethodRS256, "", rsaKey, validClaims()), err: errTokenSignature},
+		{name: "signed by another key", token: signToken(t, jwt.SigningMethodRS256, "rsa", otherKey, validClaims()), err: errTokenSignature},
+
+		{name: "empty", token: "", err: errTokenMalformed},
+		{name: "not a JWT", token: "not-a-token", err: errTokenMalformed},
+		{name: "two segments", token: "eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiI0MiJ9", err: errTokenMalformed},
+		{name: "header not base64", token: "!!!.eyJzdWIiOiI0MiJ9.c2ln", err: errTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token, tokenTypeAccess)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				if claims != nil {
+					t.Errorf("Verify() returned claims %+v with error %v", claims, err)
+				}
+				return
+			}
+
+			// authCheck only lets the token through if its subject is a user id
+			p, err := principalFromClaims(claims)
+			if tt.principalErr {
+				if err == nil {
+					t.Errorf("principalFromClaims() = %+v, want an error", p)
+				}
+				return
+			}
+			if err != nil || p.ID != 42 || p.Username != "alice" {
+				t.Errorf("principalFromClaims() = %+v, %v, want user 42 alice", p, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Package cors answers cross-origin requests from browsers (the Fetch standard's
+// CORS protocol) according to a configured policy.
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults are the methods and headers the frontend uses
+var (
+	DefaultMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	DefaultHeaders = []string{"Accept", "Content-Type", "X-CSRF-Token", "Authorization"}
+	DefaultMaxAge  = 10 * time.Minute
+)
+
+// Config describes which origins may call the API from a browser and how
+type Config struct {
+	// AllowedOrigins are origins such as https://app.example.com. An origin of the form
+	// https://*.example.com allows every subdomain of example.com with that scheme and
+	// port, but not example.com itself, and * allows every origin.
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders may be requested in preflights, * in
+	// AllowedHeaders allows any header
+	AllowedMethods []string
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache a preflight, browsers cap it themselves
+	MaxAge time.Duration
+	// AllowCredentials lets the origins send cookies, it cannot be combined with *
+	AllowCredentials bool
+}
+
+// originPattern is an allowed origin, for wildcards host is the part after "*."
+type originPattern struct {
+	scheme   string
+	host     string
+	wildcard bool
+}
+
+// Policy is a validated Config
+type Policy struct {
+	config    Config
+	anyOrigin bool
+	origins   map[string]bool
+	patterns  []originPattern
+	methods   map[string]bool
+	headers   map[string]bool
+	anyHeader bool
+	maxAge    string
+}
+
+// New validates config and returns its policy
+func New(config Config) (*Policy, error) {
+	p := &Policy{
+		config:  config,
+		origins: map[string]bool{},
+		methods: map[string]bool{},
+		headers: map[string]bool{},
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+
+		pattern, err := parseOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+		if pattern.wildcard {
+			p.patterns = append(p.patterns, pattern)
+		} else {
+			p.origins[pattern.scheme+"://"+pattern.host] = true
+		}
+	}
+	if p.anyOrigin && config.AllowCredentials {
+		return nil, errors.New("cors: the * origin cannot be combined with credentials")
+	}
+
+	for _, method := range config.AllowedMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method != "" {
+			p.methods[method] = true
+		}
+	}
+	for _, header := range config.AllowedHeaders {
+		header = strings.TrimSpace(header)
+		if header == "*" {
+			p.anyHeader = true
+		} else if header != "" {
+			p.headers[http.CanonicalHeaderKey(header)] = true
+		}
+	}
+
+	if config.MaxAge < 0 {
+		return nil, errors.New("cors: max age cannot be negative")
+	}
+	p.maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return p, nil
+}
+
+// parseOrigin checks that origin is a scheme and host, with an optional port and
+// *. in front of the host
+func parseOrigin(origin string) (originPattern, error) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.User != nil ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return originPattern{}, fmt.Errorf("cors: invalid origin %q, expected scheme://host[:port]", origin)
+	}
+
+	pattern := originPattern{scheme: strings.ToLower(u.Scheme), host: strings.ToLower(u.Host)}
+	if strings.HasPrefix(pattern.host, "*.") {
+		pattern.wildcard = true
+		pattern.host = strings.TrimPrefix(pattern.host, "*.")
+	}
+	if strings.Contains(pattern.host, "*") || pattern.host == "" {
+		return originPattern{}, fmt.Errorf("cors: invalid origin %q, * is only allowed as the first label", origin)
+	}
+
+	return pattern, nil
+}
+
+// AllowOrigin reports whether the policy lets origin make cross-origin requests
+func (p *Policy) AllowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	if p.origins[scheme+"://"+host] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if scheme == pattern.scheme && strings.HasSuffix(host, "."+pattern.host) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowCredentials reports whether allowed origins may send cookies
+func (p *Policy) AllowCredentials() bool {
+	return p.config.AllowCredentials
+}
+
+// allowHeaders reports whether every header of an Access-Control-Request-Headers
+// list is allowed
+func (p *Policy) allowHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !p.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin sets the headers every response to an allowed origin carries
+func (p *Policy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.config.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// Handler answers preflights with 204, or 403 when the origin, method or headers are
+// not allowed, and adds the CORS headers to the responses of next
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+
+		if r.Method == http.MethodOptions && requestedMethod != "" {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+			if !p.AllowOrigin(origin) || !p.methods[strings.ToUpper(requestedMethod)] || !p.allowHeaders(requestedHeaders) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			p.setOrigin(h, origin)
+			h.Set("Access-Control-Allow-Methods", strings.ToUpper(requestedMethod))
+			if requestedHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", requestedHeaders)
+			}
+			h.Set("Access-Control-Max-Age", p.maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// responses differ by origin unless every origin gets the same *
+		if !p.anyOrigin {
+			w.Header().Add("Vary", "Origin")
+		}
+		if p.AllowOrigin(origin) {
+			p.setOrigin(w.Header(), origin)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,235 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"any origin with credentials", Config{AllowedOrigins: []string{"*"}, AllowCredentials: true}},
+		{"origin without a scheme", Config{AllowedOrigins: []string{"app.example.com"}}},
+		{"origin with a path", Config{AllowedOrigins: []string{"https://app.example.com/bookings"}}},
+		{"wildcard inside the host", Config{AllowedOrigins: []string{"https://app.*.example.com"}}},
+		{"negative max age", Config{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: -time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.config); err == nil {
+				t.Errorf("New(%+v) succeeded, want an error", tt.config)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	policy, err := New(Config{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.tenants.example.com"},
+		AllowedMethods:   DefaultMethods,
+		AllowedHeaders:   DefaultHeaders,
+		MaxAge:           DefaultMaxAge,
+		AllowCredentials: true,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	wildcard, err := New(Config{AllowedOrigins: []string{"https://*.example.com"}, AllowedMethods: DefaultMethods})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	anyOrigin, err := New(Config{AllowedOrigins: []string{"*"}, AllowedMethods: DefaultMethods})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		policy  *Policy
+		method  string
+		headers map[string]string
+		// wantStatus is the status of the response, 200 when the request reached the handler
+		wantStatus  int
+		wantOrigin  string
+		wantCreds   bool
+		wantMaxAge  string
+		wantHeaders string
+		wantVary    []string
+	}{
+		{
+			name:       "allowed origin",
+			policy:     policy,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://app.example.com",
+			wantCreds:  true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "subdomain of a wildcard",
+			policy:     policy,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://block-b.tenants.example.com"},
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://block-b.tenants.example.com",
+			wantCreds:  true,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "denied origin reaches the handler without CORS headers",
+			policy:     policy,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://evil.test"},
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "other scheme",
+			policy:     policy,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "http://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "lookalike of a wildcard",
+			policy:     wildcard,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://evil-example.com"},
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "wildcard does not cover the domain itself",
+			policy:     wildcard,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://example.com"},
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "wildcard without credentials",
+			policy:     wildcard,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://app.example.com",
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "any origin does not vary",
+			policy:     anyOrigin,
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://anywhere.test"},
+			wantStatus: http.StatusOK,
+			wantOrigin: "*",
+		},
+		{
+			name:   "preflight",
+			policy: policy,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "content-type, x-csrf-token",
+			},
+			wantStatus:  http.StatusNoContent,
+			wantOrigin:  "https://app.example.com",
+			wantCreds:   true,
+			wantMaxAge:  "600",
+			wantHeaders: "content-type, x-csrf-token",
+			wantVary:    []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:   "preflight from a denied origin",
+			policy: policy,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://evil-example.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			wantStatus: http.StatusForbidden,
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:   "preflight for a method that is not allowed",
+			policy: policy,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "TRACE",
+			},
+			wantStatus: http.StatusForbidden,
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:   "preflight for a header that is not allowed",
+			policy: policy,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "X-Debug",
+			},
+			wantStatus: http.StatusForbidden,
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:       "OPTIONS without a requested method is not a preflight",
+			policy:     policy,
+			method:     http.MethodOptions,
+			headers:    map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://app.example.com",
+			wantCreds:  true,
+			wantVary:   []string{"Origin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.policy.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(tt.method, "/bookings", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			h := rec.Header()
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want it set: %v", h.Get("Access-Control-Allow-Credentials"), tt.wantCreds)
+			}
+			if got := h.Get("Access-Control-Max-Age"); got != tt.wantMaxAge {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", got, tt.wantMaxAge)
+			}
+			if got := h.Get("Access-Control-Allow-Headers"); got != tt.wantHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.wantHeaders)
+			}
+			if got := h.Values("Vary"); !reflect.DeepEqual(got, tt.wantVary) {
+				t.Errorf("Vary = %q, want %q", got, tt.wantVary)
+			}
+			if tt.wantStatus == http.StatusNoContent {
+				if got := h.Get("Access-Control-Allow-Methods"); got != tt.headers["Access-Control-Request-Method"] {
+					t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.headers["Access-Control-Request-Method"])
+				}
+			}
+		})
+	}
+}
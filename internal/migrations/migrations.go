@@ -0,0 +1,325 @@
+// Package migrations applies the numbered SQL migrations embedded in the binary.
+//
+// Each migration is a pair of files NNNN_name.up.sql and NNNN_name.down.sql.
+// Applied versions are recorded in the schema_migrations table, and every
+// migration runs in its own transaction together with that bookkeeping.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var (
+	// Postgres holds the migrations for the Postgres schema
+	Postgres, _ = fs.Sub(files, "postgres")
+
+	// SQLite holds the same migrations written for SQLite, version for version
+	SQLite, _ = fs.Sub(files, "sqlite")
+)
+
+const migrationTimeout = time.Minute
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes a migration and whether it has been applied
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// New loads the migrations found in files
+func New(db *sql.DB, files fs.FS) (*Migrator, error) {
+	migrations, err := Load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Load reads NNNN_name.up.sql / NNNN_name.down.sql pairs from files, ordered by version
+func Load(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || path.Ext(fileName) != ".sql" {
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+		if direction != ".up" && direction != ".down" {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", fileName)
+		}
+
+		number, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a positive version number", fileName)
+		}
+
+		contents, err := fs.ReadFile(files, fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, name)
+		}
+
+		if direction == ".up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// ensureTable creates the schema_migrations table if it does not exist yet
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	return err
+}
+
+// applied returns the time each applied version was applied at
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	err := m.ensureTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// Version returns the highest applied version, 0 for an empty database
+func (m *Migrator) Version() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+
+	return version, nil
+}
+
+// Status lists every known migration and when it was applied
+func (m *Migrator) Status() ([]Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration and returns the versions it applied
+func (m *Migrator) Up() ([]int, error) {
+	if len(m.Migrations) == 0 {
+		return nil, nil
+	}
+	return m.To(m.Migrations[len(m.Migrations)-1].Version)
+}
+
+// Down reverts the most recently applied migration
+func (m *Migrator) Down() ([]int, error) {
+	current, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	if current == 0 {
+		return nil, nil
+	}
+
+	target := 0
+	for _, migration := range m.Migrations {
+		if migration.Version < current {
+			target = migration.Version
+		}
+	}
+
+	return m.To(target)
+}
+
+// To migrates up or down until version is the latest applied migration.
+// It returns the versions it applied or reverted, in order.
+func (m *Migrator) To(version int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	if version != 0 && m.find(version) == nil {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for v := range applied {
+		if m.find(v) == nil {
+			return nil, fmt.Errorf("database has migration %d applied which this binary does not know about", v)
+		}
+	}
+
+	var done []int
+
+	// apply pending migrations up to the target in ascending order
+	for _, migration := range m.Migrations {
+		if migration.Version > version {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.run(ctx, migration.Up,
+			`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+		if err != nil {
+			return done, fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration.Version)
+	}
+
+	// revert applied migrations above the target in descending order
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if migration.Version <= version {
+			break
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err := m.run(ctx, migration.Down,
+			`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		if err != nil {
+			return done, fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration.Version)
+	}
+
+	return done, nil
+}
+
+// run executes a migration script and its bookkeeping statement in one transaction
+func (m *Migrator) run(ctx context.Context, script string, bookkeeping string, args ...interface{}) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, bookkeeping, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.Migrations {
+		if m.Migrations[i].Version == version {
+			return &m.Migrations[i]
+		}
+	}
+	return nil
+}
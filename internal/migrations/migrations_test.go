@@ -0,0 +1,171 @@
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema describes every table with its columns and foreign keys, and every
+// index and trigger, apart from the bookkeeping table. It reads the structure rather
+// than the stored CREATE statements, which SQLite rewrites when tables are renamed.
+func sqliteSchema(t *testing.T, db *sql.DB) string {
+	objects, err := queryStrings(db, `
+		SELECT type || ' ' || name || ' ON ' || tbl_name FROM sqlite_master
+		WHERE name != 'schema_migrations' AND name NOT LIKE 'sqlite_%'
+		ORDER BY type, name
+	`)
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+
+	var schema []string
+	for _, object := range objects {
+		schema = append(schema, object)
+
+		fields := strings.Fields(object)
+		switch fields[0] {
+		case "table":
+			columns, err := queryStrings(db, `
+				SELECT name || ' ' || type || ' ' || "notnull" || ' ' || COALESCE(dflt_value, 'NULL') || ' ' || pk
+				FROM pragma_table_info(?) ORDER BY cid
+			`, fields[1])
+			if err != nil {
+				t.Fatalf("read columns of %s: %v", fields[1], err)
+			}
+			keys, err := queryStrings(db, `
+				SELECT "from" || ' REFERENCES ' || "table" || ' (' || COALESCE("to", '') || ') ON DELETE ' || on_delete
+				FROM pragma_foreign_key_list(?) ORDER BY id, seq
+			`, fields[1])
+			if err != nil {
+				t.Fatalf("read foreign keys of %s: %v", fields[1], err)
+			}
+			schema = append(append(schema, columns...), keys...)
+		case "index":
+			columns, err := queryStrings(db, `SELECT COALESCE(name, '<expression>') FROM pragma_index_info(?) ORDER BY seqno`, fields[1])
+			if err != nil {
+				t.Fatalf("read columns of %s: %v", fields[1], err)
+			}
+			schema = append(schema, "  ("+strings.Join(columns, ", ")+")")
+		}
+	}
+
+	return strings.Join(schema, "\n")
+}
+
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// SQLite cannot add a NOT NULL column without a default, so once 0007_user_roles is
+// reverted users.is_admin keeps a DEFAULT FALSE that 0001 did not give it
+const userRolesVersion = 7
+
+var userRolesRevertedSchema = strings.NewReplacer("is_admin BOOLEAN 1 NULL 0", "is_admin BOOLEAN 1 FALSE 0")
+
+func TestSQLiteRoundTrip(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "booking.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	m, err := New(db, SQLite)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+
+	// record the schema after each migration on the way up
+	schemas := map[int]string{0: ""}
+	for _, migration := range m.Migrations {
+		if _, err := m.To(migration.Version); err != nil {
+			t.Fatalf("To(%d): %v", migration.Version, err)
+		}
+		schemas[migration.Version] = sqliteSchema(t, db)
+	}
+	latest := m.Migrations[len(m.Migrations)-1].Version
+
+	// every down migration restores the schema its up migration started from
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		reverted, err := m.Down()
+		if err != nil {
+			t.Fatalf("reverting %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		if len(reverted) != 1 || reverted[0] != migration.Version {
+			t.Fatalf("Down() reverted %v, want [%d]", reverted, migration.Version)
+		}
+
+		previous := 0
+		if i > 0 {
+			previous = m.Migrations[i-1].Version
+		}
+		want := schemas[previous]
+		if previous < userRolesVersion {
+			want = userRolesRevertedSchema.Replace(want)
+		}
+		if got := sqliteSchema(t, db); got != want {
+			t.Errorf("reverting %d_%s changed the schema it started from:\n%s", migration.Version, migration.Name, schemaDiff(got, want))
+		}
+	}
+
+	if version, err := m.Version(); err != nil || version != 0 {
+		t.Fatalf("Version() = %d, %v after reverting everything, want 0", version, err)
+	}
+
+	// and the migrations apply again on top of the reverted database
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatalf("Up() after reverting: %v", err)
+	}
+	if len(applied) != len(m.Migrations) {
+		t.Errorf("Up() applied %v, want all %d migrations", applied, len(m.Migrations))
+	}
+	if got := sqliteSchema(t, db); got != schemas[latest] {
+		t.Errorf("migrating down and up again changed the schema:\n%s", schemaDiff(got, schemas[latest]))
+	}
+}
+
+// schemaDiff lists the lines only got has with +, and those only want has with -
+func schemaDiff(got, want string) string {
+	count := map[string]int{}
+	for _, line := range strings.Split(want, "\n") {
+		count[line]--
+	}
+	for _, line := range strings.Split(got, "\n") {
+		count[line]++
+	}
+
+	var diff []string
+	for _, line := range strings.Split(got+"\n"+want, "\n") {
+		switch n := count[line]; {
+		case n > 0:
+			diff = append(diff, "+ "+line)
+			count[line]--
+		case n < 0:
+			diff = append(diff, "- "+line)
+			count[line]++
+		}
+	}
+
+	return strings.Join(diff, "\n")
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS recurringbookings;
+DROP TABLE IF EXISTS approvedbookings;
+DROP TABLE IF EXISTS requestedbookings;
+DROP TABLE IF EXISTS users;
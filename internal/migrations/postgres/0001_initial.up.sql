@@ -0,0 +1,50 @@
+-- Baseline schema. Tables are created only if missing so databases initialised
+-- from the old create_tables.sql dump can adopt the migrations in place.
+
+CREATE TABLE IF NOT EXISTS users (
+  id SERIAL PRIMARY KEY,
+  username VARCHAR(255) NOT NULL UNIQUE,
+  password VARCHAR(255) NOT NULL,
+  is_admin BOOLEAN NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS requestedbookings (
+  id SERIAL PRIMARY KEY,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMPTZ NOT NULL,
+  end_time TIMESTAMPTZ NOT NULL,
+  purpose TEXT,
+  facility TEXT,
+  is_recurring BOOLEAN DEFAULT FALSE,
+  recurring_weeks INT
+);
+
+CREATE TABLE IF NOT EXISTS approvedbookings (
+  id SERIAL PRIMARY KEY,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMPTZ NOT NULL,
+  end_time TIMESTAMPTZ NOT NULL,
+  purpose TEXT,
+  facility TEXT
+);
+
+CREATE TABLE IF NOT EXISTS recurringbookings (
+  id SERIAL PRIMARY KEY,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMPTZ NOT NULL,
+  end_time TIMESTAMPTZ NOT NULL,
+  purpose TEXT,
+  facility TEXT
+);
@@ -0,0 +1,5 @@
+ALTER TABLE recurringbookings DROP CONSTRAINT recurringbookings_facility_fkey;
+ALTER TABLE approvedbookings DROP CONSTRAINT approvedbookings_facility_fkey;
+ALTER TABLE requestedbookings DROP CONSTRAINT requestedbookings_facility_fkey;
+
+DROP TABLE facilities;
@@ -0,0 +1,28 @@
+-- Facility catalogue, bookings refer to a facility by name
+CREATE TABLE facilities (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  capacity INT NOT NULL DEFAULT 0 CHECK (capacity >= 0),
+  location VARCHAR(255) NOT NULL DEFAULT '',
+  is_active BOOLEAN NOT NULL DEFAULT TRUE,
+  image_url TEXT NOT NULL DEFAULT '',
+  booking_rules TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- seed the catalogue with the facilities existing bookings already use
+INSERT INTO facilities (name)
+SELECT DISTINCT facility FROM requestedbookings WHERE facility IS NOT NULL
+UNION
+SELECT DISTINCT facility FROM approvedbookings WHERE facility IS NOT NULL
+UNION
+SELECT DISTINCT facility FROM recurringbookings WHERE facility IS NOT NULL;
+
+ALTER TABLE requestedbookings ADD CONSTRAINT requestedbookings_facility_fkey
+  FOREIGN KEY (facility) REFERENCES facilities (name) ON UPDATE CASCADE;
+ALTER TABLE approvedbookings ADD CONSTRAINT approvedbookings_facility_fkey
+  FOREIGN KEY (facility) REFERENCES facilities (name) ON UPDATE CASCADE;
+ALTER TABLE recurringbookings ADD CONSTRAINT recurringbookings_facility_fkey
+  FOREIGN KEY (facility) REFERENCES facilities (name) ON UPDATE CASCADE;
@@ -0,0 +1,9 @@
+DROP TABLE facility_opening_hours;
+
+ALTER TABLE facilities
+  DROP COLUMN time_zone,
+  DROP COLUMN min_slot_minutes,
+  DROP COLUMN max_slot_minutes,
+  DROP COLUMN slot_granularity_minutes,
+  DROP COLUMN lead_time_minutes,
+  DROP COLUMN max_advance_days;
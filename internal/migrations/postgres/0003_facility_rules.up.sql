@@ -0,0 +1,18 @@
+-- Booking window rules, 0 means no limit
+ALTER TABLE facilities
+  ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC',
+  ADD COLUMN min_slot_minutes INT NOT NULL DEFAULT 0 CHECK (min_slot_minutes >= 0),
+  ADD COLUMN max_slot_minutes INT NOT NULL DEFAULT 0 CHECK (max_slot_minutes >= 0),
+  ADD COLUMN slot_granularity_minutes INT NOT NULL DEFAULT 0 CHECK (slot_granularity_minutes >= 0),
+  ADD COLUMN lead_time_minutes INT NOT NULL DEFAULT 0 CHECK (lead_time_minutes >= 0),
+  ADD COLUMN max_advance_days INT NOT NULL DEFAULT 0 CHECK (max_advance_days >= 0);
+
+-- Opening hours per weekday, times are minutes after local midnight
+CREATE TABLE facility_opening_hours (
+  id SERIAL PRIMARY KEY,
+  facility_id INT NOT NULL REFERENCES facilities (id) ON DELETE CASCADE,
+  weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+  opens_minute INT NOT NULL CHECK (opens_minute BETWEEN 0 AND 1440),
+  closes_minute INT NOT NULL CHECK (closes_minute BETWEEN 0 AND 1440),
+  CHECK (opens_minute < closes_minute)
+);
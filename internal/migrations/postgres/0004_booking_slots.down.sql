@@ -0,0 +1,7 @@
+DROP TRIGGER recurringbookings_sync_slot ON recurringbookings;
+DROP TRIGGER approvedbookings_sync_slot ON approvedbookings;
+DROP FUNCTION sync_booking_slot();
+DROP TABLE booking_slots;
+
+ALTER TABLE recurringbookings DROP COLUMN during;
+ALTER TABLE approvedbookings DROP COLUMN during;
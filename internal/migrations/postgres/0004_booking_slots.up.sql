@@ -0,0 +1,46 @@
+-- btree_gist lets the booking exclusion constraint compare facility names with =
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE approvedbookings
+  ADD COLUMN during TSTZRANGE GENERATED ALWAYS AS (tstzrange(start_time, end_time, '[)')) STORED;
+ALTER TABLE recurringbookings
+  ADD COLUMN during TSTZRANGE GENERATED ALWAYS AS (tstzrange(start_time, end_time, '[)')) STORED;
+
+-- An exclusion constraint only covers a single table, so approved and recurring
+-- bookings mirror their time range here through triggers and the constraint
+-- rejects any two overlapping slots of the same facility.
+CREATE TABLE booking_slots (
+  booking_kind TEXT NOT NULL CHECK (booking_kind IN ('approved', 'recurring')),
+  booking_id INT NOT NULL,
+  facility TEXT,
+  during TSTZRANGE NOT NULL,
+  PRIMARY KEY (booking_kind, booking_id),
+  CONSTRAINT booking_slots_no_overlap EXCLUDE USING gist (facility WITH =, during WITH &&)
+);
+
+INSERT INTO booking_slots (booking_kind, booking_id, facility, during)
+SELECT 'approved', id, facility, during FROM approvedbookings
+UNION ALL
+SELECT 'recurring', id, facility, during FROM recurringbookings;
+
+CREATE FUNCTION sync_booking_slot() RETURNS trigger
+  LANGUAGE plpgsql AS $$
+BEGIN
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    DELETE FROM booking_slots WHERE booking_kind = TG_ARGV[0] AND booking_id = OLD.id;
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') THEN
+    INSERT INTO booking_slots (booking_kind, booking_id, facility, during)
+    VALUES (TG_ARGV[0], NEW.id, NEW.facility, NEW.during);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER approvedbookings_sync_slot
+  AFTER INSERT OR UPDATE OR DELETE ON approvedbookings
+  FOR EACH ROW EXECUTE FUNCTION sync_booking_slot('approved');
+
+CREATE TRIGGER recurringbookings_sync_slot
+  AFTER INSERT OR UPDATE OR DELETE ON recurringbookings
+  FOR EACH ROW EXECUTE FUNCTION sync_booking_slot('recurring');
@@ -0,0 +1,8 @@
+ALTER TABLE recurringbookings DROP COLUMN series_id;
+
+DROP TABLE booking_series;
+
+ALTER TABLE requestedbookings
+  DROP COLUMN rrule,
+  DROP COLUMN exdates,
+  DROP COLUMN time_zone;
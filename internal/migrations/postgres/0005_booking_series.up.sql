@@ -0,0 +1,29 @@
+-- Recurring requests carry an RFC 5545 rule, exdates as comma separated UTC
+-- timestamps and the time zone the rule is expanded in
+ALTER TABLE requestedbookings
+  ADD COLUMN rrule TEXT NOT NULL DEFAULT '',
+  ADD COLUMN exdates TEXT NOT NULL DEFAULT '',
+  ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+
+-- An approved recurring booking as a whole, start_time and end_time are those of
+-- the first occurrence
+CREATE TABLE booking_series (
+  id SERIAL PRIMARY KEY,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  purpose TEXT,
+  facility TEXT REFERENCES facilities (name) ON UPDATE CASCADE,
+  start_time TIMESTAMPTZ NOT NULL,
+  end_time TIMESTAMPTZ NOT NULL,
+  rrule TEXT NOT NULL,
+  exdates TEXT NOT NULL DEFAULT '',
+  time_zone TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- occurrences approved before series existed have no series
+ALTER TABLE recurringbookings
+  ADD COLUMN series_id INT REFERENCES booking_series (id) ON DELETE CASCADE;
+
+CREATE INDEX recurringbookings_series_id_idx ON recurringbookings (series_id);
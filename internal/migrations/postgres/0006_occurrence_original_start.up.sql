@@ -0,0 +1,7 @@
+-- Where the recurrence rule put an occurrence, so "this and following" still finds
+-- the right occurrences after some of them have been moved
+ALTER TABLE recurringbookings ADD COLUMN original_start TIMESTAMPTZ;
+
+UPDATE recurringbookings SET original_start = start_time;
+
+ALTER TABLE recurringbookings ALTER COLUMN original_start SET NOT NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET is_admin = role IN ('admin', 'super_admin');
+
+ALTER TABLE users ALTER COLUMN is_admin DROP DEFAULT;
+ALTER TABLE users DROP COLUMN role;
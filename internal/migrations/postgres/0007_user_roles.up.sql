@@ -0,0 +1,7 @@
+-- Roles replace the is_admin flag, existing admins keep their rights
+ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'resident'
+  CHECK (role IN ('resident', 'facility_manager', 'admin', 'super_admin'));
+
+UPDATE users SET role = 'admin' WHERE is_admin;
+
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,14 @@
+-- Refresh tokens are rotated on every use. A family holds a token and all tokens it
+-- was rotated into, the whole family is revoked when a used token is replayed.
+CREATE TABLE refresh_tokens (
+  id SERIAL PRIMARY KEY,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  family_id VARCHAR(64) NOT NULL,
+  username VARCHAR(255) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
@@ -0,0 +1,12 @@
+-- Password reset tokens are single use. Issuing a new one for a user voids the older
+-- ones, resetting the password revokes the user's refresh tokens.
+CREATE TABLE password_resets (
+  id SERIAL PRIMARY KEY,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  username VARCHAR(255) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ
+);
+
+CREATE INDEX password_resets_username_idx ON password_resets (username);
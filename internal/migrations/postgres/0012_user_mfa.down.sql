@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens DROP COLUMN mfa;
+DROP TABLE recovery_codes;
+DROP TABLE user_mfa;
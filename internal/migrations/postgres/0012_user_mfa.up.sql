@@ -0,0 +1,22 @@
+-- TOTP enrolments. A row without enabled_at is an enrolment the user has not yet
+-- confirmed with a code. last_step is the time step of the last accepted code.
+CREATE TABLE user_mfa (
+  username VARCHAR(255) PRIMARY KEY REFERENCES users (username) ON DELETE CASCADE,
+  totp_secret VARCHAR(64) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  enabled_at TIMESTAMPTZ,
+  last_step BIGINT NOT NULL DEFAULT 0
+);
+
+-- Single-use recovery codes for users who lost their authenticator, only their hash is stored
+CREATE TABLE recovery_codes (
+  id SERIAL PRIMARY KEY,
+  username VARCHAR(255) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+  code_hash CHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ
+);
+
+CREATE INDEX recovery_codes_username_idx ON recovery_codes (username);
+
+-- whether the session's sign in was completed with a second factor
+ALTER TABLE refresh_tokens ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,23 @@
+-- Accounts at the OpenID Connect provider, by issuer and subject. Users created on
+-- their first single sign-on have no usable password.
+CREATE TABLE user_identities (
+  id SERIAL PRIMARY KEY,
+  issuer VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  username VARCHAR(255) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (issuer, subject)
+);
+
+CREATE INDEX user_identities_username_idx ON user_identities (username);
+
+-- Single sign-ons waiting for the provider to redirect back, looked up once by the
+-- hash of their state
+CREATE TABLE oidc_logins (
+  state_hash CHAR(64) PRIMARY KEY,
+  nonce VARCHAR(255) NOT NULL,
+  code_verifier VARCHAR(255) NOT NULL,
+  return_to VARCHAR(2048) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
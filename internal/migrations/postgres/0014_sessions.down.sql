@@ -0,0 +1,5 @@
+DROP INDEX refresh_tokens_username_idx;
+
+ALTER TABLE refresh_tokens DROP COLUMN started_at;
+ALTER TABLE refresh_tokens DROP COLUMN ip_address;
+ALTER TABLE refresh_tokens DROP COLUMN user_agent;
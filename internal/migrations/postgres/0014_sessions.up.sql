@@ -0,0 +1,9 @@
+-- A refresh token family is a session. Every token records the client it was issued
+-- to, and started_at is carried over on rotation so a session knows when it began.
+ALTER TABLE refresh_tokens ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN started_at TIMESTAMPTZ;
+UPDATE refresh_tokens SET started_at = created_at;
+ALTER TABLE refresh_tokens ALTER COLUMN started_at SET NOT NULL;
+
+CREATE INDEX refresh_tokens_username_idx ON refresh_tokens (username);
@@ -0,0 +1,16 @@
+-- API keys for other systems. A key acts as the user who minted it, limited to the
+-- space separated permissions in scopes. Only the SHA-256 hash of a key is stored,
+-- its prefix is kept to tell keys apart.
+CREATE TABLE api_keys (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  prefix VARCHAR(32) NOT NULL UNIQUE,
+  key_hash CHAR(64) NOT NULL UNIQUE,
+  username VARCHAR(255) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+  scopes TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ,
+  last_used_ip VARCHAR(64) NOT NULL DEFAULT '',
+  revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,4 @@
+DROP TABLE recurringbookings;
+DROP TABLE approvedbookings;
+DROP TABLE requestedbookings;
+DROP TABLE users;
@@ -0,0 +1,50 @@
+-- Baseline schema, mirrors postgres/0001_initial.up.sql.
+-- Timestamps are stored as UTC text so they compare correctly as strings.
+
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL UNIQUE,
+  password VARCHAR(255) NOT NULL,
+  is_admin BOOLEAN NOT NULL
+);
+
+CREATE TABLE requestedbookings (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT,
+  is_recurring BOOLEAN DEFAULT FALSE,
+  recurring_weeks INT
+);
+
+CREATE TABLE approvedbookings (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT
+);
+
+CREATE TABLE recurringbookings (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT
+);
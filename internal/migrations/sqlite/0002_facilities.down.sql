@@ -0,0 +1,52 @@
+-- rebuild the booking tables without the facility reference, then drop the catalogue
+CREATE TABLE requestedbookings_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT,
+  is_recurring BOOLEAN DEFAULT FALSE,
+  recurring_weeks INT
+);
+INSERT INTO requestedbookings_new SELECT * FROM requestedbookings;
+DROP TABLE requestedbookings;
+ALTER TABLE requestedbookings_new RENAME TO requestedbookings;
+
+CREATE TABLE approvedbookings_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT
+);
+INSERT INTO approvedbookings_new SELECT * FROM approvedbookings;
+DROP TABLE approvedbookings;
+ALTER TABLE approvedbookings_new RENAME TO approvedbookings;
+
+CREATE TABLE recurringbookings_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT
+);
+INSERT INTO recurringbookings_new SELECT * FROM recurringbookings;
+DROP TABLE recurringbookings;
+ALTER TABLE recurringbookings_new RENAME TO recurringbookings;
+
+DROP TABLE facilities;
@@ -0,0 +1,65 @@
+-- Facility catalogue, bookings refer to a facility by name
+CREATE TABLE facilities (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  capacity INT NOT NULL DEFAULT 0 CHECK (capacity >= 0),
+  location VARCHAR(255) NOT NULL DEFAULT '',
+  is_active BOOLEAN NOT NULL DEFAULT TRUE,
+  image_url TEXT NOT NULL DEFAULT '',
+  booking_rules TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL
+);
+
+-- SQLite cannot add a foreign key to an existing table, so the booking tables are
+-- rebuilt with the facility reference
+CREATE TABLE requestedbookings_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT REFERENCES facilities (name) ON UPDATE CASCADE,
+  is_recurring BOOLEAN DEFAULT FALSE,
+  recurring_weeks INT
+);
+INSERT INTO requestedbookings_new SELECT * FROM requestedbookings;
+DROP TABLE requestedbookings;
+ALTER TABLE requestedbookings_new RENAME TO requestedbookings;
+
+CREATE TABLE approvedbookings_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT REFERENCES facilities (name) ON UPDATE CASCADE
+);
+INSERT INTO approvedbookings_new SELECT * FROM approvedbookings;
+DROP TABLE approvedbookings;
+ALTER TABLE approvedbookings_new RENAME TO approvedbookings;
+
+CREATE TABLE recurringbookings_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT REFERENCES facilities (name) ON UPDATE CASCADE
+);
+INSERT INTO recurringbookings_new SELECT * FROM recurringbookings;
+DROP TABLE recurringbookings;
+ALTER TABLE recurringbookings_new RENAME TO recurringbookings;
@@ -0,0 +1,8 @@
+DROP TABLE facility_opening_hours;
+
+ALTER TABLE facilities DROP COLUMN time_zone;
+ALTER TABLE facilities DROP COLUMN min_slot_minutes;
+ALTER TABLE facilities DROP COLUMN max_slot_minutes;
+ALTER TABLE facilities DROP COLUMN slot_granularity_minutes;
+ALTER TABLE facilities DROP COLUMN lead_time_minutes;
+ALTER TABLE facilities DROP COLUMN max_advance_days;
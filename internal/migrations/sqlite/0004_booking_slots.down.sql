@@ -0,0 +1,4 @@
+DROP TRIGGER recurringbookings_no_overlap_update;
+DROP TRIGGER recurringbookings_no_overlap_insert;
+DROP TRIGGER approvedbookings_no_overlap_update;
+DROP TRIGGER approvedbookings_no_overlap_insert;
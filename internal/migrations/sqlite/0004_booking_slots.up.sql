@@ -0,0 +1,51 @@
+-- SQLite has no exclusion constraints, so these triggers play the part of the
+-- booking_slots_no_overlap constraint in Postgres: no two approved or recurring
+-- bookings of the same facility may overlap.
+
+CREATE TRIGGER approvedbookings_no_overlap_insert BEFORE INSERT ON approvedbookings
+WHEN EXISTS (
+  SELECT 1 FROM approvedbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+  UNION ALL
+  SELECT 1 FROM recurringbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+)
+BEGIN
+  SELECT RAISE(ABORT, 'booking_slots_no_overlap');
+END;
+
+CREATE TRIGGER approvedbookings_no_overlap_update BEFORE UPDATE OF facility, start_time, end_time ON approvedbookings
+WHEN EXISTS (
+  SELECT 1 FROM approvedbookings
+  WHERE id <> NEW.id AND facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+  UNION ALL
+  SELECT 1 FROM recurringbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+)
+BEGIN
+  SELECT RAISE(ABORT, 'booking_slots_no_overlap');
+END;
+
+CREATE TRIGGER recurringbookings_no_overlap_insert BEFORE INSERT ON recurringbookings
+WHEN EXISTS (
+  SELECT 1 FROM approvedbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+  UNION ALL
+  SELECT 1 FROM recurringbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+)
+BEGIN
+  SELECT RAISE(ABORT, 'booking_slots_no_overlap');
+END;
+
+CREATE TRIGGER recurringbookings_no_overlap_update BEFORE UPDATE OF facility, start_time, end_time ON recurringbookings
+WHEN EXISTS (
+  SELECT 1 FROM approvedbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+  UNION ALL
+  SELECT 1 FROM recurringbookings
+  WHERE id <> NEW.id AND facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+)
+BEGIN
+  SELECT RAISE(ABORT, 'booking_slots_no_overlap');
+END;
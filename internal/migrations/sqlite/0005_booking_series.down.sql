@@ -0,0 +1,78 @@
+-- SQLite cannot drop a column with a foreign key, so recurringbookings is rebuilt.
+-- The overlap triggers refer to it and are recreated afterwards.
+DROP TRIGGER approvedbookings_no_overlap_insert;
+DROP TRIGGER approvedbookings_no_overlap_update;
+DROP TRIGGER recurringbookings_no_overlap_insert;
+DROP TRIGGER recurringbookings_no_overlap_update;
+
+CREATE TABLE recurringbookings_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  purpose TEXT,
+  facility TEXT REFERENCES facilities (name) ON UPDATE CASCADE
+);
+INSERT INTO recurringbookings_new
+SELECT id, username, name, start_date, end_date, unit_number, start_time, end_time, purpose, facility
+FROM recurringbookings;
+DROP TABLE recurringbookings;
+ALTER TABLE recurringbookings_new RENAME TO recurringbookings;
+
+DROP TABLE booking_series;
+
+ALTER TABLE requestedbookings DROP COLUMN rrule;
+ALTER TABLE requestedbookings DROP COLUMN exdates;
+ALTER TABLE requestedbookings DROP COLUMN time_zone;
+
+CREATE TRIGGER approvedbookings_no_overlap_insert BEFORE INSERT ON approvedbookings
+WHEN EXISTS (
+  SELECT 1 FROM approvedbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+  UNION ALL
+  SELECT 1 FROM recurringbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+)
+BEGIN
+  SELECT RAISE(ABORT, 'booking_slots_no_overlap');
+END;
+
+CREATE TRIGGER approvedbookings_no_overlap_update BEFORE UPDATE OF facility, start_time, end_time ON approvedbookings
+WHEN EXISTS (
+  SELECT 1 FROM approvedbookings
+  WHERE id <> NEW.id AND facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+  UNION ALL
+  SELECT 1 FROM recurringbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+)
+BEGIN
+  SELECT RAISE(ABORT, 'booking_slots_no_overlap');
+END;
+
+CREATE TRIGGER recurringbookings_no_overlap_insert BEFORE INSERT ON recurringbookings
+WHEN EXISTS (
+  SELECT 1 FROM approvedbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+  UNION ALL
+  SELECT 1 FROM recurringbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+)
+BEGIN
+  SELECT RAISE(ABORT, 'booking_slots_no_overlap');
+END;
+
+CREATE TRIGGER recurringbookings_no_overlap_update BEFORE UPDATE OF facility, start_time, end_time ON recurringbookings
+WHEN EXISTS (
+  SELECT 1 FROM approvedbookings
+  WHERE facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+  UNION ALL
+  SELECT 1 FROM recurringbookings
+  WHERE id <> NEW.id AND facility = NEW.facility AND NEW.start_time < end_time AND NEW.end_time > start_time
+)
+BEGIN
+  SELECT RAISE(ABORT, 'booking_slots_no_overlap');
+END;
@@ -0,0 +1,27 @@
+-- Recurring requests carry an RFC 5545 rule, exdates as comma separated UTC
+-- timestamps and the time zone the rule is expanded in
+ALTER TABLE requestedbookings ADD COLUMN rrule TEXT NOT NULL DEFAULT '';
+ALTER TABLE requestedbookings ADD COLUMN exdates TEXT NOT NULL DEFAULT '';
+ALTER TABLE requestedbookings ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+
+-- An approved recurring booking as a whole, start_time and end_time are those of
+-- the first occurrence
+CREATE TABLE booking_series (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL REFERENCES users (username),
+  name VARCHAR(255) NOT NULL,
+  unit_number VARCHAR(255) NOT NULL,
+  purpose TEXT,
+  facility TEXT REFERENCES facilities (name) ON UPDATE CASCADE,
+  start_time TIMESTAMP NOT NULL,
+  end_time TIMESTAMP NOT NULL,
+  rrule TEXT NOT NULL,
+  exdates TEXT NOT NULL DEFAULT '',
+  time_zone TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+-- occurrences approved before series existed have no series
+ALTER TABLE recurringbookings ADD COLUMN series_id INT REFERENCES booking_series (id) ON DELETE CASCADE;
+
+CREATE INDEX recurringbookings_series_id_idx ON recurringbookings (series_id);
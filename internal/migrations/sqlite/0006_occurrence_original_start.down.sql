@@ -0,0 +1 @@
+ALTER TABLE recurringbookings DROP COLUMN original_start;
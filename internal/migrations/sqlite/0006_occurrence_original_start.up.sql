@@ -0,0 +1,6 @@
+-- Where the recurrence rule put an occurrence, so "this and following" still finds
+-- the right occurrences after some of them have been moved. SQLite cannot add a
+-- NOT NULL column without a default, the repository always sets it.
+ALTER TABLE recurringbookings ADD COLUMN original_start TIMESTAMP;
+
+UPDATE recurringbookings SET original_start = start_time;
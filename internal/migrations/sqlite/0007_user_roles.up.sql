@@ -0,0 +1,7 @@
+-- Roles replace the is_admin flag, existing admins keep their rights. The repository
+-- only writes known roles, SQLite cannot drop a column used in a CHECK constraint.
+ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'resident';
+
+UPDATE users SET role = 'admin' WHERE is_admin;
+
+ALTER TABLE users DROP COLUMN is_admin;
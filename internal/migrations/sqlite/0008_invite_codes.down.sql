@@ -0,0 +1,3 @@
+DROP TABLE invite_codes;
+
+ALTER TABLE users DROP COLUMN unit_number;
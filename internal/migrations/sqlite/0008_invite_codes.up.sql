@@ -0,0 +1,15 @@
+-- Residents register with a single-use invite code that ties their account to a
+-- unit number. Only the SHA-256 hash of a code is stored, created_by is NULL for
+-- invites created with `api users invite`.
+ALTER TABLE users ADD COLUMN unit_number VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE invite_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  code_hash CHAR(64) NOT NULL UNIQUE,
+  unit_number VARCHAR(255) NOT NULL,
+  created_by VARCHAR(255) REFERENCES users (username),
+  created_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  used_by VARCHAR(255) REFERENCES users (username),
+  used_at TIMESTAMP
+);
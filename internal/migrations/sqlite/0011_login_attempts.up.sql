@@ -0,0 +1,20 @@
+-- Every sign in attempt is recorded for the audit trail, including attempts for
+-- usernames that do not exist.
+CREATE TABLE login_attempts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(255) NOT NULL,
+  ip_address VARCHAR(64) NOT NULL,
+  outcome VARCHAR(32) NOT NULL,
+  attempted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_attempts_username_idx ON login_attempts (username, attempted_at);
+
+-- Recent failures per username ("user:<name>") and per IP address ("ip:<address>"),
+-- used to slow down and lock out password guessing.
+CREATE TABLE login_throttles (
+  throttle_key VARCHAR(320) PRIMARY KEY,
+  failures INTEGER NOT NULL,
+  last_failure_at TIMESTAMP NOT NULL,
+  locked_until TIMESTAMP
+);
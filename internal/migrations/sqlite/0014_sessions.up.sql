@@ -0,0 +1,10 @@
+-- A refresh token family is a session. Every token records the client it was issued
+-- to, and started_at is carried over on rotation so a session knows when it began.
+-- SQLite cannot add a NOT NULL column without a constant default, the repository
+-- always sets started_at.
+ALTER TABLE refresh_tokens ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN started_at TIMESTAMP;
+UPDATE refresh_tokens SET started_at = created_at;
+
+CREATE INDEX refresh_tokens_username_idx ON refresh_tokens (username);
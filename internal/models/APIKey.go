@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// APIKey lets another system call the API without a user signing in. A key acts as
+// the user who minted it, limited to its scopes, and only its hash is stored. Key is
+// only set when the key is minted; Prefix identifies it afterwards.
+type APIKey struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	Key        string       `json:"key,omitempty"`
+	Username   string       `json:"username"`
+	Scopes     []Permission `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
+	LastUsedIP string       `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time   `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key can still be used at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
+
+// HasScope reports whether the key was granted permission p
+func (k *APIKey) HasScope(p Permission) bool {
+	return hasPermission(k.Scopes, p)
+}
+
+// ValidAPIKeyScope reports whether API keys may be granted p, see APIKeyScopes
+func ValidAPIKeyScope(p Permission) bool {
+	return hasPermission(APIKeyScopes, p)
+}
@@ -14,6 +14,13 @@ type Booking struct {
 	Facility       string    `json:"facility"`
 	Recurring      bool      `json:"recurring"`
 	RecurringWeeks int       `json:"recurring_weeks"`
+	// RRule is an RFC 5545 recurrence rule such as FREQ=WEEKLY;INTERVAL=2;COUNT=6.
+	// Requests that only set RecurringWeeks repeat weekly that many times.
+	RRule string `json:"rrule"`
+	// ExDates are dates on which an occurrence of the series is skipped
+	ExDates []time.Time `json:"exdates"`
+	// TimeZone the series is expanded in, the facility's time zone if empty
+	TimeZone string `json:"time_zone"`
 }
 
 type RequestedBooking struct {
@@ -29,6 +36,13 @@ type RequestedBooking struct {
 	Facility       string    `json:"facility"`
 	Recurring      bool      `json:"recurring"`
 	RecurringWeeks int       `json:"recurring_weeks"`
+	// RRule is an RFC 5545 recurrence rule such as FREQ=WEEKLY;INTERVAL=2;COUNT=6.
+	// Requests that only set RecurringWeeks repeat weekly that many times.
+	RRule string `json:"rrule"`
+	// ExDates are dates on which an occurrence of the series is skipped
+	ExDates []time.Time `json:"exdates"`
+	// TimeZone the series is expanded in, the facility's time zone if empty
+	TimeZone string `json:"time_zone"`
 }
 
 type SubmittedBooking struct {
@@ -42,4 +56,16 @@ type SubmittedBooking struct {
 	EndTime    string    `json:"end_time"`
 	Purpose    string    `json:"purpose"`
 	Facility   string    `json:"facility"`
+	// SeriesID is set on recurring bookings created from a booking series
+	SeriesID *int `json:"series_id,omitempty"`
+}
+
+// BookingConflict identifies an existing booking that blocks a requested slot.
+// Kind is "approved" or "recurring" depending on the table the booking lives in.
+type BookingConflict struct {
+	BookingID int       `json:"booking_id"`
+	Kind      string    `json:"kind"`
+	Facility  string    `json:"facility"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
 }
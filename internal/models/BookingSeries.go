@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// BookingSeries is an approved recurring booking as a whole. StartTime and EndTime
+// are those of the first occurrence, the remaining ones follow from RRule and ExDates
+// expanded in TimeZone.
+type BookingSeries struct {
+	ID          int                 `json:"id"`
+	Username    string              `json:"username"`
+	Name        string              `json:"name"`
+	UnitNumber  string              `json:"unit_number"`
+	Purpose     string              `json:"purpose"`
+	Facility    string              `json:"facility"`
+	StartTime   time.Time           `json:"start_time"`
+	EndTime     time.Time           `json:"end_time"`
+	RRule       string              `json:"rrule"`
+	ExDates     []time.Time         `json:"exdates"`
+	TimeZone    string              `json:"time_zone"`
+	CreatedAt   time.Time           `json:"created_at"`
+	Occurrences []*SubmittedBooking `json:"occurrences"`
+}
+
+// Scopes of an occurrence change, as offered by calendar apps
+const (
+	ScopeThis      = "this"
+	ScopeFollowing = "following"
+	ScopeAll       = "all"
+)
+
+// OccurrenceChange edits or cancels an occurrence of a series and, depending on Scope,
+// the occurrences after it or the whole series. StartTime and EndTime are the new
+// RFC 3339 times of the chosen occurrence, both empty keep the times; an empty Purpose
+// is left unchanged. Following and all keep each occurrence on its day and only move
+// the time of day.
+type OccurrenceChange struct {
+	SeriesID     int    `json:"series_id"`
+	OccurrenceID int    `json:"occurrence_id"`
+	Scope        string `json:"scope"`
+	StartTime    string `json:"start_time"`
+	EndTime      string `json:"end_time"`
+	Purpose      string `json:"purpose"`
+}
+
+// Outcomes of approving an occurrence of a recurring request
+const (
+	OccurrenceCreated = "created"
+	OccurrenceSkipped = "skipped"
+)
+
+// OccurrenceResult is the outcome of approving one occurrence. BookingID is the
+// recurring booking created for it, Conflict the booking it was skipped for.
+type OccurrenceResult struct {
+	StartTime time.Time        `json:"start_time"`
+	EndTime   time.Time        `json:"end_time"`
+	Status    string           `json:"status"`
+	BookingID int              `json:"booking_id,omitempty"`
+	Conflict  *BookingConflict `json:"conflict,omitempty"`
+}
+
+// ApprovalReport tells what became of every occurrence of an approved recurring request
+type ApprovalReport struct {
+	SeriesID    int                `json:"series_id"`
+	Created     int                `json:"created"`
+	Skipped     int                `json:"skipped"`
+	Occurrences []OccurrenceResult `json:"occurrences"`
+}
+
+// Add records the outcome of the next occurrence
+func (r *ApprovalReport) Add(result OccurrenceResult) {
+	if result.Status == OccurrenceCreated {
+		r.Created++
+	} else {
+		r.Skipped++
+	}
+	r.Occurrences = append(r.Occurrences, result)
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Facility is a bookable common area such as the function room or a BBQ pit.
+// Bookings refer to a facility by its name.
+type Facility struct {
+	ID           int           `json:"id"`
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	Capacity     int           `json:"capacity"`
+	Location     string        `json:"location"`
+	Active       bool          `json:"active"`
+	ImageURL     string        `json:"image_url"`
+	BookingRules string        `json:"booking_rules"`
+	Rules        FacilityRules `json:"rules"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Rule names reported in a RuleViolation
+const (
+	RuleTimeRange       = "time_range"
+	RuleOpeningHours    = "opening_hours"
+	RuleMinSlotLength   = "min_slot_length"
+	RuleMaxSlotLength   = "max_slot_length"
+	RuleSlotGranularity = "slot_granularity"
+	RuleLeadTime        = "lead_time"
+	RuleMaxAdvance      = "max_advance"
+)
+
+// FacilityRules constrain when a facility can be booked. Zero values mean "no limit".
+// Opening hours are interpreted in TimeZone; a facility without opening hours is
+// open around the clock, otherwise weekdays without an entry are closed.
+type FacilityRules struct {
+	TimeZone               string         `json:"time_zone"`
+	OpeningHours           []OpeningHours `json:"opening_hours"`
+	MinSlotMinutes         int            `json:"min_slot_minutes"`
+	MaxSlotMinutes         int            `json:"max_slot_minutes"`
+	SlotGranularityMinutes int            `json:"slot_granularity_minutes"`
+	LeadTimeMinutes        int            `json:"lead_time_minutes"`
+	MaxAdvanceDays         int            `json:"max_advance_days"`
+}
+
+// OpeningHours is one opening window on a weekday, e.g. {1, "09:00", "22:00"} for Mondays.
+// Closes may be "24:00" for a window that runs until midnight.
+type OpeningHours struct {
+	Weekday time.Weekday `json:"weekday"`
+	Opens   string       `json:"opens"`
+	Closes  string       `json:"closes"`
+}
+
+// RuleViolation is returned when a booking breaks one of its facility's rules
+type RuleViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v *RuleViolation) Error() string {
+	return v.Message
+}
+
+func violation(rule string, format string, args ...interface{}) *RuleViolation {
+	return &RuleViolation{Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+// ParseClock converts "HH:MM" into minutes after midnight, allowing "24:00"
+func ParseClock(clock string) (int, error) {
+	var hours, minutes int
+	_, err := fmt.Sscanf(clock, "%d:%d", &hours, &minutes)
+	if err != nil || len(clock) != 5 || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", clock)
+	}
+	return hours*60 + minutes, nil
+}
+
+// FormatClock is the inverse of ParseClock
+func FormatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// Location returns the time zone the rules are expressed in, UTC if unset
+func (r FacilityRules) Location() (*time.Location, error) {
+	if r.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.TimeZone)
+}
+
+// Validate checks that the rules themselves are consistent
+func (r FacilityRules) Validate() error {
+	if _, err := r.Location(); err != nil {
+		return fmt.Errorf("unknown time zone %q", r.TimeZone)
+	}
+
+	if r.MinSlotMinutes < 0 || r.MaxSlotMinutes < 0 || r.SlotGranularityMinutes < 0 ||
+		r.LeadTimeMinutes < 0 || r.MaxAdvanceDays < 0 {
+		return errors.New("booking rules cannot be negative")
+	}
+
+	if r.MaxSlotMinutes > 0 && r.MinSlotMinutes > r.MaxSlotMinutes {
+		return errors.New("minimum slot length cannot exceed maximum slot length")
+	}
+
+	for _, hours := range r.OpeningHours {
+		if hours.Weekday < time.Sunday || hours.Weekday > time.Saturday {
+			return fmt.Errorf("invalid weekday %d, expected 0 (Sunday) to 6 (Saturday)", hours.Weekday)
+		}
+		opens, err := ParseClock(hours.Opens)
+		if err != nil {
+			return err
+		}
+		closes, err := ParseClock(hours.Closes)
+		if err != nil {
+			return err
+		}
+		if opens >= closes {
+			return fmt.Errorf("opening hours on %s close before they open", hours.Weekday)
+		}
+	}
+
+	return nil
+}
+
+// Check applies every rule to a booking from start to end requested at now
+func (r FacilityRules) Check(start, end, now time.Time) error {
+	err := r.CheckSlot(start, end)
+	if err != nil {
+		return err
+	}
+
+	return r.CheckWindow(start, now)
+}
+
+// CheckSlot applies the rules that only depend on the slot itself: its length,
+// granularity and whether it falls within opening hours
+func (r FacilityRules) CheckSlot(start, end time.Time) error {
+	if !end.After(start) {
+		return violation(RuleTimeRange, "booking must end after it starts")
+	}
+
+	loc, err := r.Location()
+	if err != nil {
+		return err
+	}
+	start = start.In(loc)
+	end = end.In(loc)
+
+	length := end.Sub(start)
+	if r.MinSlotMinutes > 0 && length < time.Duration(r.MinSlotMinutes)*time.Minute {
+		return violation(RuleMinSlotLength, "bookings must be at least %d minutes long", r.MinSlotMinutes)
+	}
+	if r.MaxSlotMinutes > 0 && length > time.Duration(r.MaxSlotMinutes)*time.Minute {
+		return violation(RuleMaxSlotLength, "bookings cannot be longer than %d minutes", r.MaxSlotMinutes)
+	}
+
+	if g := r.SlotGranularityMinutes; g > 0 {
+		startMinute := start.Hour()*60 + start.Minute()
+		if startMinute%g != 0 || start.Second() != 0 || length%(time.Duration(g)*time.Minute) != 0 {
+			return violation(RuleSlotGranularity, "bookings must start and end on %d minute boundaries", g)
+		}
+	}
+
+	if len(r.OpeningHours) > 0 && !r.withinOpeningHours(start, end, loc) {
+		return violation(RuleOpeningHours, "booking falls outside the facility's opening hours on %s", start.Weekday())
+	}
+
+	return nil
+}
+
+// CheckWindow applies the rules on how far ahead a booking starting at start can be made
+func (r FacilityRules) CheckWindow(start, now time.Time) error {
+	lead := time.Duration(r.LeadTimeMinutes) * time.Minute
+	if start.Before(now.Add(lead)) {
+		if lead == 0 {
+			return violation(RuleLeadTime, "booking cannot start in the past")
+		}
+		return violation(RuleLeadTime, "bookings must be made at least %d minutes in advance", r.LeadTimeMinutes)
+	}
+
+	if r.MaxAdvanceDays > 0 && start.After(now.AddDate(0, 0, r.MaxAdvanceDays)) {
+		return violation(RuleMaxAdvance, "bookings can be made at most %d days in advance", r.MaxAdvanceDays)
+	}
+
+	return nil
+}
+
+// withinOpeningHours reports whether [start, end) fits inside a single opening window
+// of the day the booking starts on
+func (r FacilityRules) withinOpeningHours(start, end time.Time, loc *time.Location) bool {
+	year, month, day := start.Date()
+
+	for _, hours := range r.OpeningHours {
+		if hours.Weekday != start.Weekday() {
+			continue
+		}
+		opens, err := ParseClock(hours.Opens)
+		if err != nil {
+			continue
+		}
+		closes, err := ParseClock(hours.Closes)
+		if err != nil {
+			continue
+		}
+
+		// build wall clock times so opening hours stay put across DST changes
+		windowStart := time.Date(year, month, day, 0, opens, 0, 0, loc)
+		windowEnd := time.Date(year, month, day, 0, closes, 0, 0, loc)
+		if !start.Before(windowStart) && !end.After(windowEnd) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// InviteCode lets a new resident register an account tied to a unit number. Codes are
+// single use and only their hash is stored, Code is only set when the invite is created.
+type InviteCode struct {
+	ID         int        `json:"id"`
+	Code       string     `json:"code,omitempty"`
+	UnitNumber string     `json:"unit_number"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedBy     string     `json:"used_by,omitempty"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+}
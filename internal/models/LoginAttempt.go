@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Outcomes of a sign in attempt recorded in the audit trail
+const (
+	LoginSucceeded   = "succeeded"
+	LoginFailed      = "invalid_credentials"
+	LoginThrottled   = "throttled"
+	LoginMFARequired = "mfa_required"
+	LoginMFAFailed   = "invalid_mfa_code"
+)
+
+// LoginAttempt is an entry of the audit trail of sign in attempts. Username is the
+// name that was tried, which may not belong to any account.
+type LoginAttempt struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	IPAddress   string    `json:"ip_address"`
+	Outcome     string    `json:"outcome"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// LoginThrottle counts the recent failed sign ins of a username or an IP address, Key
+// tells them apart. Failures are forgotten after a successful sign in, an unlock or
+// when the last one is long enough ago.
+type LoginThrottle struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
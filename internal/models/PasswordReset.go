@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PasswordReset lets a user who forgot their password choose a new one. Reset tokens
+// are single use and only their hash is stored, Token is only set when it is issued.
+type PasswordReset struct {
+	ID        int        `json:"id"`
+	Token     string     `json:"-"`
+	Username  string     `json:"username"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// RefreshToken is a stored refresh token. Every /refresh uses up the token and issues
+// a new one in the same family; presenting a used token again revokes the family.
+// Only the hash of a token is stored, Token is only set when it is issued.
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	Token     string     `json:"-"`
+	FamilyID  string     `json:"family_id"`
+	Username  string     `json:"username"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// MFA is set when the session's sign in was completed with a second factor
+	MFA bool `json:"mfa"`
+	// UserAgent and IPAddress describe the client the token was issued to
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+	// StartedAt is when the family's first token was issued
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Session is a signed in device of a user: a refresh token family with an unused,
+// unrevoked and unexpired token. Its ID is the family id.
+type Session struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	UserAgent string `json:"user_agent"`
+	// Device is a readable summary of UserAgent, e.g. "Firefox on Windows"
+	Device    string    `json:"device"`
+	IPAddress string    `json:"ip_address"`
+	MFA       bool      `json:"mfa"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastUsedAt is when the session last signed in or refreshed its tokens
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks the session of the request listing the sessions
+	Current bool `json:"current"`
+}
@@ -0,0 +1,126 @@
+package models
+
+// Role decides what a user is allowed to do, see rolePermissions
+type Role string
+
+const (
+	RoleResident        Role = "resident"
+	RoleFacilityManager Role = "facility_manager"
+	RoleAdmin           Role = "admin"
+	RoleSuperAdmin      Role = "super_admin"
+)
+
+// Permission is an action checked by the API before a request reaches its handler
+type Permission string
+
+const (
+	// PermRequestBooking allows requesting bookings
+	PermRequestBooking Permission = "bookings:request"
+	// PermManageOwnBookings allows viewing and cancelling the user's own bookings
+	PermManageOwnBookings Permission = "bookings:manage_own"
+	// PermViewAllBookings allows viewing the bookings of every user
+	PermViewAllBookings Permission = "bookings:view_all"
+	// PermManageAllBookings allows changing and cancelling the bookings of every user
+	PermManageAllBookings Permission = "bookings:manage_all"
+	// PermApproveBookings allows approving booking requests
+	PermApproveBookings Permission = "bookings:approve"
+	// PermManageFacilities allows editing the facility catalogue
+	PermManageFacilities Permission = "facilities:manage"
+	// PermManageUsers allows inviting residents and changing the roles of other users,
+	// limited by Role.CanAssign
+	PermManageUsers Permission = "users:manage"
+)
+
+// APIKeyScopes are the permissions API keys may be granted. Managing users stays with
+// people, so a key cannot mint further keys or change roles.
+var APIKeyScopes = []Permission{
+	PermRequestBooking,
+	PermManageOwnBookings,
+	PermViewAllBookings,
+	PermManageAllBookings,
+	PermApproveBookings,
+	PermManageFacilities,
+}
+
+var residentPermissions = []Permission{
+	PermRequestBooking,
+	PermManageOwnBookings,
+}
+
+var facilityManagerPermissions = append([]Permission{
+	PermViewAllBookings,
+	PermManageAllBookings,
+	PermApproveBookings,
+}, residentPermissions...)
+
+var adminPermissions = append([]Permission{
+	PermManageFacilities,
+	PermManageUsers,
+}, facilityManagerPermissions...)
+
+var rolePermissions = map[Role][]Permission{
+	RoleResident:        residentPermissions,
+	RoleFacilityManager: facilityManagerPermissions,
+	RoleAdmin:           adminPermissions,
+	RoleSuperAdmin:      adminPermissions,
+}
+
+// roleRanks orders the roles from least to most privileged
+var roleRanks = map[Role]int{
+	RoleResident:        1,
+	RoleFacilityManager: 2,
+	RoleAdmin:           3,
+	RoleSuperAdmin:      4,
+}
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether users with role r have permission p
+func (r Role) Can(p Permission) bool {
+	return hasPermission(rolePermissions[r], p)
+}
+
+func hasPermission(permissions []Permission, p Permission) bool {
+	for _, permission := range permissions {
+		if permission == p {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether r is one of the administrator roles, which the frontend
+// shows the admin pages to
+func (r Role) IsAdmin() bool {
+	return r == RoleAdmin || r == RoleSuperAdmin
+}
+
+// CanAssign reports whether a user with role r may change another user's role from
+// one role to another. Super-admins may assign any role, everyone else only below
+// their own role to users below it.
+func (r Role) CanAssign(from, to Role) bool {
+	if !r.Can(PermManageUsers) {
+		return false
+	}
+	if r == RoleSuperAdmin {
+		return true
+	}
+	return roleRanks[from] < roleRanks[r] && roleRanks[to] < roleRanks[r]
+}
+
+// CanManage reports whether a user with role r may act on the account of a user with
+// role other, e.g. sign them out. Super-admins manage everyone, everyone else with
+// PermManageUsers only users below their own role.
+func (r Role) CanManage(other Role) bool {
+	if !r.Can(PermManageUsers) {
+		return false
+	}
+	if r == RoleSuperAdmin {
+		return true
+	}
+	return roleRanks[other] < roleRanks[r]
+}
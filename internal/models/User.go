@@ -10,7 +10,9 @@ type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"user_name"`
 	Password string `json:"password"`
-	IsAdmin  bool   `json:"is_admin"`
+	Role     Role   `json:"role"`
+	// UnitNumber is the unit of the invite code the user registered with
+	UnitNumber string `json:"unit_number"`
 }
 
 func (u *User) PasswordMatches(plainText string) (bool, error) {
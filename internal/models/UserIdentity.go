@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account at an OpenID Connect provider. Subject is
+// only unique per issuer.
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCLogin is a single sign-on in progress, from the redirect to the identity provider
+// until it redirects back. Only the hash of State is stored, it is looked up once.
+type OIDCLogin struct {
+	State        string `json:"-"`
+	Nonce        string `json:"-"`
+	CodeVerifier string `json:"-"`
+	// ReturnTo is the frontend path the user is sent to once signed in
+	ReturnTo  string    `json:"return_to"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
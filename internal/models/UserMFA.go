@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// UserMFA is a user's TOTP enrolment. Enrolment starts with a secret and is enabled once
+// the user confirmed a code from their authenticator app.
+type UserMFA struct {
+	Username  string     `json:"username"`
+	Secret    string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	EnabledAt *time.Time `json:"enabled_at,omitempty"`
+	// LastStep is the time step of the last accepted code, codes cannot be used twice
+	LastStep int64 `json:"-"`
+}
+
+// Enabled reports whether the user confirmed the enrolment
+func (m *UserMFA) Enabled() bool {
+	return m.EnabledAt != nil
+}
@@ -0,0 +1,132 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrIDTokenMalformed = errors.New("oidc: malformed id token")
+	ErrIDTokenSignature = errors.New("oidc: invalid id token signature")
+	ErrIDTokenExpired   = errors.New("oidc: id token has expired")
+	ErrIDTokenIssuedAt  = errors.New("oidc: id token is issued in the future")
+	ErrIDTokenIssuer    = errors.New("oidc: id token is from another issuer")
+	ErrIDTokenAudience  = errors.New("oidc: id token is for another client")
+	ErrIDTokenNonce     = errors.New("oidc: id token nonce does not match")
+	ErrIDTokenSubject   = errors.New("oidc: id token has no subject")
+)
+
+// signingMethods are the algorithms ID tokens may be signed with. HMAC with the client
+// secret is not accepted.
+var signingMethods = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodRS384.Alg(),
+	jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+}
+
+// IDToken holds the verified claims of an ID token
+type IDToken struct {
+	jwt.RegisteredClaims
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp"`
+	AMR               []string `json:"amr"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+
+	// claims holds every claim of the token, for provider specific claims
+	claims map[string]interface{}
+}
+
+// Claim returns a string claim of the token, "" if it is missing or not a string
+func (t *IDToken) Claim(name string) string {
+	value, _ := t.claims[name].(string)
+	return value
+}
+
+// MultiFactor reports whether the provider says the user signed in with more than one
+// factor (RFC 8176 amr values)
+func (t *IDToken) MultiFactor() bool {
+	for _, method := range t.AMR {
+		switch method {
+		case "mfa", "otp", "hwk", "sms":
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's keys and
+// its claims (OpenID Connect Core 3.1.3.7): the issuer, this client as the audience,
+// the expiry and the nonce of the sign in.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw string, nonce string) (*IDToken, error) {
+	_, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &IDToken{}
+	parser := jwt.NewParser(jwt.WithValidMethods(signingMethods), jwt.WithoutClaimsValidation())
+	_, err = parser.ParseWithClaims(raw, token, p.keys.keyfunc(ctx))
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorMalformed != 0 {
+			return nil, ErrIDTokenMalformed
+		}
+		return nil, fmt.Errorf("%w: %v", ErrIDTokenSignature, err)
+	}
+
+	err = p.validate(token, nonce, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// the signature is valid, so the payload is well formed
+	payload, _ := base64.RawURLEncoding.DecodeString(strings.Split(raw, ".")[1])
+	_ = json.Unmarshal(payload, &token.claims)
+
+	return token, nil
+}
+
+func (p *Provider) validate(token *IDToken, nonce string, now time.Time) error {
+	leeway := p.config.Leeway
+
+	if token.Issuer != p.config.Issuer {
+		return ErrIDTokenIssuer
+	}
+	if !token.VerifyAudience(p.config.ClientID, true) {
+		return ErrIDTokenAudience
+	}
+	// a token for several audiences must name this client as the one it was issued to
+	if len(token.Audience) > 1 || token.AuthorizedParty != "" {
+		if token.AuthorizedParty != p.config.ClientID {
+			return ErrIDTokenAudience
+		}
+	}
+	if token.ExpiresAt == nil || !now.Before(token.ExpiresAt.Add(leeway)) {
+		return ErrIDTokenExpired
+	}
+	if token.IssuedAt == nil || now.Add(leeway).Before(token.IssuedAt.Time) {
+		return ErrIDTokenIssuedAt
+	}
+	if token.Subject == "" {
+		return ErrIDTokenSubject
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Nonce), []byte(nonce)) != 1 {
+		return ErrIDTokenNonce
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// minRefreshInterval keeps tokens with unknown kids from making the client fetch the
+// provider's keys on every request
+const minRefreshInterval = time.Minute
+
+// jwk is a public key of the provider's JWKS (RFC 7517). RSA and EC keys are supported.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet caches the keys of a JWKS URL
+type keySet struct {
+	client *http.Client
+	url    string
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeySet(client *http.Client, url string) *keySet {
+	return &keySet{client: client, url: url}
+}
+
+// key returns the key with the kid, fetching the JWKS again if it is not known. Tokens
+// without a kid are accepted when the provider publishes a single key.
+func (ks *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.lookup(kid)
+	if ok {
+		return key, nil
+	}
+
+	if time.Since(ks.fetchedAt) < minRefreshInterval {
+		return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+	}
+
+	err := ks.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok = ks.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (ks *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// fetch replaces the cached keys with the provider's current JWKS
+func (ks *keySet) fetch(ctx context.Context) error {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	ks.fetchedAt = time.Now()
+	err := getJSON(ctx, ks.client, ks.url, &jwks)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range jwks.Keys {
+		// encryption keys and key types this client cannot verify with are skipped
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("oidc: provider publishes no usable signing keys")
+	}
+
+	ks.keys = keys
+	return nil
+}
+
+// publicKey decodes the RSA or EC public key of a JWK
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("oidc: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("oidc: unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("oidc: EC key is not on its curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("oidc: unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("oidc: invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// keyfunc returns the jwt.Keyfunc that looks up the key named by a token's kid header
+func (ks *keySet) keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return ks.key(ctx, kid)
+	}
+}
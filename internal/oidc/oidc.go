@@ -0,0 +1,289 @@
+// Package oidc signs users in with an OpenID Connect identity provider using the
+// authorization code flow with PKCE (RFC 7636). The provider is configured from its
+// discovery document and ID tokens are verified against its published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// discoveryPath is appended to the issuer to find its configuration
+	discoveryPath = "/.well-known/openid-configuration"
+	// maxResponseSize limits what is read from the provider
+	maxResponseSize = 1 << 20
+	// DefaultLeeway is the clock skew tolerated when verifying ID tokens
+	DefaultLeeway = 30 * time.Second
+)
+
+// ErrPKCEUnsupported is returned when the provider does not announce S256 code challenges
+var ErrPKCEUnsupported = errors.New("oidc: provider does not support S256 code challenges")
+
+// Config describes the client registered with the identity provider
+type Config struct {
+	// Issuer is the provider's issuer URL, its discovery document is read from there
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends users back to with the code
+	RedirectURL string
+	// Scopes are requested in addition to openid
+	Scopes []string
+	// Leeway tolerates clock skew for exp and iat, DefaultLeeway if zero
+	Leeway time.Duration
+	// HTTPClient talks to the provider, a client with a 10 second timeout if nil
+	HTTPClient *http.Client
+}
+
+// Metadata is the part of the discovery document the client uses
+type Metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// Provider is an identity provider. Its metadata and keys are fetched on first use
+// and cached, keys are fetched again when a token names a kid that is not known.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+// NewProvider returns a provider for config, nothing is fetched until it is used
+func NewProvider(config Config) (*Provider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer, client id and redirect url are required")
+	}
+	if config.Leeway == 0 {
+		config.Leeway = DefaultLeeway
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{config: config, client: client}, nil
+}
+
+// Issuer returns the issuer URL identities of this provider are scoped to
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// Metadata returns the provider's discovery document, fetching it on first use
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata Metadata
+	err := p.getJSON(ctx, strings.TrimSuffix(p.config.Issuer, "/")+discoveryPath, &metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// the document must be for the issuer it was fetched from (OpenID Connect Discovery 4.3)
+	if metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q, expected %q", metadata.Issuer, p.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document lacks an authorization, token or jwks endpoint")
+	}
+	if !contains(metadata.CodeChallengeMethods, "S256") {
+		return nil, ErrPKCEUnsupported
+	}
+
+	p.metadata = &metadata
+	p.keys = newKeySet(p.client, metadata.JWKSURI)
+	return p.metadata, nil
+}
+
+// AuthCodeURL returns the URL the user is sent to to sign in. state is echoed back to
+// the redirect URL, nonce ends up in the ID token and verifier is the PKCE code
+// verifier kept until the code is exchanged.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid authorization endpoint: %w", err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, p.config.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// TokenResponse is the provider's answer to a code exchange
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Error is an error response of the provider (RFC 6749 5.2)
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "oidc: " + e.Code
+	}
+	return "oidc: " + e.Code + ": " + e.Description
+}
+
+// Exchange trades an authorization code and its PKCE verifier for tokens. Clients
+// with a secret authenticate with HTTP basic auth, public clients send their id.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*TokenResponse, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// RFC 6749 2.3.1 has the id and secret form encoded before basic auth
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		providerErr := &Error{}
+		if json.Unmarshal(body, providerErr) == nil && providerErr.Code != "" {
+			return nil, providerErr
+		}
+		return nil, fmt.Errorf("oidc: token endpoint returned %s", resp.Status)
+	}
+
+	var tokens TokenResponse
+	err = json.Unmarshal(body, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: invalid token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+
+	return &tokens, nil
+}
+
+// getJSON fetches a JSON document from the provider
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	return getJSON(ctx, p.client, url, v)
+}
+
+// getJSON fetches a JSON document with client
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s returned %s", url, resp.Status)
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("oidc: invalid response from %s: %w", url, err)
+	}
+	return nil
+}
+
+// RandomToken returns a random URL-safe string for state and nonce values
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewCodeVerifier returns a PKCE code verifier, 43 characters of 32 random bytes
+func NewCodeVerifier() (string, error) {
+	return RandomToken()
+}
+
+// CodeChallenge returns the S256 code challenge of a code verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
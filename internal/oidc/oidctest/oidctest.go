@@ -0,0 +1,253 @@
+// Package oidctest runs a local OpenID Connect provider for tests of sign in flows.
+// It implements discovery, an authorization endpoint that signs in a preset user
+// without a login page, the token endpoint with PKCE checks and the JWKS.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const keyID = "oidctest"
+
+// User is the identity the provider signs in. Claims are added to the ID token as is,
+// e.g. preferred_username, email or amr.
+type User struct {
+	Subject string
+	Claims  map[string]interface{}
+}
+
+// authorization is an issued authorization code waiting to be exchanged
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	user          User
+}
+
+// Server is a mock identity provider, start it with NewServer and Close it when done
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// TokenExpiry is the lifetime of ID tokens, 5 minutes by default
+	TokenExpiry time.Duration
+	// Tamper, if set, changes the claims of ID tokens before they are signed, to test
+	// how clients handle tokens a correct provider would not issue
+	Tamper func(claims map[string]interface{})
+
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	user  User
+	codes map[string]authorization
+	// denied makes the authorization endpoint answer with access_denied
+	denied bool
+}
+
+// NewServer starts a provider for a confidential client, an empty clientSecret makes
+// it a public client
+func NewServer(clientID, clientSecret string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenExpiry:  5 * time.Minute,
+		key:          key,
+		codes:        map[string]authorization{},
+		user:         User{Subject: "oidctest-user"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Issuer returns the issuer URL to configure the client with
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// SignIn sets the user the next authorization requests sign in
+func (s *Server) SignIn(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = user
+	s.denied = false
+}
+
+// Deny makes the next authorization requests fail as if the user declined
+func (s *Server) Deny() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denied = true
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize signs in the preset user and redirects back to the client with a code
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() || query.Get("client_id") != s.ClientID {
+		http.Error(w, "invalid client or redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	back := redirectURI.Query()
+	back.Set("state", query.Get("state"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.denied:
+		back.Set("error", "access_denied")
+	case query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		back.Set("error", "invalid_request")
+	default:
+		code := randomString()
+		s.codes[code] = authorization{
+			clientID:      s.ClientID,
+			redirectURI:   redirectURI.String(),
+			nonce:         query.Get("nonce"),
+			codeChallenge: query.Get("code_challenge"),
+			user:          s.user,
+		}
+		back.Set("code", code)
+	}
+
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token once, checking the client and PKCE verifier
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != s.ClientID || secret != s.ClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	s.mu.Lock()
+	code := r.PostForm.Get("code")
+	auth, found := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	verifier := r.PostForm.Get("code_verifier")
+	sum := sha256.Sum256([]byte(verifier))
+	switch {
+	case !found || auth.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant")
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for name, value := range auth.user.Claims {
+		claims[name] = value
+	}
+	claims["iss"] = s.URL
+	claims["sub"] = auth.user.Subject
+	claims["aud"] = auth.clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.TokenExpiry).Unix()
+	if auth.nonce != "" {
+		claims["nonce"] = auth.nonce
+	}
+	if s.Tamper != nil {
+		s.Tamper(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		tokenError(w, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(s.TokenExpiry.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
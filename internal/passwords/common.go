@@ -0,0 +1,30 @@
+package passwords
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// common.txt lists frequently used and breached passwords, one per line in lower case
+//
+//go:embed common.txt
+var commonList string
+
+var common = parseCommon(commonList)
+
+func parseCommon(list string) map[string]bool {
+	passwords := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[line] = true
+	}
+	return passwords
+}
+
+// IsCommon reports whether password is on the list of common passwords, ignoring case
+func IsCommon(password string) bool {
+	return common[strings.ToLower(password)]
+}
@@ -0,0 +1,134 @@
+// Package passwords checks new passwords against the password policy and hashes them.
+//
+// Passwords are hashed with bcrypt, which only looks at the first 72 bytes of a
+// password, so the policy never allows longer ones. The bcrypt cost is configurable;
+// hashes made with a lower cost are replaced the next time their user signs in.
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxBytes is the longest password bcrypt hashes without truncating it
+const MaxBytes = 72
+
+// Policy is what a new password has to satisfy
+type Policy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// MaxLength is the maximum number of bytes, at most MaxBytes
+	MaxLength int
+	// MinClasses is how many of lower case letters, upper case letters, digits and
+	// symbols the password must contain
+	MinClasses int
+}
+
+// DefaultPolicy is the policy used unless the API is configured otherwise
+var DefaultPolicy = Policy{
+	MinLength:  10,
+	MaxLength:  MaxBytes,
+	MinClasses: 2,
+}
+
+// PolicyError is returned when a password does not satisfy the policy. Rule names the
+// failed check so the frontend can point at it.
+type PolicyError struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// Validate checks the policy itself, the API refuses to start with an invalid one
+func (p Policy) Validate() error {
+	if p.MinLength < 1 {
+		return errors.New("password minimum length must be at least 1")
+	}
+	if p.MaxLength < p.MinLength || p.MaxLength > MaxBytes {
+		return fmt.Errorf("password maximum length must be between the minimum length and %d bytes", MaxBytes)
+	}
+	if p.MinClasses < 0 || p.MinClasses > 4 {
+		return errors.New("password character classes must be between 0 and 4")
+	}
+	return nil
+}
+
+// Check returns a *PolicyError if password does not satisfy the policy, is the
+// username or is one of the commonly used passwords
+func (p Policy) Check(password, username string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PolicyError{Rule: "min_length", Message: fmt.Sprintf("password must be at least %d characters long", p.MinLength)}
+	}
+	if len(password) > p.MaxLength {
+		return &PolicyError{Rule: "max_length", Message: fmt.Sprintf("password must be at most %d bytes long", p.MaxLength)}
+	}
+	if classes(password) < p.MinClasses {
+		return &PolicyError{
+			Rule:    "character_classes",
+			Message: fmt.Sprintf("password must contain %d of lower case letters, upper case letters, digits and symbols", p.MinClasses),
+		}
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return &PolicyError{Rule: "username", Message: "password must not be the username"}
+	}
+	if IsCommon(password) {
+		return &PolicyError{Rule: "common", Message: "password is too common, choose a less predictable one"}
+	}
+	return nil
+}
+
+// classes counts the character classes used in password
+func classes(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	n := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			n++
+		}
+	}
+	return n
+}
+
+// Hash returns the bcrypt hash of password with the given cost
+func Hash(password string, cost int) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// NeedsRehash reports whether hash was made with a lower cost than cost
+func NeedsRehash(hash string, cost int) bool {
+	hashCost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && hashCost < cost
+}
+
+// ValidateCost checks a configured bcrypt cost
+func ValidateCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+// Package recurrence parses RFC 5545 recurrence rules and expands them into occurrences.
+//
+// The supported subset covers what residents' committees ask for: FREQ of DAILY,
+// WEEKLY, MONTHLY or YEARLY with INTERVAL, COUNT, UNTIL, BYDAY (with ordinals such
+// as 2TU or -1FR), BYMONTHDAY, BYMONTH, BYSETPOS and WKST. Occurrences keep the wall
+// clock time of DTSTART in its location, so a 7pm booking stays at 7pm across DST
+// changes.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxOccurrences bounds how many occurrences a single rule may expand to
+const MaxOccurrences = 366
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// WeekdayNum is a BYDAY entry. N is the ordinal within the month or year,
+// e.g. 2 for the second Tuesday or -1 for the last Friday, and 0 for every such weekday.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a parsed RRULE. Either Count or Until must be set so that expansion ends.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	Count    int
+	Until    time.Time
+	// FloatingUntil is set when UNTIL was a date or a date-time without Z. Until then
+	// holds a wall clock time in UTC's fields, which Expand reads in DTSTART's location
+	// as RFC 5545 3.3.10 asks.
+	FloatingUntil bool
+	ByDay         []WeekdayNum
+	ByMonthDay    []int
+	ByMonth       []int
+	BySetPos      []int
+	WeekStart     time.Weekday
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+func weekdayCode(day time.Weekday) string {
+	return strings.ToUpper(day.String()[:2])
+}
+
+// EveryWeek returns the rule the legacy "repeat for N weeks" option stands for
+func EveryWeek(weeks int) *Rule {
+	return &Rule{Freq: Weekly, Interval: 1, Count: weeks, WeekStart: time.Monday}
+}
+
+// Parse reads a rule such as "FREQ=MONTHLY;BYDAY=2TU;COUNT=6". A leading "RRULE:" is allowed.
+func Parse(rrule string) (*Rule, error) {
+	rrule = strings.TrimPrefix(strings.TrimSpace(rrule), "RRULE:")
+	if rrule == "" {
+		return nil, errors.New("empty recurrence rule")
+	}
+
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(rrule, ";") {
+		key, value, found := strings.Cut(part, "=")
+		key = strings.ToUpper(key)
+		if !found || value == "" {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("recurrence rule part %s given twice", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			rule.Freq = Frequency(strings.ToUpper(value))
+			switch rule.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			default:
+				err = fmt.Errorf("unsupported frequency %s", value)
+			}
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+			if err == nil && rule.Interval < 1 {
+				err = errors.New("INTERVAL must be positive")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+			if err == nil && rule.Count < 1 {
+				err = errors.New("COUNT must be positive")
+			}
+		case "UNTIL":
+			rule.Until, rule.FloatingUntil, err = parseUntil(value)
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseInts(value, -31, 31)
+		case "BYMONTH":
+			rule.ByMonth, err = parseInts(value, 1, 12)
+		case "BYSETPOS":
+			rule.BySetPos, err = parseInts(value, -MaxOccurrences, MaxOccurrences)
+		case "WKST":
+			day, ok := weekdayCodes[strings.ToUpper(value)]
+			if !ok {
+				err = fmt.Errorf("invalid WKST %s", value)
+			}
+			rule.WeekStart = day
+		default:
+			err = fmt.Errorf("unsupported recurrence rule part %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("recurrence rule needs a FREQ")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, errors.New("recurrence rule cannot have both COUNT and UNTIL")
+	}
+	if rule.Count == 0 && rule.Until.IsZero() {
+		return nil, errors.New("recurrence rule needs a COUNT or an UNTIL date")
+	}
+	if rule.Count > MaxOccurrences {
+		return nil, fmt.Errorf("recurrence rule cannot have more than %d occurrences", MaxOccurrences)
+	}
+	if rule.Freq == Weekly && len(rule.ByMonthDay) > 0 {
+		return nil, errors.New("BYMONTHDAY is not allowed with WEEKLY")
+	}
+	for _, day := range rule.ByDay {
+		if day.N != 0 && rule.Freq != Monthly && rule.Freq != Yearly {
+			return nil, errors.New("BYDAY ordinals are only allowed with MONTHLY or YEARLY")
+		}
+	}
+
+	return rule, nil
+}
+
+// parseUntil parses an UNTIL value and reports whether it is floating, i.e. a local
+// time of DTSTART's location rather than UTC
+func parseUntil(value string) (time.Time, bool, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if layout == "20060102" {
+			// a date-only UNTIL includes the whole day
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, layout != "20060102T150405Z", nil
+	}
+	return time.Time{}, false, fmt.Errorf("%s is not a date or date-time", value)
+}
+
+// until returns the instant expansion stops after for occurrences in loc
+func (r *Rule) until(loc *time.Location) time.Time {
+	if !r.FloatingUntil {
+		return r.Until
+	}
+	u := r.Until
+	return time.Date(u.Year(), u.Month(), u.Day(), u.Hour(), u.Minute(), u.Second(), 0, loc)
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToUpper(item)
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid weekday %q", item)
+		}
+		day, ok := weekdayCodes[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", item)
+		}
+
+		n := 0
+		if ordinal := item[:len(item)-2]; ordinal != "" {
+			var err error
+			n, err = strconv.Atoi(ordinal)
+			if err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, fmt.Errorf("invalid weekday ordinal %q", item)
+			}
+		}
+		days = append(days, WeekdayNum{N: n, Day: day})
+	}
+	return days, nil
+}
+
+func parseInts(value string, min, max int) ([]int, error) {
+	var values []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || n == 0 || n < min || n > max {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+// String formats the rule in RRULE syntax, without the "RRULE:" prefix
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.FloatingUntil {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+	} else if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		var days []string
+		for _, day := range r.ByDay {
+			code := weekdayCode(day.Day)
+			if day.N != 0 {
+				code = strconv.Itoa(day.N) + code
+			}
+			days = append(days, code)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinInts(r.ByMonth))
+	}
+	if len(r.BySetPos) > 0 {
+		parts = append(parts, "BYSETPOS="+joinInts(r.BySetPos))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayCode(r.WeekStart))
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinInts(values []int) string {
+	var items []string
+	for _, v := range values {
+		items = append(items, strconv.Itoa(v))
+	}
+	return strings.Join(items, ",")
+}
+
+// Expand returns the start of every occurrence from dtstart on, in dtstart's location.
+// Occurrences falling on the local date of an exdate are left out; as in RFC 5545
+// they still count towards COUNT.
+func (r *Rule) Expand(dtstart time.Time, exdates []time.Time) ([]time.Time, error) {
+	loc := dtstart.Location()
+	until := r.until(loc)
+	excluded := map[string]bool{}
+	for _, exdate := range exdates {
+		excluded[exdate.In(loc).Format("2006-01-02")] = true
+	}
+
+	var occurrences []time.Time
+	total := 0
+
+	// expansion walks one period (day, week, month or year) at a time; the bound on
+	// periods stops rules whose filters never match from looping forever
+	for period := 0; period < 100*MaxOccurrences; period++ {
+		candidates := r.periodDates(dtstart, period)
+		for _, date := range candidates {
+			occurrence := time.Date(date.Year(), date.Month(), date.Day(),
+				dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, loc)
+			if occurrence.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && occurrence.After(until) {
+				return occurrences, nil
+			}
+
+			total++
+			if total > MaxOccurrences {
+				return nil, fmt.Errorf("recurrence rule expands to more than %d occurrences", MaxOccurrences)
+			}
+			if !excluded[occurrence.Format("2006-01-02")] {
+				occurrences = append(occurrences, occurrence)
+			}
+			if r.Count > 0 && total == r.Count {
+				return occurrences, nil
+			}
+		}
+	}
+
+	return occurrences, nil
+}
+
+// date is a calendar day, kept as midnight UTC so arithmetic is free of DST
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// periodDates lists the candidate dates of the n-th period after dtstart's, in order
+func (r *Rule) periodDates(dtstart time.Time, n int) []time.Time {
+	start := date(dtstart.Year(), dtstart.Month(), dtstart.Day())
+	step := n * r.Interval
+
+	var dates []time.Time
+	switch r.Freq {
+	case Daily:
+		day := start.AddDate(0, 0, step)
+		if r.matchesMonth(day) && r.matchesMonthDay(day) && r.matchesWeekday(day) {
+			dates = append(dates, day)
+		}
+	case Weekly:
+		offset := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := start.AddDate(0, 0, -offset+7*step)
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if !r.matchesMonth(day) {
+				continue
+			}
+			if len(r.ByDay) == 0 && day.Weekday() != start.Weekday() {
+				continue
+			}
+			if len(r.ByDay) > 0 && !r.matchesWeekday(day) {
+				continue
+			}
+			dates = append(dates, day)
+		}
+	case Monthly:
+		month := date(start.Year(), start.Month()+time.Month(step), 1)
+		if r.matchesMonth(month) {
+			dates = r.monthDates(month, start.Day())
+		}
+	case Yearly:
+		year := start.Year() + step
+		if len(r.ByDay) > 0 && len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 {
+			// without BYMONTH, BYDAY ordinals count within the year, e.g. 20MO is
+			// the 20th Monday of the year
+			dates = r.yearDates(year)
+			break
+		}
+
+		months := r.ByMonth
+		switch {
+		case len(months) > 0:
+			months = append([]int(nil), months...)
+			sort.Ints(months)
+		case len(r.ByMonthDay) > 0:
+			// BYMONTHDAY alone applies to every month
+			months = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+		default:
+			months = []int{int(start.Month())}
+		}
+		for _, m := range months {
+			dates = append(dates, r.monthDates(date(year, time.Month(m), 1), start.Day())...)
+		}
+	}
+
+	return r.applySetPos(dates)
+}
+
+// monthDates lists the days of the month starting at first that match BYMONTHDAY and BYDAY,
+// or the day of month DTSTART falls on when neither is given
+func (r *Rule) monthDates(first time.Time, defaultDay int) []time.Time {
+	daysInMonth := first.AddDate(0, 1, -1).Day()
+
+	var dates []time.Time
+	for d := 1; d <= daysInMonth; d++ {
+		day := first.AddDate(0, 0, d-1)
+		switch {
+		case len(r.ByMonthDay) == 0 && len(r.ByDay) == 0:
+			if d != defaultDay {
+				continue
+			}
+		case len(r.ByMonthDay) > 0 && !r.matchesMonthDay(day):
+			continue
+		case len(r.ByDay) > 0 && !r.matchesWeekdayInMonth(day, daysInMonth):
+			continue
+		}
+		dates = append(dates, day)
+	}
+	return dates
+}
+
+// yearDates lists the days of the year that match BYDAY, with ordinals counted from
+// the start or the end of the year
+func (r *Rule) yearDates(year int) []time.Time {
+	first := date(year, time.January, 1)
+	daysInYear := first.AddDate(1, 0, -1).YearDay()
+
+	var dates []time.Time
+	for d := 1; d <= daysInYear; d++ {
+		day := first.AddDate(0, 0, d-1)
+		for _, wd := range r.ByDay {
+			if wd.Day != day.Weekday() {
+				continue
+			}
+			fromStart := (d-1)/7 + 1
+			fromEnd := -((daysInYear-d)/7 + 1)
+			if wd.N == 0 || wd.N == fromStart || wd.N == fromEnd {
+				dates = append(dates, day)
+				break
+			}
+		}
+	}
+	return dates
+}
+
+func (r *Rule) matchesMonth(day time.Time) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, m := range r.ByMonth {
+		if time.Month(m) == day.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := date(day.Year(), day.Month(), 1).AddDate(0, 1, -1).Day()
+	for _, md := range r.ByMonthDay {
+		if md == day.Day() || md < 0 && daysInMonth+md+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if wd.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWeekdayInMonth handles BYDAY with ordinals, e.g. 2TU is the second Tuesday of the month
+func (r *Rule) matchesWeekdayInMonth(day time.Time, daysInMonth int) bool {
+	for _, wd := range r.ByDay {
+		if wd.Day != day.Weekday() {
+			continue
+		}
+		fromStart := (day.Day()-1)/7 + 1
+		fromEnd := -((daysInMonth-day.Day())/7 + 1)
+		if wd.N == 0 || wd.N == fromStart || wd.N == fromEnd {
+			return true
+		}
+	}
+	return false
+}
+
+// applySetPos keeps the BYSETPOS-th dates of a period, e.g. -1 for the last one
+func (r *Rule) applySetPos(dates []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 || len(dates) == 0 {
+		return dates
+	}
+
+	var kept []time.Time
+	for i, day := range dates {
+		for _, pos := range r.BySetPos {
+			if pos == i+1 || pos == i-len(dates) {
+				kept = append(kept, day)
+				break
+			}
+		}
+	}
+	return kept
+}
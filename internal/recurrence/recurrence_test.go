@@ -0,0 +1,203 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandUntilInDTStartZone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	dtstart := time.Date(2026, time.November, 3, 20, 0, 0, 0, newYork)
+
+	tests := []struct {
+		name  string
+		rrule string
+		last  time.Time
+	}{
+		// 20:00 EST on Nov 24 is 01:00Z on Nov 25, after 23:59:59Z on Nov 24
+		{"date", "FREQ=WEEKLY;UNTIL=20261124", time.Date(2026, time.November, 24, 20, 0, 0, 0, newYork)},
+		{"floating date-time", "FREQ=WEEKLY;UNTIL=20261124T200000", time.Date(2026, time.November, 24, 20, 0, 0, 0, newYork)},
+		{"floating date-time before the occurrence", "FREQ=WEEKLY;UNTIL=20261124T195959", time.Date(2026, time.November, 17, 20, 0, 0, 0, newYork)},
+		{"UTC date-time", "FREQ=WEEKLY;UNTIL=20261124T235959Z", time.Date(2026, time.November, 17, 20, 0, 0, 0, newYork)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rrule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rrule, err)
+			}
+			occurrences, err := rule.Expand(dtstart, nil)
+			if err != nil {
+				t.Fatalf("Expand: %v", err)
+			}
+			if len(occurrences) == 0 || !occurrences[len(occurrences)-1].Equal(tt.last) {
+				t.Errorf("Expand(%q) = %v, want the last occurrence at %v", tt.rrule, occurrences, tt.last)
+			}
+
+			// the formatted rule expands to the same occurrences
+			reparsed, err := Parse(rule.String())
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", rule.String(), err)
+			}
+			again, err := reparsed.Expand(dtstart, nil)
+			if err != nil || len(again) != len(occurrences) {
+				t.Errorf("%q expands to %d occurrences, want %d (%v)", rule.String(), len(again), len(occurrences), err)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 19, 0, 0, 0, london)
+	}
+
+	tests := []struct {
+		name    string
+		rrule   string
+		dtstart time.Time
+		exdates []time.Time
+		want    []string
+	}{
+		{
+			// clocks go forward on March 29, the booking stays at 7pm
+			name:    "weekly across the start of summer time",
+			rrule:   "FREQ=WEEKLY;COUNT=3",
+			dtstart: at(2026, time.March, 19),
+			want:    []string{"2026-03-19 19:00 GMT", "2026-03-26 19:00 GMT", "2026-04-02 19:00 BST"},
+		},
+		{
+			name:    "weekly on two days every other week",
+			rrule:   "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=4",
+			dtstart: at(2026, time.January, 5),
+			want:    []string{"2026-01-05 19:00 GMT", "2026-01-07 19:00 GMT", "2026-01-19 19:00 GMT", "2026-01-21 19:00 GMT"},
+		},
+		{
+			name:    "exdates are skipped but counted",
+			rrule:   "FREQ=WEEKLY;COUNT=3",
+			dtstart: at(2026, time.January, 5),
+			exdates: []time.Time{time.Date(2026, time.January, 12, 0, 0, 0, 0, time.UTC)},
+			want:    []string{"2026-01-05 19:00 GMT", "2026-01-19 19:00 GMT"},
+		},
+		{
+			name:    "second Tuesday of the month",
+			rrule:   "FREQ=MONTHLY;BYDAY=2TU;COUNT=4",
+			dtstart: at(2026, time.January, 13),
+			want:    []string{"2026-01-13 19:00 GMT", "2026-02-10 19:00 GMT", "2026-03-10 19:00 GMT", "2026-04-14 19:00 BST"},
+		},
+		{
+			name:    "last Friday of the month",
+			rrule:   "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: at(2026, time.January, 1),
+			want:    []string{"2026-01-30 19:00 GMT", "2026-02-27 19:00 GMT", "2026-03-27 19:00 GMT"},
+		},
+		{
+			name:    "last weekday of the month",
+			rrule:   "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=3",
+			dtstart: at(2026, time.January, 1),
+			want:    []string{"2026-01-30 19:00 GMT", "2026-02-27 19:00 GMT", "2026-03-31 19:00 BST"},
+		},
+		{
+			name:    "last day of the month",
+			rrule:   "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3",
+			dtstart: at(2026, time.January, 31),
+			want:    []string{"2026-01-31 19:00 GMT", "2026-02-28 19:00 GMT", "2026-03-31 19:00 BST"},
+		},
+		{
+			name:    "monthly on the 31st skips shorter months",
+			rrule:   "FREQ=MONTHLY;COUNT=3",
+			dtstart: at(2026, time.January, 31),
+			want:    []string{"2026-01-31 19:00 GMT", "2026-03-31 19:00 BST", "2026-05-31 19:00 BST"},
+		},
+		{
+			name:    "quarterly until a date",
+			rrule:   "FREQ=MONTHLY;INTERVAL=3;UNTIL=20261231",
+			dtstart: at(2026, time.February, 15),
+			want:    []string{"2026-02-15 19:00 GMT", "2026-05-15 19:00 BST", "2026-08-15 19:00 BST", "2026-11-15 19:00 GMT"},
+		},
+		{
+			name:    "yearly on the day of DTSTART",
+			rrule:   "FREQ=YEARLY;COUNT=3",
+			dtstart: at(2026, time.May, 4),
+			want:    []string{"2026-05-04 19:00 BST", "2027-05-04 19:00 BST", "2028-05-04 19:00 BST"},
+		},
+		{
+			name:    "yearly on the last Sunday of March and September",
+			rrule:   "FREQ=YEARLY;BYMONTH=3,9;BYDAY=-1SU;COUNT=4",
+			dtstart: at(2026, time.January, 1),
+			want:    []string{"2026-03-29 19:00 BST", "2026-09-27 19:00 BST", "2027-03-28 19:00 BST", "2027-09-26 19:00 BST"},
+		},
+		{
+			name:    "yearly BYDAY ordinals count within the year",
+			rrule:   "FREQ=YEARLY;BYDAY=20MO;COUNT=3",
+			dtstart: at(2026, time.January, 1),
+			want:    []string{"2026-05-18 19:00 BST", "2027-05-17 19:00 BST", "2028-05-15 19:00 BST"},
+		},
+		{
+			name:    "last Friday of the year",
+			rrule:   "FREQ=YEARLY;BYDAY=-1FR;COUNT=2",
+			dtstart: at(2026, time.January, 1),
+			want:    []string{"2026-12-25 19:00 GMT", "2027-12-31 19:00 GMT"},
+		},
+		{
+			name:    "yearly BYMONTHDAY applies to every month",
+			rrule:   "FREQ=YEARLY;BYMONTHDAY=1;COUNT=3",
+			dtstart: at(2026, time.January, 1),
+			want:    []string{"2026-01-01 19:00 GMT", "2026-02-01 19:00 GMT", "2026-03-01 19:00 GMT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rrule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rrule, err)
+			}
+			occurrences, err := rule.Expand(tt.dtstart, tt.exdates)
+			if err != nil {
+				t.Fatalf("Expand: %v", err)
+			}
+
+			var got []string
+			for _, occurrence := range occurrences {
+				got = append(got, occurrence.Format("2006-01-02 15:04 MST"))
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("Expand(%q) = %v, want %v", tt.rrule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		rrule string
+	}{
+		{"no end", "FREQ=WEEKLY"},
+		{"COUNT and UNTIL", "FREQ=WEEKLY;COUNT=3;UNTIL=20261231"},
+		{"too many occurrences", "FREQ=DAILY;COUNT=367"},
+		{"unknown frequency", "FREQ=HOURLY;COUNT=3"},
+		{"BYDAY ordinal with WEEKLY", "FREQ=WEEKLY;BYDAY=2TU;COUNT=3"},
+		{"BYMONTHDAY with WEEKLY", "FREQ=WEEKLY;BYMONTHDAY=15;COUNT=3"},
+		{"part given twice", "FREQ=WEEKLY;COUNT=3;COUNT=4"},
+		{"zero ordinal", "FREQ=MONTHLY;BYDAY=0TU;COUNT=3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rule, err := Parse(tt.rrule); err == nil {
+				t.Errorf("Parse(%q) = %v, want an error", tt.rrule, rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,1630 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryDBRepo keeps everything in memory with the same semantics as PostgresDBRepo.
+// It is meant for tests and demos, all data is lost when the process exits.
+type MemoryDBRepo struct {
+	mu sync.Mutex
+
+	users      []*models.User
+	facilities []*models.Facility
+	requested  []*memoryBooking
+	approved   []*memoryBooking
+	recurring  []*memoryBooking
+	series     []*models.BookingSeries
+	invites    []*models.InviteCode
+	// refresh tokens are kept with the hash in Token, like the token_hash column
+	refreshTokens []*models.RefreshToken
+	// password resets are kept with the hash in Token as well
+	passwordResets []*models.PasswordReset
+	loginAttempts  []*models.LoginAttempt
+	loginThrottles map[string]*models.LoginThrottle
+	mfa            map[string]*models.UserMFA
+	// recovery codes are kept by username, hashed like the code_hash column
+	recoveryCodes map[string][]*memoryRecoveryCode
+	identities    []*models.UserIdentity
+	// single sign-ons in progress are kept by the hash of their state
+	oidcLogins map[string]*models.OIDCLogin
+	apiKeys    []*memoryAPIKey
+
+	// one sequence per table, like the SERIAL columns in Postgres
+	nextUserID      int
+	nextFacilityID  int
+	nextRequestedID int
+	nextApprovedID  int
+	nextRecurringID int
+	nextSeriesID    int
+	nextInviteID    int
+	nextRefreshID   int
+	nextResetID     int
+	nextAttemptID   int
+	nextIdentityID  int
+	nextAPIKeyID    int
+}
+
+// memoryBooking is a row of one of the booking tables
+type memoryBooking struct {
+	ID             int
+	Username       string
+	Name           string
+	UnitNumber     string
+	StartDate      time.Time
+	EndDate        time.Time
+	StartTime      time.Time
+	EndTime        time.Time
+	Purpose        string
+	Facility       string
+	Recurring      bool
+	RecurringWeeks int
+	RRule          string
+	ExDates        []time.Time
+	TimeZone       string
+	SeriesID       int
+	OriginalStart  time.Time
+}
+
+// memoryRecoveryCode is a stored recovery code, Hash is its SHA-256 like the code_hash column
+type memoryRecoveryCode struct {
+	Hash   string
+	UsedAt *time.Time
+}
+
+// memoryAPIKey is a stored API key, Hash is its SHA-256 like the key_hash column
+type memoryAPIKey struct {
+	models.APIKey
+	Hash string
+}
+
+func NewMemoryDBRepo() *MemoryDBRepo {
+	return &MemoryDBRepo{}
+}
+
+// Connection returns nil, there is no database behind the memory store
+func (m *MemoryDBRepo) Connection() *sql.DB {
+	return nil
+}
+
+// toDate drops the time of day like a Postgres DATE column does
+func toDate(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// formatTimestamp renders a timestamp the way database/sql scans a timestamptz into a string
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (b *memoryBooking) submitted() *models.SubmittedBooking {
+	var seriesID *int
+	if b.SeriesID != 0 {
+		id := b.SeriesID
+		seriesID = &id
+	}
+
+	return &models.SubmittedBooking{
+		ID:         b.ID,
+		Username:   b.Username,
+		Name:       b.Name,
+		UnitNumber: b.UnitNumber,
+		StartDate:  b.StartDate,
+		EndDate:    b.EndDate,
+		StartTime:  formatTimestamp(b.StartTime),
+		EndTime:    formatTimestamp(b.EndTime),
+		Purpose:    b.Purpose,
+		Facility:   b.Facility,
+		SeriesID:   seriesID,
+	}
+}
+
+func (b *memoryBooking) requested() *models.RequestedBooking {
+	return &models.RequestedBooking{
+		ID:             b.ID,
+		Username:       b.Username,
+		Name:           b.Name,
+		UnitNumber:     b.UnitNumber,
+		StartDate:      b.StartDate,
+		EndDate:        b.EndDate,
+		StartTime:      formatTimestamp(b.StartTime),
+		EndTime:        formatTimestamp(b.EndTime),
+		Purpose:        b.Purpose,
+		Facility:       b.Facility,
+		Recurring:      b.Recurring,
+		RecurringWeeks: b.RecurringWeeks,
+		RRule:          b.RRule,
+		ExDates:        b.ExDates,
+		TimeZone:       b.TimeZone,
+	}
+}
+
+// sortedBookings orders bookings by start_date ASC, start_time ASC and applies keep as a filter
+func sortedBookings(bookings []*memoryBooking, keep func(*memoryBooking) bool) []*memoryBooking {
+	var result []*memoryBooking
+	for _, b := range bookings {
+		if keep == nil || keep(b) {
+			result = append(result, b)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if !result[i].StartDate.Equal(result[j].StartDate) {
+			return result[i].StartDate.Before(result[j].StartDate)
+		}
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+
+	return result
+}
+
+func submittedList(bookings []*memoryBooking) []*models.SubmittedBooking {
+	var result []*models.SubmittedBooking
+	for _, b := range bookings {
+		result = append(result, b.submitted())
+	}
+	return result
+}
+
+func requestedList(bookings []*memoryBooking) []*models.RequestedBooking {
+	var result []*models.RequestedBooking
+	for _, b := range bookings {
+		result = append(result, b.requested())
+	}
+	return result
+}
+
+func (m *MemoryDBRepo) AllBookings() ([]*models.SubmittedBooking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return submittedList(sortedBookings(m.approved, nil)), nil
+}
+
+func (m *MemoryDBRepo) TwoWeekBookings() ([]*models.SubmittedBooking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// date_trunc('week', current_date) is the Monday of the current week
+	today := toDate(time.Now())
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	weekEnd := weekStart.AddDate(0, 0, 14)
+
+	inWindow := func(b *memoryBooking) bool {
+		return !b.StartDate.Before(weekStart) && b.EndDate.Before(weekEnd)
+	}
+
+	all := append(sortedBookings(m.approved, inWindow), sortedBookings(m.recurring, inWindow)...)
+	return submittedList(sortedBookings(all, nil)), nil
+}
+
+func (m *MemoryDBRepo) AdminBookings() ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return submittedList(sortedBookings(m.recurring, nil)),
+		submittedList(sortedBookings(m.approved, nil)),
+		requestedList(sortedBookings(m.requested, nil)),
+		nil
+}
+
+func (m *MemoryDBRepo) UserBookings(username string) ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	owned := func(b *memoryBooking) bool {
+		return b.Username == username
+	}
+
+	return submittedList(sortedBookings(m.recurring, owned)),
+		submittedList(sortedBookings(m.approved, owned)),
+		requestedList(sortedBookings(m.requested, owned)),
+		nil
+}
+
+// findOverlap mirrors PostgresDBRepo.findOverlap, the caller must hold the lock
+func (m *MemoryDBRepo) findOverlap(facility string, start, end time.Time) *models.BookingConflict {
+	return m.findOverlapExcept(facility, start, end, nil)
+}
+
+// findOverlapExcept is findOverlap ignoring the booking being moved
+func (m *MemoryDBRepo) findOverlapExcept(facility string, start, end time.Time, except *memoryBooking) *models.BookingConflict {
+	var found *models.BookingConflict
+
+	check := func(kind string, bookings []*memoryBooking) {
+		for _, b := range bookings {
+			if b == except || b.Facility != facility || !start.Before(b.EndTime) || !end.After(b.StartTime) {
+				continue
+			}
+			if found == nil || b.StartTime.Before(found.StartTime) {
+				found = &models.BookingConflict{
+					BookingID: b.ID,
+					Kind:      kind,
+					Facility:  b.Facility,
+					StartTime: b.StartTime,
+					EndTime:   b.EndTime,
+				}
+			}
+		}
+	}
+	check("approved", m.approved)
+	check("recurring", m.recurring)
+
+	return found
+}
+
+func (m *MemoryDBRepo) checkOverlap(facility string, start, end time.Time) error {
+	conflict := m.findOverlap(facility, start, end)
+	if conflict != nil {
+		return &repository.ConflictError{Conflict: *conflict}
+	}
+	return nil
+}
+
+func (m *MemoryDBRepo) InsertBookingRequest(booking models.Booking) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// only active facilities in the catalogue can be booked
+	facility, err := m.facilityByName(booking.Facility)
+	if err != nil {
+		return err
+	}
+	if !facility.Active {
+		return repository.ErrFacilityArchived
+	}
+
+	startTime, endTime, err := parseBookingTimes(booking.StartTime, booking.EndTime)
+	if err != nil {
+		return err
+	}
+
+	// the booking has to respect the facility's opening hours and booking window
+	err = facility.Rules.Check(startTime, endTime, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// a recurring request must have a rule that expands to a bounded series
+	err = normaliseRecurrence(&booking, facility)
+	if err != nil {
+		return err
+	}
+
+	// check for overlaps with bookings of the same facility
+	err = m.checkOverlap(booking.Facility, startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.userByName(booking.Username); err != nil {
+		return errors.New("booking username does not exist")
+	}
+
+	m.nextRequestedID++
+	m.requested = append(m.requested, &memoryBooking{
+		ID:             m.nextRequestedID,
+		Username:       booking.Username,
+		Name:           booking.Name,
+		UnitNumber:     booking.UnitNumber,
+		StartDate:      toDate(booking.StartDate),
+		EndDate:        toDate(booking.EndDate),
+		StartTime:      startTime,
+		EndTime:        endTime,
+		Purpose:        booking.Purpose,
+		Facility:       booking.Facility,
+		Recurring:      booking.Recurring,
+		RecurringWeeks: booking.RecurringWeeks,
+		RRule:          booking.RRule,
+		ExDates:        booking.ExDates,
+		TimeZone:       booking.TimeZone,
+	})
+
+	return nil
+}
+
+func (m *MemoryDBRepo) ApproveBookingRequest(booking models.RequestedBooking) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	facility, err := m.facilityByName(booking.Facility)
+	if err != nil {
+		return err
+	}
+
+	startTime, endTime, err := parseBookingTimes(booking.StartTime, booking.EndTime)
+	if err != nil {
+		return err
+	}
+
+	// the facility's rules may have changed since the booking was requested
+	err = facility.Rules.CheckSlot(startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	err = m.checkOverlap(booking.Facility, startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	index := m.requestIndex(booking.ID)
+	if index < 0 {
+		return repository.ErrBookingRequestNotFound
+	}
+	request := m.requested[index]
+
+	// Copy the booking from requested to approved
+	m.nextApprovedID++
+	approved := *request
+	approved.ID = m.nextApprovedID
+	approved.Recurring = false
+	approved.RecurringWeeks = 0
+	approved.RRule = ""
+	approved.ExDates = nil
+	approved.TimeZone = ""
+	m.approved = append(m.approved, &approved)
+
+	m.requested = append(m.requested[:index], m.requested[index+1:]...)
+
+	return nil
+}
+
+func (m *MemoryDBRepo) ApproveRecurringBookingRequest(booking models.RequestedBooking, failOnConflict bool) (*models.ApprovalReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	facility, err := m.facilityByName(booking.Facility)
+	if err != nil {
+		return nil, err
+	}
+
+	index := m.requestIndex(booking.ID)
+	if index < 0 {
+		return nil, repository.ErrBookingRequestNotFound
+	}
+
+	series, occurrences, err := newSeries(booking, facility)
+	if err != nil {
+		return nil, err
+	}
+
+	// every occurrence has to respect the facility's current rules
+	for _, occurrence := range occurrences {
+		err = facility.Rules.CheckSlot(occurrence.StartTime, occurrence.EndTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// check every occurrence first so a failed approval leaves nothing behind
+	if failOnConflict {
+		for _, occurrence := range occurrences {
+			conflict := m.findOverlap(booking.Facility, occurrence.StartTime, occurrence.EndTime)
+			if conflict != nil {
+				return nil, &repository.ConflictError{Conflict: *conflict}
+			}
+		}
+	}
+
+	m.nextSeriesID++
+	series.ID = m.nextSeriesID
+	m.series = append(m.series, series)
+
+	// occurrences overlapping an existing booking are skipped
+	report := &models.ApprovalReport{SeriesID: series.ID}
+	for _, occurrence := range occurrences {
+		result := models.OccurrenceResult{
+			StartTime: occurrence.StartTime,
+			EndTime:   occurrence.EndTime,
+		}
+
+		conflict := m.findOverlap(booking.Facility, occurrence.StartTime, occurrence.EndTime)
+		if conflict != nil {
+			result.Status = models.OccurrenceSkipped
+			result.Conflict = conflict
+			report.Add(result)
+			continue
+		}
+
+		m.nextRecurringID++
+		m.recurring = append(m.recurring, &memoryBooking{
+			ID:            m.nextRecurringID,
+			Username:      booking.Username,
+			Name:          booking.Name,
+			UnitNumber:    booking.UnitNumber,
+			StartDate:     occurrence.StartDate,
+			EndDate:       occurrence.EndDate,
+			StartTime:     occurrence.StartTime,
+			EndTime:       occurrence.EndTime,
+			Purpose:       booking.Purpose,
+			Facility:      booking.Facility,
+			SeriesID:      series.ID,
+			OriginalStart: occurrence.StartTime,
+		})
+
+		result.Status = models.OccurrenceCreated
+		result.BookingID = m.nextRecurringID
+		report.Add(result)
+	}
+
+	m.requested = append(m.requested[:index], m.requested[index+1:]...)
+
+	return report, nil
+}
+
+func (m *MemoryDBRepo) GetBookingSeries(id int) (*models.BookingSeries, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.series {
+		if stored.ID != id {
+			continue
+		}
+
+		series := *stored
+		occurrences := sortedBookings(m.recurring, func(b *memoryBooking) bool {
+			return b.SeriesID == id
+		})
+		series.Occurrences = submittedList(occurrences)
+		return &series, nil
+	}
+
+	return nil, repository.ErrBookingSeriesNotFound
+}
+
+// seriesForChange returns the stored series with its occurrences and facility, the caller must hold the lock
+func (m *MemoryDBRepo) seriesForChange(id int) (*models.BookingSeries, []storedOccurrence, *models.Facility, error) {
+	for _, series := range m.series {
+		if series.ID != id {
+			continue
+		}
+
+		var occurrences []storedOccurrence
+		for _, b := range m.recurring {
+			if b.SeriesID == id {
+				occurrences = append(occurrences, storedOccurrence{
+					ID:            b.ID,
+					StartTime:     b.StartTime,
+					EndTime:       b.EndTime,
+					OriginalStart: b.OriginalStart,
+					Purpose:       b.Purpose,
+				})
+			}
+		}
+		sort.Slice(occurrences, func(i, j int) bool {
+			return occurrences[i].OriginalStart.Before(occurrences[j].OriginalStart)
+		})
+
+		facility, err := m.facilityByName(series.Facility)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return series, occurrences, facility, nil
+	}
+
+	return nil, nil, nil, repository.ErrBookingSeriesNotFound
+}
+
+// deleteSeries removes a series with its occurrences, the caller must hold the lock
+func (m *MemoryDBRepo) deleteSeries(id int) bool {
+	found := false
+	var series []*models.BookingSeries
+	for _, s := range m.series {
+		if s.ID == id {
+			found = true
+			continue
+		}
+		series = append(series, s)
+	}
+	m.series = series
+
+	var recurring []*memoryBooking
+	for _, b := range m.recurring {
+		if b.SeriesID != id {
+			recurring = append(recurring, b)
+		}
+	}
+	m.recurring = recurring
+
+	return found
+}
+
+// applySeriesPlan writes a planned change of the series with the given id, the caller
+// must hold the lock. Nothing is changed if a moved occurrence overlaps another booking.
+func (m *MemoryDBRepo) applySeriesPlan(id int, plan *seriesPlan) error {
+	if plan.Series == nil {
+		m.deleteSeries(id)
+		return nil
+	}
+
+	deleted := map[int]bool{}
+	for _, occurrenceID := range plan.Deleted {
+		deleted[occurrenceID] = true
+	}
+
+	// work on copies so a conflict leaves the stored bookings untouched
+	var recurring []*memoryBooking
+	byID := map[int]*memoryBooking{}
+	for _, b := range m.recurring {
+		if deleted[b.ID] {
+			continue
+		}
+		copied := *b
+		recurring = append(recurring, &copied)
+		byID[b.ID] = &copied
+	}
+
+	owner := id
+	if plan.Split != nil {
+		owner = m.nextSeriesID + 1
+	}
+
+	stored := m.recurring
+	m.recurring = recurring
+	for _, slot := range plan.Moved {
+		b := byID[slot.ID]
+		b.StartDate = slot.StartDate
+		b.EndDate = slot.EndDate
+		b.StartTime = slot.StartTime
+		b.EndTime = slot.EndTime
+		b.Purpose = slot.Purpose
+		b.SeriesID = owner
+
+		conflict := m.findOverlapExcept(b.Facility, b.StartTime, b.EndTime, b)
+		if conflict != nil {
+			m.recurring = stored
+			return &repository.ConflictError{Conflict: *conflict}
+		}
+	}
+
+	for _, series := range m.series {
+		if series.ID == id {
+			*series = *plan.Series
+		}
+	}
+	if plan.Split != nil {
+		m.nextSeriesID++
+		plan.Split.ID = m.nextSeriesID
+		m.series = append(m.series, plan.Split)
+	}
+
+	return nil
+}
+
+func (m *MemoryDBRepo) UpdateSeriesOccurrence(change models.OccurrenceChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, occurrences, facility, err := m.seriesForChange(change.SeriesID)
+	if err != nil {
+		return err
+	}
+
+	plan, err := planSeriesUpdate(series, occurrences, change, facility, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return m.applySeriesPlan(series.ID, plan)
+}
+
+func (m *MemoryDBRepo) CancelSeriesOccurrence(change models.OccurrenceChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, occurrences, _, err := m.seriesForChange(change.SeriesID)
+	if err != nil {
+		return err
+	}
+
+	plan, err := planSeriesCancel(series, occurrences, change)
+	if err != nil {
+		return err
+	}
+
+	return m.applySeriesPlan(series.ID, plan)
+}
+
+func (m *MemoryDBRepo) DeleteBookingSeries(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.deleteSeries(id) {
+		return repository.ErrBookingSeriesNotFound
+	}
+	return nil
+}
+
+func (m *MemoryDBRepo) requestIndex(id int) int {
+	for i, b := range m.requested {
+		if b.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// bookingByID returns the booking with the given id, or nil, the caller must hold the lock
+func bookingByID(bookings []*memoryBooking, id int) *memoryBooking {
+	for _, b := range bookings {
+		if b.ID == id {
+			return b
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDBRepo) GetBookingRequest(id int) (*models.RequestedBooking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := bookingByID(m.requested, id)
+	if b == nil {
+		return nil, repository.ErrBookingRequestNotFound
+	}
+	return b.requested(), nil
+}
+
+func (m *MemoryDBRepo) GetApprovedBooking(id int) (*models.SubmittedBooking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := bookingByID(m.approved, id)
+	if b == nil {
+		return nil, repository.ErrBookingNotFound
+	}
+	return b.submitted(), nil
+}
+
+func (m *MemoryDBRepo) GetRecurringBooking(id int) (*models.SubmittedBooking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := bookingByID(m.recurring, id)
+	if b == nil {
+		return nil, repository.ErrBookingNotFound
+	}
+	return b.submitted(), nil
+}
+
+// removeBooking deletes the booking with the given id, if any
+func removeBooking(bookings []*memoryBooking, id int) []*memoryBooking {
+	for i, b := range bookings {
+		if b.ID == id {
+			return append(bookings[:i], bookings[i+1:]...)
+		}
+	}
+	return bookings
+}
+
+func (m *MemoryDBRepo) DeleteBookingRequest(booking models.RequestedBooking) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requested = removeBooking(m.requested, booking.ID)
+	return nil
+}
+
+func (m *MemoryDBRepo) DeleteApprovedBooking(booking models.SubmittedBooking) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.approved = removeBooking(m.approved, booking.ID)
+	return nil
+}
+
+func (m *MemoryDBRepo) DeleteRecurringBooking(booking models.SubmittedBooking) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recurring = removeBooking(m.recurring, booking.ID)
+	return nil
+}
+
+// userByName returns the stored user, the caller must hold the lock
+func (m *MemoryDBRepo) userByName(username string) (*models.User, error) {
+	for _, user := range m.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryDBRepo) GetUserByName(username string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, err := m.userByName(username)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+// RegisterUser creates a resident with the unit number of the invite code, which is
+// used up by the registration
+func (m *MemoryDBRepo) RegisterUser(username string, passwordHash string, inviteCode string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var invite *models.InviteCode
+	codeHash := hashSecret(inviteCode)
+	for _, candidate := range m.invites {
+		if candidate.Code == codeHash && candidate.UsedAt == nil && candidate.ExpiresAt.After(now) {
+			invite = candidate
+			break
+		}
+	}
+	if invite == nil {
+		return nil, repository.ErrInvalidInviteCode
+	}
+
+	if _, err := m.userByName(username); err == nil {
+		return nil, repository.ErrDuplicateUsername
+	}
+
+	invite.UsedBy = username
+	invite.UsedAt = &now
+
+	m.nextUserID++
+	m.users = append(m.users, &models.User{
+		ID:         m.nextUserID,
+		Username:   username,
+		Password:   passwordHash,
+		Role:       models.RoleResident,
+		UnitNumber: invite.UnitNumber,
+	})
+
+	var user models.User = models.User{
+		ID:         m.nextUserID,
+		Username:   username,
+		Password:   passwordHash,
+		Role:       models.RoleResident,
+		UnitNumber: invite.UnitNumber,
+	}
+
+	return &user, nil
+}
+
+// UpdateUserRole promotes or demotes a user
+func (m *MemoryDBRepo) UpdateUserRole(username string, role models.Role) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, err := m.userByName(username)
+	if err != nil {
+		return repository.ErrUserNotFound
+	}
+
+	user.Role = role
+	return nil
+}
+
+// GetUserByIdentity returns the user linked to a subject of an identity provider,
+// ErrUserNotFound if there is none
+func (m *MemoryDBRepo) GetUserByIdentity(issuer string, subject string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, identity := range m.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			user, err := m.userByName(identity.Username)
+			if err != nil {
+				return nil, repository.ErrUserNotFound
+			}
+			copied := *user
+			return &copied, nil
+		}
+	}
+
+	return nil, repository.ErrUserNotFound
+}
+
+// InsertUserIdentity links an identity provider account to an existing user. It
+// returns ErrDuplicateIdentity if the account is already linked.
+func (m *MemoryDBRepo) InsertUserIdentity(identity models.UserIdentity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.userByName(identity.Username); err != nil {
+		return repository.ErrUserNotFound
+	}
+
+	return m.insertUserIdentity(identity)
+}
+
+// insertUserIdentity stores a copy of identity, the caller must hold the lock
+func (m *MemoryDBRepo) insertUserIdentity(identity models.UserIdentity) error {
+	for _, existing := range m.identities {
+		if existing.Issuer == identity.Issuer && existing.Subject == identity.Subject {
+			return repository.ErrDuplicateIdentity
+		}
+	}
+
+	m.nextIdentityID++
+	identity.ID = m.nextIdentityID
+	identity.CreatedAt = time.Now()
+	m.identities = append(m.identities, &identity)
+	return nil
+}
+
+// ProvisionIdentityUser creates a resident named identity.Username for the first
+// single sign-on of an identity. Provisioned users have no password.
+func (m *MemoryDBRepo) ProvisionIdentityUser(identity models.UserIdentity, unitNumber string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.userByName(identity.Username); err == nil {
+		return nil, repository.ErrDuplicateUsername
+	}
+
+	err := m.insertUserIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	m.nextUserID++
+	m.users = append(m.users, &models.User{
+		ID:         m.nextUserID,
+		Username:   identity.Username,
+		Role:       models.RoleResident,
+		UnitNumber: unitNumber,
+	})
+
+	var user models.User = models.User{
+		ID:         m.nextUserID,
+		Username:   identity.Username,
+		Role:       models.RoleResident,
+		UnitNumber: unitNumber,
+	}
+
+	return &user, nil
+}
+
+// InsertOIDCLogin stores the state, nonce and PKCE verifier of a single sign-on
+// until the identity provider redirects back
+func (m *MemoryDBRepo) InsertOIDCLogin(login models.OIDCLogin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if m.oidcLogins == nil {
+		m.oidcLogins = map[string]*models.OIDCLogin{}
+	}
+	for stateHash, existing := range m.oidcLogins {
+		if !existing.ExpiresAt.After(now) {
+			delete(m.oidcLogins, stateHash)
+		}
+	}
+
+	stateHash := hashSecret(login.State)
+	login.State = ""
+	login.CreatedAt = now
+	m.oidcLogins[stateHash] = &login
+	return nil
+}
+
+// TakeOIDCLogin uses up the single sign-on with the state, ErrInvalidOIDCState if it
+// is unknown, expired or already completed
+func (m *MemoryDBRepo) TakeOIDCLogin(state string) (*models.OIDCLogin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stateHash := hashSecret(state)
+	login, ok := m.oidcLogins[stateHash]
+	if !ok {
+		return nil, repository.ErrInvalidOIDCState
+	}
+	delete(m.oidcLogins, stateHash)
+	if !login.ExpiresAt.After(time.Now()) {
+		return nil, repository.ErrInvalidOIDCState
+	}
+
+	copied := *login
+	copied.State = state
+	return &copied, nil
+}
+
+// InsertInviteCode stores the hash of a new invite code and returns its id
+func (m *MemoryDBRepo) InsertInviteCode(invite models.InviteCode) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextInviteID++
+	invite.ID = m.nextInviteID
+	// like the code_hash column, the plain code is never kept
+	invite.Code = hashSecret(invite.Code)
+	invite.CreatedAt = time.Now()
+	m.invites = append(m.invites, &invite)
+
+	return invite.ID, nil
+}
+
+// InsertRefreshToken stores the first refresh token of a new family
+func (m *MemoryDBRepo) InsertRefreshToken(token models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token.CreatedAt = time.Now()
+	token.StartedAt = token.CreatedAt
+	m.insertRefreshToken(token)
+	return nil
+}
+
+// insertRefreshToken stores a copy of token with its hash, the caller must hold the lock
+func (m *MemoryDBRepo) insertRefreshToken(token models.RefreshToken) {
+	m.nextRefreshID++
+	token.ID = m.nextRefreshID
+	token.Token = hashSecret(token.Token)
+	token.UserAgent = truncate(token.UserAgent, maxUserAgentLength)
+	m.refreshTokens = append(m.refreshTokens, &token)
+}
+
+// RotateRefreshToken uses up a refresh token and stores next in its family for the same
+// user. Replaying a token that was already used revokes the whole family and returns
+// ErrRefreshTokenReused.
+func (m *MemoryDBRepo) RotateRefreshToken(token string, next models.RefreshToken) (*models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var current *models.RefreshToken
+	tokenHash := hashSecret(token)
+	for _, candidate := range m.refreshTokens {
+		if candidate.Token == tokenHash {
+			current = candidate
+			break
+		}
+	}
+	if current == nil || current.RevokedAt != nil || !current.ExpiresAt.After(now) {
+		return nil, repository.ErrInvalidRefreshToken
+	}
+
+	if current.UsedAt != nil {
+		m.revokeFamily(current.FamilyID, now)
+		return nil, repository.ErrRefreshTokenReused
+	}
+
+	current.UsedAt = &now
+
+	next.FamilyID = current.FamilyID
+	next.Username = current.Username
+	next.MFA = current.MFA
+	next.StartedAt = current.StartedAt
+	next.CreatedAt = now
+	m.insertRefreshToken(next)
+
+	return &next, nil
+}
+
+// revokeFamily revokes every token of a family, the caller must hold the lock
+func (m *MemoryDBRepo) revokeFamily(familyID string, now time.Time) {
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			revokedAt := now
+			t.RevokedAt = &revokedAt
+		}
+	}
+}
+
+// activeRefreshToken reports whether a token is the one its session refreshes with next
+func activeRefreshToken(t *models.RefreshToken, now time.Time) bool {
+	return t.UsedAt == nil && t.RevokedAt == nil && t.ExpiresAt.After(now)
+}
+
+// UserSessions returns the active sessions of a user, the most recently used first
+func (m *MemoryDBRepo) UserSessions(username string) ([]*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessions := []*models.Session{}
+	// tokens are appended as they are issued, so walking backwards lists recent ones first
+	for i := len(m.refreshTokens) - 1; i >= 0; i-- {
+		t := m.refreshTokens[i]
+		if t.Username != username || !activeRefreshToken(t, now) {
+			continue
+		}
+		sessions = append(sessions, &models.Session{
+			ID:         t.FamilyID,
+			Username:   t.Username,
+			UserAgent:  t.UserAgent,
+			IPAddress:  t.IPAddress,
+			MFA:        t.MFA,
+			CreatedAt:  t.StartedAt,
+			LastUsedAt: t.CreatedAt,
+			ExpiresAt:  t.ExpiresAt,
+		})
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends a session of a user. It returns ErrSessionNotFound if the user
+// has no active session with the id.
+func (m *MemoryDBRepo) RevokeSession(username string, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == sessionID && t.Username == username && activeRefreshToken(t, now) {
+			m.revokeFamily(sessionID, now)
+			return nil
+		}
+	}
+
+	return repository.ErrSessionNotFound
+}
+
+// RevokeUserSessions ends every session of a user except keepSessionID, which may be
+// empty to end them all
+func (m *MemoryDBRepo) RevokeUserSessions(username string, keepSessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range m.refreshTokens {
+		if t.Username == username && t.FamilyID != keepSessionID && t.RevokedAt == nil {
+			revokedAt := now
+			t.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// SessionActive reports whether the user has an active session with the id, so access
+// tokens of a session that was signed out can be rejected
+func (m *MemoryDBRepo) SessionActive(username string, sessionID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == sessionID && t.Username == username && activeRefreshToken(t, now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RevokeRefreshToken revokes the family of a refresh token, ending its session.
+// Unknown and already revoked tokens are ignored.
+func (m *MemoryDBRepo) RevokeRefreshToken(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokenHash := hashSecret(token)
+	for _, t := range m.refreshTokens {
+		if t.Token == tokenHash {
+			m.revokeFamily(t.FamilyID, time.Now())
+			break
+		}
+	}
+	return nil
+}
+
+// revokeUserTokens revokes every refresh token of a user, the caller must hold the lock
+func (m *MemoryDBRepo) revokeUserTokens(username string, now time.Time) {
+	for _, t := range m.refreshTokens {
+		if t.Username == username && t.RevokedAt == nil {
+			revokedAt := now
+			t.RevokedAt = &revokedAt
+		}
+	}
+}
+
+// UpdatePassword sets a new password and revokes the user's refresh tokens, signing
+// them out everywhere
+func (m *MemoryDBRepo) UpdatePassword(username string, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, err := m.userByName(username)
+	if err != nil {
+		return repository.ErrUserNotFound
+	}
+
+	user.Password = passwordHash
+	m.revokeUserTokens(username, time.Now())
+	return nil
+}
+
+// RehashPassword replaces the stored hash of an unchanged password, e.g. after the
+// bcrypt cost was raised. Unlike UpdatePassword it keeps the user's sessions.
+func (m *MemoryDBRepo) RehashPassword(username string, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, err := m.userByName(username)
+	if err != nil {
+		return repository.ErrUserNotFound
+	}
+
+	user.Password = passwordHash
+	return nil
+}
+
+// InsertPasswordReset stores the hash of a new reset token. Earlier unused tokens of
+// the user are used up so only the latest one works.
+func (m *MemoryDBRepo) InsertPasswordReset(reset models.PasswordReset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, r := range m.passwordResets {
+		if r.Username == reset.Username && r.UsedAt == nil {
+			usedAt := now
+			r.UsedAt = &usedAt
+		}
+	}
+
+	m.nextResetID++
+	reset.ID = m.nextResetID
+	reset.Token = hashSecret(reset.Token)
+	reset.CreatedAt = now
+	m.passwordResets = append(m.passwordResets, &reset)
+
+	return nil
+}
+
+// ResetPassword uses up a reset token, sets the password of its user and revokes the
+// user's refresh tokens
+func (m *MemoryDBRepo) ResetPassword(token string, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var reset *models.PasswordReset
+	tokenHash := hashSecret(token)
+	for _, candidate := range m.passwordResets {
+		if candidate.Token == tokenHash && candidate.UsedAt == nil && candidate.ExpiresAt.After(now) {
+			reset = candidate
+			break
+		}
+	}
+	if reset == nil {
+		return repository.ErrInvalidResetToken
+	}
+
+	user, err := m.userByName(reset.Username)
+	if err != nil {
+		return repository.ErrInvalidResetToken
+	}
+
+	reset.UsedAt = &now
+	user.Password = passwordHash
+	m.revokeUserTokens(user.Username, now)
+	return nil
+}
+
+// RecordLoginAttempt adds a sign in attempt to the audit trail
+func (m *MemoryDBRepo) RecordLoginAttempt(attempt models.LoginAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextAttemptID++
+	attempt.ID = m.nextAttemptID
+	attempt.AttemptedAt = time.Now()
+	m.loginAttempts = append(m.loginAttempts, &attempt)
+
+	return nil
+}
+
+// GetLoginThrottle returns the recent failures counted for key, none if it has no throttle
+func (m *MemoryDBRepo) GetLoginThrottle(key string) (*models.LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	throttle, ok := m.loginThrottles[key]
+	if !ok {
+		return &models.LoginThrottle{Key: key}, nil
+	}
+
+	copied := *throttle
+	return &copied, nil
+}
+
+// RecordLoginFailure counts a failed sign in for key. Failures older than window are
+// forgotten, the count starts over.
+func (m *MemoryDBRepo) RecordLoginFailure(key string, window time.Duration) (*models.LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.loginThrottles == nil {
+		m.loginThrottles = map[string]*models.LoginThrottle{}
+	}
+
+	now := time.Now()
+	throttle, ok := m.loginThrottles[key]
+	if !ok {
+		throttle = &models.LoginThrottle{Key: key}
+		m.loginThrottles[key] = throttle
+	}
+
+	if throttle.LastFailureAt.After(now.Add(-window)) {
+		throttle.Failures++
+	} else {
+		throttle.Failures = 1
+	}
+	throttle.LastFailureAt = now
+
+	copied := *throttle
+	return &copied, nil
+}
+
+// ReturnLoginFailure takes back one failure counted for key, for an attempt that was
+// counted before it was checked and turned out not to be a failure
+func (m *MemoryDBRepo) ReturnLoginFailure(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if throttle, ok := m.loginThrottles[key]; ok && throttle.Failures > 0 {
+		throttle.Failures--
+	}
+	return nil
+}
+
+// LockLogin rejects sign ins for key until the given time
+func (m *MemoryDBRepo) LockLogin(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if throttle, ok := m.loginThrottles[key]; ok {
+		throttle.LockedUntil = &until
+	}
+	return nil
+}
+
+// ClearLoginThrottle forgets the failures of key and lifts its lock
+func (m *MemoryDBRepo) ClearLoginThrottle(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loginThrottles, key)
+	return nil
+}
+
+// GetUserMFA returns the TOTP enrolment of a user, ErrMFANotEnrolled if there is none
+func (m *MemoryDBRepo) GetUserMFA(username string) (*models.UserMFA, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[username]
+	if !ok {
+		return nil, repository.ErrMFANotEnrolled
+	}
+
+	copied := *mfa
+	return &copied, nil
+}
+
+// BeginMFAEnrolment stores the secret of a new TOTP enrolment, replacing an unconfirmed
+// one. It returns ErrMFAAlreadyEnabled if the user already enabled TOTP.
+func (m *MemoryDBRepo) BeginMFAEnrolment(username string, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mfa, ok := m.mfa[username]; ok && mfa.Enabled() {
+		return repository.ErrMFAAlreadyEnabled
+	}
+
+	if m.mfa == nil {
+		m.mfa = map[string]*models.UserMFA{}
+	}
+	m.mfa[username] = &models.UserMFA{
+		Username:  username,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+// EnableMFA confirms the enrolment with the time step of the user's first code and
+// replaces their recovery codes
+func (m *MemoryDBRepo) EnableMFA(username string, step int64, recoveryCodes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[username]
+	if !ok || mfa.Enabled() {
+		return repository.ErrMFANotEnrolled
+	}
+
+	now := time.Now()
+	mfa.EnabledAt = &now
+	mfa.LastStep = step
+
+	if m.recoveryCodes == nil {
+		m.recoveryCodes = map[string][]*memoryRecoveryCode{}
+	}
+	codes := make([]*memoryRecoveryCode, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		codes = append(codes, &memoryRecoveryCode{Hash: hashSecret(code)})
+	}
+	m.recoveryCodes[username] = codes
+
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code. It returns ErrTOTPCodeReused
+// for a step that is not newer than the last accepted one, so a code cannot be replayed.
+func (m *MemoryDBRepo) UseTOTPStep(username string, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[username]
+	if !ok || !mfa.Enabled() || mfa.LastStep >= step {
+		return repository.ErrTOTPCodeReused
+	}
+
+	mfa.LastStep = step
+	return nil
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes
+func (m *MemoryDBRepo) UseRecoveryCode(username string, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codeHash := hashSecret(code)
+	for _, candidate := range m.recoveryCodes[username] {
+		if candidate.Hash == codeHash && candidate.UsedAt == nil {
+			now := time.Now()
+			candidate.UsedAt = &now
+			return nil
+		}
+	}
+	return repository.ErrInvalidRecoveryCode
+}
+
+// DisableMFA removes the user's TOTP enrolment and recovery codes
+func (m *MemoryDBRepo) DisableMFA(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mfa, username)
+	delete(m.recoveryCodes, username)
+	return nil
+}
+
+// copyFacility returns a deep copy so callers cannot modify the stored facility
+func copyFacility(facility *models.Facility) *models.Facility {
+	copied := *facility
+	copied.Rules.OpeningHours = append([]models.OpeningHours{}, facility.Rules.OpeningHours...)
+	return &copied
+}
+
+// facilityByName returns the stored facility, the caller must hold the lock
+func (m *MemoryDBRepo) facilityByName(name string) (*models.Facility, error) {
+	for _, facility := range m.facilities {
+		if facility.Name == name {
+			return facility, nil
+		}
+	}
+	return nil, repository.ErrFacilityNotFound
+}
+
+func (m *MemoryDBRepo) facilityByID(id int) (*models.Facility, error) {
+	for _, facility := range m.facilities {
+		if facility.ID == id {
+			return facility, nil
+		}
+	}
+	return nil, repository.ErrFacilityNotFound
+}
+
+func (m *MemoryDBRepo) AllFacilities(includeArchived bool) ([]*models.Facility, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var facilities []*models.Facility
+	for _, facility := range m.facilities {
+		if facility.Active || includeArchived {
+			facilities = append(facilities, copyFacility(facility))
+		}
+	}
+
+	sort.Slice(facilities, func(i, j int) bool {
+		return facilities[i].Name < facilities[j].Name
+	})
+
+	return facilities, nil
+}
+
+func (m *MemoryDBRepo) GetFacilityByID(id int) (*models.Facility, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	facility, err := m.facilityByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyFacility(facility), nil
+}
+
+func (m *MemoryDBRepo) GetFacilityByName(name string) (*models.Facility, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	facility, err := m.facilityByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyFacility(facility), nil
+}
+
+func (m *MemoryDBRepo) InsertFacility(facility models.Facility) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.facilityByName(facility.Name); err == nil {
+		return 0, repository.ErrDuplicateFacility
+	}
+
+	m.nextFacilityID++
+	now := time.Now()
+
+	stored := copyFacility(&facility)
+	stored.ID = m.nextFacilityID
+	stored.CreatedAt = now
+	stored.UpdatedAt = now
+	m.facilities = append(m.facilities, stored)
+
+	return stored.ID, nil
+}
+
+// UpdateFacility overwrites every editable field of the facility, including its rules.
+// Renaming a facility cascades to the bookings that reference it.
+func (m *MemoryDBRepo) UpdateFacility(facility models.Facility) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, err := m.facilityByID(facility.ID)
+	if err != nil {
+		return err
+	}
+
+	if other, err := m.facilityByName(facility.Name); err == nil && other.ID != facility.ID {
+		return repository.ErrDuplicateFacility
+	}
+
+	if stored.Name != facility.Name {
+		for _, bookings := range [][]*memoryBooking{m.requested, m.approved, m.recurring} {
+			for _, b := range bookings {
+				if b.Facility == stored.Name {
+					b.Facility = facility.Name
+				}
+			}
+		}
+		for _, series := range m.series {
+			if series.Facility == stored.Name {
+				series.Facility = facility.Name
+			}
+		}
+	}
+
+	updated := copyFacility(&facility)
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = time.Now()
+	*stored = *updated
+
+	return nil
+}
+
+// ArchiveFacility hides the facility from residents and stops new bookings for it.
+// Existing bookings are left untouched.
+func (m *MemoryDBRepo) ArchiveFacility(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	facility, err := m.facilityByID(id)
+	if err != nil {
+		return err
+	}
+
+	facility.Active = false
+	facility.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// InsertAPIKey stores the hash of a newly minted API key and returns its id
+func (m *MemoryDBRepo) InsertAPIKey(key models.APIKey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.apiKeys {
+		if existing.Prefix == key.Prefix {
+			return 0, errors.New("duplicate API key prefix")
+		}
+	}
+
+	m.nextAPIKeyID++
+	key.ID = m.nextAPIKeyID
+	key.CreatedAt = time.Now()
+	hash := hashSecret(key.Key)
+	key.Key = ""
+	key.Scopes = append([]models.Permission{}, key.Scopes...)
+	m.apiKeys = append(m.apiKeys, &memoryAPIKey{APIKey: key, Hash: hash})
+
+	return key.ID, nil
+}
+
+// GetAPIKey returns the stored API key matching key, ErrInvalidAPIKey if there is
+// none. Revoked and expired keys are returned as well, see APIKey.Active.
+func (m *MemoryDBRepo) GetAPIKey(key string) (*models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := hashSecret(key)
+	for _, stored := range m.apiKeys {
+		if stored.Hash == hash {
+			copied := stored.APIKey
+			return &copied, nil
+		}
+	}
+
+	return nil, repository.ErrInvalidAPIKey
+}
+
+// AllAPIKeys lists every API key, the newest first
+func (m *MemoryDBRepo) AllAPIKeys() ([]*models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := []*models.APIKey{}
+	for i := len(m.apiKeys) - 1; i >= 0; i-- {
+		copied := m.apiKeys[i].APIKey
+		keys = append(keys, &copied)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey stops an API key from working, ErrAPIKeyNotFound if there is no
+// unrevoked key with the id
+func (m *MemoryDBRepo) RevokeAPIKey(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.apiKeys {
+		if stored.ID == id && stored.RevokedAt == nil {
+			now := time.Now()
+			stored.RevokedAt = &now
+			return nil
+		}
+	}
+
+	return repository.ErrAPIKeyNotFound
+}
+
+// TouchAPIKey records that an API key was just used from ip
+func (m *MemoryDBRepo) TouchAPIKey(id int, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.apiKeys {
+		if stored.ID == id {
+			now := time.Now()
+			stored.LastUsedAt = &now
+			stored.LastUsedIP = ip
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/repository"
+	"booking-backend/internal/repository/repotest"
+	"testing"
+)
+
+func TestMemoryDBRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		return NewMemoryDBRepo()
+	})
+}
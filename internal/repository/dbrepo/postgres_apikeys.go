@@ -0,0 +1,165 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// API keys use the same SQL on Postgres and SQLite, the repositories only differ in
+// how they pass the current time
+
+const apiKeyColumns = `id, name, prefix, username, scopes, created_at, expires_at, last_used_at, last_used_ip, revoked_at`
+
+// joinScopes stores scopes space separated, as in OAuth scope strings
+func joinScopes(scopes []models.Permission) string {
+	parts := make([]string, len(scopes))
+	for i, scope := range scopes {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " ")
+}
+
+func splitScopes(scopes string) []models.Permission {
+	permissions := []models.Permission{}
+	for _, scope := range strings.Fields(scopes) {
+		permissions = append(permissions, models.Permission(scope))
+	}
+	return permissions
+}
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.Username,
+		&scopes,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = splitScopes(scopes)
+	return &key, nil
+}
+
+func insertAPIKey(ctx context.Context, q queryer, key models.APIKey, now time.Time) (int, error) {
+	stmt := `
+		INSERT INTO api_keys (name, prefix, key_hash, username, scopes, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+
+	var id int
+	err := q.QueryRowContext(ctx, stmt,
+		key.Name, key.Prefix, hashSecret(key.Key), key.Username, joinScopes(key.Scopes), now, key.ExpiresAt.UTC(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// getAPIKey looks a key up by its hash, whether or not it is still active
+func getAPIKey(ctx context.Context, q queryer, key string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	apiKey, err := scanAPIKey(q.QueryRowContext(ctx, query, hashSecret(key)))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+func allAPIKeys(ctx context.Context, q queryer) ([]*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC, id DESC`
+
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func revokeAPIKey(ctx context.Context, q queryer, id int, now time.Time) error {
+	result, err := q.ExecContext(ctx, `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`, now, id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrAPIKeyNotFound)
+}
+
+func touchAPIKey(ctx context.Context, q queryer, id int, ip string, now time.Time) error {
+	_, err := q.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1, last_used_ip = $2 WHERE id = $3`, now, ip, id)
+	return err
+}
+
+// InsertAPIKey stores the hash of a newly minted API key and returns its id
+func (m *PostgresDBRepo) InsertAPIKey(key models.APIKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertAPIKey(ctx, m.DB, key, time.Now())
+}
+
+// GetAPIKey returns the stored API key matching key, ErrInvalidAPIKey if there is
+// none. Revoked and expired keys are returned as well, see APIKey.Active.
+func (m *PostgresDBRepo) GetAPIKey(key string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return getAPIKey(ctx, m.DB, key)
+}
+
+// AllAPIKeys lists every API key, the newest first
+func (m *PostgresDBRepo) AllAPIKeys() ([]*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return allAPIKeys(ctx, m.DB)
+}
+
+// RevokeAPIKey stops an API key from working, ErrAPIKeyNotFound if there is no
+// unrevoked key with the id
+func (m *PostgresDBRepo) RevokeAPIKey(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return revokeAPIKey(ctx, m.DB, id, time.Now())
+}
+
+// TouchAPIKey records that an API key was just used from ip
+func (m *PostgresDBRepo) TouchAPIKey(id int, ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return touchAPIKey(ctx, m.DB, id, ip, time.Now())
+}
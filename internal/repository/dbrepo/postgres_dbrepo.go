@@ -2,13 +2,12 @@ package dbrepo
 
 import (
 	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
 	"context"
 	"database/sql"
-	"errors"
+	"fmt"
 	"log"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type PostgresDBRepo struct {
@@ -21,6 +20,101 @@ func (m *PostgresDBRepo) Connection() *sql.DB {
 	return m.DB
 }
 
+// parseBookingTimes parses the RFC 3339 start and end times sent by the frontend
+func parseBookingTimes(start, end string) (time.Time, time.Time, error) {
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return time.Time{}, time.Time{}, repository.InvalidInput(fmt.Errorf("invalid start time: %w", err))
+	}
+
+	endTime, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		return time.Time{}, time.Time{}, repository.InvalidInput(fmt.Errorf("invalid end time: %w", err))
+	}
+
+	return startTime, endTime, nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// findOverlap returns the first approved or recurring booking of the given facility
+// that overlaps [start, end), or nil if the slot is free
+func (m *PostgresDBRepo) findOverlap(ctx context.Context, q queryer, facility string, start, end interface{}) (*models.BookingConflict, error) {
+	// WHERE clause covers all overlap scenarios
+	query := `
+		SELECT id, kind, facility, start_time, end_time
+		FROM (
+			SELECT id, 'approved' AS kind, facility, start_time, end_time
+			FROM approvedbookings
+			UNION ALL
+			SELECT id, 'recurring' AS kind, facility, start_time, end_time
+			FROM recurringbookings
+		) AS all_bookings
+		WHERE 
+			facility = $1
+			AND ($2 < end_time AND $3 > start_time)
+		ORDER BY 
+			start_time ASC
+		LIMIT 1;
+	`
+
+	var conflict models.BookingConflict
+	err := q.QueryRowContext(ctx, query, facility, start, end).Scan(
+		&conflict.BookingID,
+		&conflict.Kind,
+		&conflict.Facility,
+		&conflict.StartTime,
+		&conflict.EndTime,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &conflict, nil
+}
+
+// overlapError turns an exclusion violation raised while writing a booking into a
+// ConflictError naming the booking that won the race. Other errors are returned as is.
+func (m *PostgresDBRepo) overlapError(ctx context.Context, err error, facility string, start, end time.Time) error {
+	if !isExclusionViolation(err) {
+		return err
+	}
+
+	// the conflicting booking has been committed by the time the violation is raised
+	conflict, findErr := m.findOverlap(ctx, m.DB, facility, start, end)
+	if findErr != nil || conflict == nil {
+		return &repository.ConflictError{Conflict: models.BookingConflict{
+			Facility:  facility,
+			StartTime: start,
+			EndTime:   end,
+		}}
+	}
+
+	return &repository.ConflictError{Conflict: *conflict}
+}
+
+// checkOverlap is findOverlap for callers that only need an error
+func (m *PostgresDBRepo) checkOverlap(ctx context.Context, q queryer, facility string, start, end interface{}) error {
+	conflict, err := m.findOverlap(ctx, q, facility, start, end)
+	if err != nil {
+		return err
+	}
+
+	if conflict != nil {
+		return &repository.ConflictError{Conflict: *conflict}
+	}
+
+	return nil
+}
+
 func (m *PostgresDBRepo) AllBookings() ([]*models.SubmittedBooking, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -126,21 +220,6 @@ func (m *PostgresDBRepo) TwoWeekBookings() ([]*models.SubmittedBooking, error) {
 	return bookings, nil
 }
 
-func (m *PostgresDBRepo) ManageBookings(username string) ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error) {
-	user, err := m.GetUserByName(username)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-
-	if user.IsAdmin {
-		// get all bookings
-		return m.AdminBookings()
-	} else {
-		// get bookings that belong to user only
-		return m.UserBookings(username)
-	}
-}
-
 func (m *PostgresDBRepo) AdminBookings() ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -149,7 +228,7 @@ func (m *PostgresDBRepo) AdminBookings() ([]*models.SubmittedBooking, []*models.
 	recurringQuery := `
 		SELECT 
 			id, username, name, start_date, end_date, unit_number, 
-			start_time, end_time, purpose, facility 
+			start_time, end_time, purpose, facility, series_id 
 		FROM 
 			recurringbookings
 		ORDER BY 
@@ -181,7 +260,8 @@ func (m *PostgresDBRepo) AdminBookings() ([]*models.SubmittedBooking, []*models.
 	requestedQuery := `
 		SELECT 
 			id, username, name, start_date, end_date, unit_number, 
-			start_time, end_time, purpose, facility, is_recurring, recurring_weeks 
+			start_time, end_time, purpose, facility, is_recurring, recurring_weeks,
+			rrule, exdates, time_zone 
 		FROM 
 			requestedbookings
 		ORDER BY 
@@ -208,6 +288,7 @@ func (m *PostgresDBRepo) AdminBookings() ([]*models.SubmittedBooking, []*models.
 			&booking.EndTime,
 			&booking.Purpose,
 			&booking.Facility,
+			&booking.SeriesID,
 		)
 		if err != nil {
 			return nil, nil, nil, err
@@ -241,6 +322,7 @@ func (m *PostgresDBRepo) AdminBookings() ([]*models.SubmittedBooking, []*models.
 	var requestedBookings []*models.RequestedBooking
 	for requestedRows.Next() {
 		var booking models.RequestedBooking
+		var exdates string
 		err := requestedRows.Scan(
 			&booking.ID,
 			&booking.Username,
@@ -254,10 +336,17 @@ func (m *PostgresDBRepo) AdminBookings() ([]*models.SubmittedBooking, []*models.
 			&booking.Facility,
 			&booking.Recurring,
 			&booking.RecurringWeeks,
+			&booking.RRule,
+			&exdates,
+			&booking.TimeZone,
 		)
 		if err != nil {
 			return nil, nil, nil, err
 		}
+		booking.ExDates, err = parseExDates(exdates)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		requestedBookings = append(requestedBookings, &booking)
 	}
 
@@ -272,7 +361,7 @@ func (m *PostgresDBRepo) UserBookings(username string) ([]*models.SubmittedBooki
 	recurringQuery := `
 		SELECT 
 			id, username, name, start_date, end_date, unit_number, 
-			start_time, end_time, purpose, facility 
+			start_time, end_time, purpose, facility, series_id 
 		FROM 
 			recurringbookings
 		WHERE
@@ -308,7 +397,8 @@ func (m *PostgresDBRepo) UserBookings(username string) ([]*models.SubmittedBooki
 	requestedQuery := `
 		SELECT 
 			id, username, name, start_date, end_date, unit_number, 
-			start_time, end_time, purpose, facility, is_recurring, recurring_weeks 
+			start_time, end_time, purpose, facility, is_recurring, recurring_weeks,
+			rrule, exdates, time_zone 
 		FROM 
 			requestedbookings
 		WHERE
@@ -337,6 +427,7 @@ func (m *PostgresDBRepo) UserBookings(username string) ([]*models.SubmittedBooki
 			&booking.EndTime,
 			&booking.Purpose,
 			&booking.Facility,
+			&booking.SeriesID,
 		)
 		if err != nil {
 			return nil, nil, nil, err
@@ -370,6 +461,7 @@ func (m *PostgresDBRepo) UserBookings(username string) ([]*models.SubmittedBooki
 	var requestedBookings []*models.RequestedBooking
 	for requestedRows.Next() {
 		var booking models.RequestedBooking
+		var exdates string
 		err := requestedRows.Scan(
 			&booking.ID,
 			&booking.Username,
@@ -383,10 +475,17 @@ func (m *PostgresDBRepo) UserBookings(username string) ([]*models.SubmittedBooki
 			&booking.Facility,
 			&booking.Recurring,
 			&booking.RecurringWeeks,
+			&booking.RRule,
+			&exdates,
+			&booking.TimeZone,
 		)
 		if err != nil {
 			return nil, nil, nil, err
 		}
+		booking.ExDates, err = parseExDates(exdates)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		requestedBookings = append(requestedBookings, &booking)
 	}
 
@@ -397,36 +496,39 @@ func (m *PostgresDBRepo) InsertBookingRequest(booking models.Booking) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	// check for overlaps, WHERE clause covers all overlap scenarios
-	checkOverlapStmt := `
-		SELECT id
-		FROM (
-			SELECT id, start_time, end_time
-			FROM approvedbookings
-			UNION ALL
-			SELECT id, start_time, end_time
-			FROM recurringbookings
-		) AS all_bookings
-		WHERE 
-			($1 < end_time AND $2 > start_time)
-		LIMIT 1;
-	`
+	// only active facilities in the catalogue can be booked
+	facility, err := m.bookableFacility(ctx, m.DB, booking.Facility)
+	if err != nil {
+		return err
+	}
+
+	startTime, endTime, err := parseBookingTimes(booking.StartTime, booking.EndTime)
+	if err != nil {
+		return err
+	}
+
+	// the booking has to respect the facility's opening hours and booking window
+	err = facility.Rules.Check(startTime, endTime, time.Now())
+	if err != nil {
+		return err
+	}
 
-	var overlapID int
-	err := m.DB.QueryRowContext(ctx, checkOverlapStmt, booking.StartTime, booking.EndTime).Scan(&overlapID)
-	if err != nil && err != sql.ErrNoRows {
+	// a recurring request must have a rule that expands to a bounded series
+	err = normaliseRecurrence(&booking, facility)
+	if err != nil {
 		return err
 	}
 
-	// If overlap found, return error
-	if err != sql.ErrNoRows {
-		return errors.New("booking time overlaps with an existing booking")
+	// check for overlaps with bookings of the same facility
+	err = m.checkOverlap(ctx, m.DB, booking.Facility, booking.StartTime, booking.EndTime)
+	if err != nil {
+		return err
 	}
 
 	// If no overlaps, proceed with insertion
 	stmt := `insert into requestedbookings (username, name, start_date, end_date, unit_number, start_time,
-		end_time, purpose, facility, is_recurring, recurring_weeks)
-		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+		end_time, purpose, facility, is_recurring, recurring_weeks, rrule, exdates, time_zone)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) returning id`
 
 	var newID int
 
@@ -442,6 +544,9 @@ func (m *PostgresDBRepo) InsertBookingRequest(booking models.Booking) error {
 		booking.Facility,
 		booking.Recurring,
 		booking.RecurringWeeks,
+		booking.RRule,
+		formatExDates(booking.ExDates),
+		booking.TimeZone,
 	).Scan(&newID)
 
 	if err != nil {
@@ -455,41 +560,46 @@ func (m *PostgresDBRepo) ApproveBookingRequest(booking models.RequestedBooking)
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	// check for overlaps, WHERE clause covers all overlap scenarios
-	checkOverlapStmt := `
-		SELECT id
-		FROM (
-			SELECT id, start_time, end_time
-			FROM approvedbookings
-			UNION ALL
-			SELECT id, start_time, end_time
-			FROM recurringbookings
-		) AS all_bookings
-		WHERE 
-			($1 < end_time AND $2 > start_time)
-		LIMIT 1;
-	`
+	facility, err := m.facilityByName(ctx, m.DB, booking.Facility)
+	if err != nil {
+		return err
+	}
 
-	var overlapID int
-	err := m.DB.QueryRowContext(ctx, checkOverlapStmt, booking.StartTime, booking.EndTime).Scan(&overlapID)
-	if err != nil && err != sql.ErrNoRows {
+	startTime, endTime, err := parseBookingTimes(booking.StartTime, booking.EndTime)
+	if err != nil {
 		return err
 	}
 
-	// If overlap found, return error
-	if err != sql.ErrNoRows {
-		return errors.New("booking time overlaps with an existing booking")
+	// the facility's rules may have changed since the booking was requested
+	err = facility.Rules.CheckSlot(startTime, endTime)
+	if err != nil {
+		return err
 	}
-	// If no overlaps, proceed with insertion
+
 	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
+	// check for overlaps with bookings of the same facility, anything approved
+	// concurrently is caught by the exclusion constraint on booking_slots
+	err = m.checkOverlap(ctx, tx, booking.Facility, booking.StartTime, booking.EndTime)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
 	// Copy the booking from requestedbookings to approvedbookings
 	copyStmt := `INSERT INTO approvedbookings (username, name, start_date, end_date, unit_number, start_time, end_time, purpose, facility)
 		SELECT username, name, start_date, end_date, unit_number, start_time, end_time, purpose, facility FROM requestedbookings WHERE id = $1`
-	_, err = tx.ExecContext(ctx, copyStmt, booking.ID)
+	result, err := tx.ExecContext(ctx, copyStmt, booking.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return m.overlapError(ctx, err, booking.Facility, startTime, endTime)
+	}
+
+	// another admin may have approved or deleted the request in the meantime
+	err = requireAffected(result, repository.ErrBookingRequestNotFound)
 	if err != nil {
 		_ = tx.Rollback()
 		return err
@@ -511,84 +621,217 @@ func (m *PostgresDBRepo) ApproveBookingRequest(booking models.RequestedBooking)
 	return nil
 }
 
-func (m *PostgresDBRepo) ApproveRecurringBookingRequest(booking models.RequestedBooking) error {
+// ApproveRecurringBookingRequest creates the series and every occurrence that is free.
+// Occurrences overlapping an existing booking are skipped and listed in the report,
+// with failOnConflict the first overlap aborts the approval instead.
+func (m *PostgresDBRepo) ApproveRecurringBookingRequest(booking models.RequestedBooking, failOnConflict bool) (*models.ApprovalReport, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	// check for overlaps, WHERE clause covers all overlap scenarios
-	checkOverlapStmt := `
-		SELECT id
-		FROM (
-			SELECT id, start_time, end_time
-			FROM approvedbookings
-			UNION ALL
-			SELECT id, start_time, end_time
-			FROM recurringbookings
-		) AS all_bookings
-		WHERE 
-			($1 < end_time AND $2 > start_time)
-		LIMIT 1;
-		`
+	facility, err := m.facilityByName(ctx, m.DB, booking.Facility)
+	if err != nil {
+		return nil, err
+	}
 
-	tx, err := m.DB.BeginTx(ctx, nil)
+	series, occurrences, err := newSeries(booking, facility)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	layout := "2006-01-02T15:04:05-07:00"
 
-	for week := 0; week < booking.RecurringWeeks; week++ {
-		// Parse the start and end times to time.Time
-		startTime, err := time.Parse(layout, booking.StartTime)
+	// every occurrence has to respect the facility's current rules
+	for _, occurrence := range occurrences {
+		err = facility.Rules.CheckSlot(occurrence.StartTime, occurrence.EndTime)
 		if err != nil {
-			log.Print("Error parsing start time: ", err)
-			_ = tx.Rollback()
-			return err
+			return nil, err
 		}
-		endTime, err := time.Parse(layout, booking.EndTime)
-		if err != nil {
-			log.Print("Error parsing end time: ", err)
-			_ = tx.Rollback()
-			return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.insertSeries(ctx, tx, series)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	report := &models.ApprovalReport{SeriesID: series.ID}
+	for _, occurrence := range occurrences {
+		result := models.OccurrenceResult{
+			StartTime: occurrence.StartTime,
+			EndTime:   occurrence.EndTime,
 		}
 
-		// Calculate the start and end time for this booking
-		startTime = startTime.Add(time.Duration(week) * 7 * 24 * time.Hour)
-		endTime = endTime.Add(time.Duration(week) * 7 * 24 * time.Hour)
-		// Check for overlaps
-		var overlapID int
-		err = m.DB.QueryRowContext(ctx, checkOverlapStmt, startTime, endTime).Scan(&overlapID)
-		if err != nil && err != sql.ErrNoRows {
+		// Check for overlaps with bookings of the same facility
+		conflict, err := m.findOverlap(ctx, tx, booking.Facility, occurrence.StartTime, occurrence.EndTime)
+		if err != nil {
 			log.Print("Overlap check error: ", err)
 			_ = tx.Rollback()
-			return err
+			return nil, err
 		}
 
-		if err == sql.ErrNoRows {
-			// If there is no overlap, insert the booking into the recurringbookings table
-			insertStmt := `INSERT INTO recurringbookings (username, name, start_date, end_date, unit_number, start_time, end_time, purpose, facility)
-				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-			_, err = tx.ExecContext(ctx, insertStmt, booking.Username, booking.Name, startTime, endTime, booking.UnitNumber, startTime, endTime, booking.Purpose, booking.Facility)
-			if err != nil {
+		if conflict != nil {
+			if failOnConflict {
 				_ = tx.Rollback()
-				return err
+				return nil, &repository.ConflictError{Conflict: *conflict}
 			}
+
+			result.Status = models.OccurrenceSkipped
+			result.Conflict = conflict
+			report.Add(result)
+			continue
 		}
+
+		// If there is no overlap, insert the booking into the recurringbookings table
+		insertStmt := `INSERT INTO recurringbookings (username, name, start_date, end_date, unit_number, start_time, end_time, purpose, facility, series_id, original_start)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $6) RETURNING id`
+		err = tx.QueryRowContext(ctx, insertStmt, booking.Username, booking.Name, occurrence.StartDate, occurrence.EndDate,
+			booking.UnitNumber, occurrence.StartTime, occurrence.EndTime, booking.Purpose, booking.Facility, series.ID).Scan(&result.BookingID)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, m.overlapError(ctx, err, booking.Facility, occurrence.StartTime, occurrence.EndTime)
+		}
+
+		result.Status = models.OccurrenceCreated
+		report.Add(result)
 	}
 
-	// Delete the booking from requestedbookings
+	// Delete the booking from requestedbookings, another admin may have approved
+	// or deleted the request in the meantime
 	deleteStmt := `DELETE FROM requestedbookings WHERE id = $1`
-	_, err = tx.ExecContext(ctx, deleteStmt, booking.ID)
+	result, err := tx.ExecContext(ctx, deleteStmt, booking.ID)
 	if err != nil {
 		_ = tx.Rollback()
-		return err
+		return nil, err
+	}
+
+	err = requireAffected(result, repository.ErrBookingRequestNotFound)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return report, nil
+}
+
+// bookingRequestByID reads a single row of requestedbookings, the SQLite repository shares it
+func bookingRequestByID(ctx context.Context, q queryer, id int) (*models.RequestedBooking, error) {
+	query := `
+		SELECT 
+			id, username, name, start_date, end_date, unit_number, 
+			start_time, end_time, purpose, facility, is_recurring, recurring_weeks,
+			rrule, exdates, time_zone 
+		FROM 
+			requestedbookings
+		WHERE
+			id = $1
+	`
+
+	var booking models.RequestedBooking
+	var exdates string
+	err := q.QueryRowContext(ctx, query, id).Scan(
+		&booking.ID,
+		&booking.Username,
+		&booking.Name,
+		&booking.StartDate,
+		&booking.EndDate,
+		&booking.UnitNumber,
+		&booking.StartTime,
+		&booking.EndTime,
+		&booking.Purpose,
+		&booking.Facility,
+		&booking.Recurring,
+		&booking.RecurringWeeks,
+		&booking.RRule,
+		&exdates,
+		&booking.TimeZone,
+	)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrBookingRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	booking.ExDates, err = parseExDates(exdates)
+	if err != nil {
+		return nil, err
+	}
+
+	return &booking, nil
+}
+
+// submittedBookingByID reads a single row of approvedbookings or recurringbookings,
+// series_id is always NULL for approved bookings
+func submittedBookingByID(ctx context.Context, q queryer, table string, id int) (*models.SubmittedBooking, error) {
+	seriesColumn := "NULL"
+	if table == "recurringbookings" {
+		seriesColumn = "series_id"
+	}
+
+	query := `
+		SELECT 
+			id, username, name, start_date, end_date, unit_number, 
+			start_time, end_time, purpose, facility, ` + seriesColumn + ` 
+		FROM 
+			` + table + `
+		WHERE
+			id = $1
+	`
+
+	var booking models.SubmittedBooking
+	err := q.QueryRowContext(ctx, query, id).Scan(
+		&booking.ID,
+		&booking.Username,
+		&booking.Name,
+		&booking.StartDate,
+		&booking.EndDate,
+		&booking.UnitNumber,
+		&booking.StartTime,
+		&booking.EndTime,
+		&booking.Purpose,
+		&booking.Facility,
+		&booking.SeriesID,
+	)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrBookingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &booking, nil
+}
+
+// GetBookingRequest returns a pending booking request
+func (m *PostgresDBRepo) GetBookingRequest(id int) (*models.RequestedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return bookingRequestByID(ctx, m.DB, id)
+}
+
+// GetApprovedBooking returns a one-off approved booking
+func (m *PostgresDBRepo) GetApprovedBooking(id int) (*models.SubmittedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return submittedBookingByID(ctx, m.DB, "approvedbookings", id)
+}
+
+// GetRecurringBooking returns a single occurrence of a recurring booking
+func (m *PostgresDBRepo) GetRecurringBooking(id int) (*models.SubmittedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return submittedBookingByID(ctx, m.DB, "recurringbookings", id)
 }
 
 func (m *PostgresDBRepo) DeleteBookingRequest(booking models.RequestedBooking) error {
@@ -665,54 +908,3 @@ func (m *PostgresDBRepo) DeleteRecurringBooking(booking models.SubmittedBooking)
 
 	return nil
 }
-
-func (m *PostgresDBRepo) GetUserByName(username string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	query := `select id, username, password, is_admin from users where username = $1`
-	var user models.User
-	row := m.DB.QueryRowContext(ctx, query, username)
-
-	err := row.Scan(
-		&user.ID,
-		&user.Username,
-		&user.Password,
-		&user.IsAdmin,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
-
-func (m *PostgresDBRepo) RegisterUser(username string, password string, admin bool) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
-	}
-
-	stmt := `insert into users (username, password, is_admin) values ($1, $2, $3) returning id`
-
-	var newID int
-
-	err = m.DB.QueryRowContext(ctx, stmt, username, string(hashedPassword), admin).Scan(&newID)
-
-	if err != nil {
-		return nil, err
-	}
-
-	var user models.User = models.User{
-		ID:       newID,
-		Username: username,
-		Password: password,
-		IsAdmin:  admin,
-	}
-
-	return &user, nil
-}
@@ -0,0 +1,71 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/migrations"
+	"booking-backend/internal/repository"
+	"booking-backend/internal/repository/repotest"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// postgresDSNEnv names a Postgres database the tests may create schemas in. The
+// Postgres tests are skipped without it, except in CI where they must run.
+const postgresDSNEnv = "BOOKING_TEST_POSTGRES_DSN"
+
+func TestPostgresDBRepo(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("%s is not set, CI must run the Postgres tests", postgresDSNEnv)
+		}
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open %s: %v", postgresDSNEnv, err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	if err := admin.Ping(); err != nil {
+		t.Fatalf("connect to %s: %v", postgresDSNEnv, err)
+	}
+
+	// the exclusion constraint needs btree_gist, installed once where every schema sees
+	// it rather than in the first schema that migrates and drops it again
+	if _, err := admin.Exec(`CREATE EXTENSION IF NOT EXISTS btree_gist`); err != nil {
+		t.Fatalf("install btree_gist: %v", err)
+	}
+
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		// every subtest migrates a schema of its own, so they start empty
+		schema := fmt.Sprintf("repotest_%d", time.Now().UnixNano())
+		if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			t.Fatalf("create schema: %v", err)
+		}
+		t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+		config, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			t.Fatalf("parse %s: %v", postgresDSNEnv, err)
+		}
+		config.RuntimeParams["search_path"] = schema + ", public"
+		db := stdlib.OpenDB(*config)
+		t.Cleanup(func() { db.Close() })
+
+		m, err := migrations.New(db, migrations.Postgres)
+		if err != nil {
+			t.Fatalf("load migrations: %v", err)
+		}
+		if _, err := m.Up(); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+
+		return &PostgresDBRepo{DB: db}
+	})
+}
@@ -0,0 +1,385 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+const facilityColumns = `
+	id, name, description, capacity, location, is_active,
+	image_url, booking_rules, created_at, updated_at,
+	time_zone, min_slot_minutes, max_slot_minutes, slot_granularity_minutes,
+	lead_time_minutes, max_advance_days
+`
+
+// isUniqueViolation reports whether err is a Postgres unique_violation (SQLSTATE 23505)
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isExclusionViolation reports whether err is a Postgres exclusion_violation (SQLSTATE 23P01),
+// raised by the booking_slots constraint when two bookings of a facility overlap
+func isExclusionViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23P01"
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFacility(row scanner) (*models.Facility, error) {
+	var facility models.Facility
+	err := row.Scan(
+		&facility.ID,
+		&facility.Name,
+		&facility.Description,
+		&facility.Capacity,
+		&facility.Location,
+		&facility.Active,
+		&facility.ImageURL,
+		&facility.BookingRules,
+		&facility.CreatedAt,
+		&facility.UpdatedAt,
+		&facility.Rules.TimeZone,
+		&facility.Rules.MinSlotMinutes,
+		&facility.Rules.MaxSlotMinutes,
+		&facility.Rules.SlotGranularityMinutes,
+		&facility.Rules.LeadTimeMinutes,
+		&facility.Rules.MaxAdvanceDays,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &facility, nil
+}
+
+// loadOpeningHours fills in the opening hours of the given facilities
+func (m *PostgresDBRepo) loadOpeningHours(ctx context.Context, q queryer, facilities ...*models.Facility) error {
+	if len(facilities) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Facility, len(facilities))
+	ids := make([]int, 0, len(facilities))
+	for _, facility := range facilities {
+		facility.Rules.OpeningHours = []models.OpeningHours{}
+		byID[facility.ID] = facility
+		ids = append(ids, facility.ID)
+	}
+
+	query := `
+		SELECT
+			facility_id, weekday, opens_minute, closes_minute
+		FROM
+			facility_opening_hours
+		WHERE
+			facility_id = ANY($1)
+		ORDER BY
+			facility_id, weekday, opens_minute
+	`
+
+	rows, err := q.QueryContext(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var facilityID, weekday, opens, closes int
+		err := rows.Scan(&facilityID, &weekday, &opens, &closes)
+		if err != nil {
+			return err
+		}
+
+		facility := byID[facilityID]
+		facility.Rules.OpeningHours = append(facility.Rules.OpeningHours, models.OpeningHours{
+			Weekday: time.Weekday(weekday),
+			Opens:   models.FormatClock(opens),
+			Closes:  models.FormatClock(closes),
+		})
+	}
+
+	return rows.Err()
+}
+
+// saveOpeningHours replaces the opening hours of a facility
+func (m *PostgresDBRepo) saveOpeningHours(ctx context.Context, q queryer, facilityID int, hours []models.OpeningHours) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM facility_opening_hours WHERE facility_id = $1`, facilityID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into facility_opening_hours (facility_id, weekday, opens_minute, closes_minute)
+		values ($1, $2, $3, $4)`
+
+	for _, h := range hours {
+		opens, err := models.ParseClock(h.Opens)
+		if err != nil {
+			return err
+		}
+		closes, err := models.ParseClock(h.Closes)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, stmt, facilityID, int(h.Weekday), opens, closes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *PostgresDBRepo) AllFacilities(includeArchived bool) ([]*models.Facility, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + facilityColumns + `
+		FROM
+			facilities
+		WHERE
+			is_active OR $1
+		ORDER BY
+			name ASC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var facilities []*models.Facility
+	for rows.Next() {
+		facility, err := scanFacility(rows)
+		if err != nil {
+			return nil, err
+		}
+		facilities = append(facilities, facility)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.loadOpeningHours(ctx, m.DB, facilities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return facilities, nil
+}
+
+func (m *PostgresDBRepo) GetFacilityByID(id int) (*models.Facility, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + facilityColumns + ` FROM facilities WHERE id = $1`
+
+	facility, err := scanFacility(m.DB.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrFacilityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadOpeningHours(ctx, m.DB, facility)
+	if err != nil {
+		return nil, err
+	}
+
+	return facility, nil
+}
+
+func (m *PostgresDBRepo) GetFacilityByName(name string) (*models.Facility, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return m.facilityByName(ctx, m.DB, name)
+}
+
+func (m *PostgresDBRepo) facilityByName(ctx context.Context, q queryer, name string) (*models.Facility, error) {
+	query := `SELECT ` + facilityColumns + ` FROM facilities WHERE name = $1`
+
+	facility, err := scanFacility(q.QueryRowContext(ctx, query, name))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrFacilityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadOpeningHours(ctx, q, facility)
+	if err != nil {
+		return nil, err
+	}
+
+	return facility, nil
+}
+
+// bookableFacility returns the named facility, or an error if it is unknown or archived
+func (m *PostgresDBRepo) bookableFacility(ctx context.Context, q queryer, name string) (*models.Facility, error) {
+	facility, err := m.facilityByName(ctx, q, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !facility.Active {
+		return nil, repository.ErrFacilityArchived
+	}
+
+	return facility, nil
+}
+
+func (m *PostgresDBRepo) InsertFacility(facility models.Facility) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into facilities (name, description, capacity, location, is_active, image_url, booking_rules,
+		time_zone, min_slot_minutes, max_slot_minutes, slot_granularity_minutes, lead_time_minutes, max_advance_days)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) returning id`
+
+	var newID int
+	err = tx.QueryRowContext(ctx, stmt,
+		facility.Name,
+		facility.Description,
+		facility.Capacity,
+		facility.Location,
+		facility.Active,
+		facility.ImageURL,
+		facility.BookingRules,
+		facility.Rules.TimeZone,
+		facility.Rules.MinSlotMinutes,
+		facility.Rules.MaxSlotMinutes,
+		facility.Rules.SlotGranularityMinutes,
+		facility.Rules.LeadTimeMinutes,
+		facility.Rules.MaxAdvanceDays,
+	).Scan(&newID)
+
+	if err != nil {
+		_ = tx.Rollback()
+		if isUniqueViolation(err) {
+			return 0, repository.ErrDuplicateFacility
+		}
+		return 0, err
+	}
+
+	err = m.saveOpeningHours(ctx, tx, newID, facility.Rules.OpeningHours)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateFacility overwrites every editable field of the facility, including its rules.
+// Renaming a facility cascades to the bookings that reference it.
+func (m *PostgresDBRepo) UpdateFacility(facility models.Facility) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		UPDATE facilities SET
+			name = $1, description = $2, capacity = $3, location = $4, is_active = $5,
+			image_url = $6, booking_rules = $7, time_zone = $8, min_slot_minutes = $9,
+			max_slot_minutes = $10, slot_granularity_minutes = $11, lead_time_minutes = $12,
+			max_advance_days = $13, updated_at = now()
+		WHERE id = $14
+	`
+
+	result, err := tx.ExecContext(ctx, stmt,
+		facility.Name,
+		facility.Description,
+		facility.Capacity,
+		facility.Location,
+		facility.Active,
+		facility.ImageURL,
+		facility.BookingRules,
+		facility.Rules.TimeZone,
+		facility.Rules.MinSlotMinutes,
+		facility.Rules.MaxSlotMinutes,
+		facility.Rules.SlotGranularityMinutes,
+		facility.Rules.LeadTimeMinutes,
+		facility.Rules.MaxAdvanceDays,
+		facility.ID,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		if isUniqueViolation(err) {
+			return repository.ErrDuplicateFacility
+		}
+		return err
+	}
+
+	err = requireAffected(result, repository.ErrFacilityNotFound)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = m.saveOpeningHours(ctx, tx, facility.ID, facility.Rules.OpeningHours)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ArchiveFacility hides the facility from residents and stops new bookings for it.
+// Existing bookings are left untouched.
+func (m *PostgresDBRepo) ArchiveFacility(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `UPDATE facilities SET is_active = FALSE, updated_at = now() WHERE id = $1`
+
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrFacilityNotFound)
+}
+
+// requireAffected returns notFound if the statement did not touch any row
+func requireAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return notFound
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Single sign-on identities use the same SQL on Postgres and SQLite, the repositories
+// only differ in how they pass the current time and recognise unique violations
+
+func getUserByIdentity(ctx context.Context, q queryer, issuer string, subject string) (*models.User, error) {
+	query := `
+		SELECT u.id, u.username, u.password, u.role, u.unit_number
+		FROM user_identities i
+		JOIN users u ON u.username = i.username
+		WHERE i.issuer = $1 AND i.subject = $2
+	`
+
+	var user models.User
+	err := q.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.Role,
+		&user.UnitNumber,
+	)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// insertUserIdentity links an identity to an existing user
+func insertUserIdentity(ctx context.Context, q queryer, identity models.UserIdentity, now time.Time, isUnique func(error) bool) error {
+	var exists bool
+	err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`, identity.Username).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return repository.ErrUserNotFound
+	}
+
+	stmt := `INSERT INTO user_identities (issuer, subject, username, created_at) VALUES ($1, $2, $3, $4)`
+	_, err = q.ExecContext(ctx, stmt, identity.Issuer, identity.Subject, identity.Username, now)
+	if err != nil {
+		if isUnique(err) {
+			return repository.ErrDuplicateIdentity
+		}
+		return err
+	}
+
+	return nil
+}
+
+// provisionIdentityUser creates a resident without a usable password and links the
+// identity to them
+func provisionIdentityUser(ctx context.Context, db *sql.DB, identity models.UserIdentity, unitNumber string, now time.Time, isUnique func(error) bool) (*models.User, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `insert into users (username, password, role, unit_number) values ($1, '', $2, $3) returning id`
+
+	var newID int
+	err = tx.QueryRowContext(ctx, stmt, identity.Username, models.RoleResident, unitNumber).Scan(&newID)
+	if err != nil {
+		_ = tx.Rollback()
+		if isUnique(err) {
+			return nil, repository.ErrDuplicateUsername
+		}
+		return nil, err
+	}
+
+	err = insertUserIdentity(ctx, tx, identity, now, isUnique)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User = models.User{
+		ID:         newID,
+		Username:   identity.Username,
+		Role:       models.RoleResident,
+		UnitNumber: unitNumber,
+	}
+
+	return &user, nil
+}
+
+// insertOIDCLogin stores a single sign-on in progress and drops the expired ones
+func insertOIDCLogin(ctx context.Context, q queryer, login models.OIDCLogin, now time.Time) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM oidc_logins WHERE expires_at <= $1`, now)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO oidc_logins (state_hash, nonce, code_verifier, return_to, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err = q.ExecContext(ctx, stmt,
+		hashSecret(login.State), login.Nonce, login.CodeVerifier, login.ReturnTo, now, login.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// takeOIDCLogin deletes and returns the unexpired sign-on with the state, so a
+// redirect from the provider can only be completed once
+func takeOIDCLogin(ctx context.Context, q queryer, state string, now time.Time) (*models.OIDCLogin, error) {
+	stmt := `
+		DELETE FROM oidc_logins
+		WHERE state_hash = $1 AND expires_at > $2
+		RETURNING nonce, code_verifier, return_to, created_at, expires_at
+	`
+
+	login := models.OIDCLogin{State: state}
+	err := q.QueryRowContext(ctx, stmt, hashSecret(state), now).Scan(
+		&login.Nonce,
+		&login.CodeVerifier,
+		&login.ReturnTo,
+		&login.CreatedAt,
+		&login.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &login, nil
+}
+
+// GetUserByIdentity returns the user linked to a subject of an identity provider,
+// ErrUserNotFound if there is none
+func (m *PostgresDBRepo) GetUserByIdentity(issuer string, subject string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return getUserByIdentity(ctx, m.DB, issuer, subject)
+}
+
+// InsertUserIdentity links an identity provider account to an existing user. It
+// returns ErrDuplicateIdentity if the account is already linked.
+func (m *PostgresDBRepo) InsertUserIdentity(identity models.UserIdentity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertUserIdentity(ctx, m.DB, identity, time.Now(), isUniqueViolation)
+}
+
+// ProvisionIdentityUser creates a resident named identity.Username for the first
+// single sign-on of an identity. Provisioned users have no password.
+func (m *PostgresDBRepo) ProvisionIdentityUser(identity models.UserIdentity, unitNumber string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return provisionIdentityUser(ctx, m.DB, identity, unitNumber, time.Now(), isUniqueViolation)
+}
+
+// InsertOIDCLogin stores the state, nonce and PKCE verifier of a single sign-on
+// until the identity provider redirects back
+func (m *PostgresDBRepo) InsertOIDCLogin(login models.OIDCLogin) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertOIDCLogin(ctx, m.DB, login, time.Now())
+}
+
+// TakeOIDCLogin uses up the single sign-on with the state, ErrInvalidOIDCState if it
+// is unknown, expired or already completed
+func (m *PostgresDBRepo) TakeOIDCLogin(state string) (*models.OIDCLogin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return takeOIDCLogin(ctx, m.DB, state, time.Now())
+}
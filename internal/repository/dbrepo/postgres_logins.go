@@ -0,0 +1,132 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// the sign in audit trail and throttles use the same SQL on Postgres and SQLite, the
+// repositories only differ in how they pass the current time
+
+func recordLoginAttempt(ctx context.Context, q queryer, attempt models.LoginAttempt, now time.Time) error {
+	stmt := `
+		INSERT INTO login_attempts (username, ip_address, outcome, attempted_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := q.ExecContext(ctx, stmt, attempt.Username, attempt.IPAddress, attempt.Outcome, now)
+	return err
+}
+
+func getLoginThrottle(ctx context.Context, q queryer, key string) (*models.LoginThrottle, error) {
+	query := `SELECT throttle_key, failures, last_failure_at, locked_until FROM login_throttles WHERE throttle_key = $1`
+
+	var throttle models.LoginThrottle
+	err := q.QueryRowContext(ctx, query, key).Scan(
+		&throttle.Key,
+		&throttle.Failures,
+		&throttle.LastFailureAt,
+		&throttle.LockedUntil,
+	)
+	if err == sql.ErrNoRows {
+		return &models.LoginThrottle{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &throttle, nil
+}
+
+// recordLoginFailure counts a failure, starting over when the previous one is older
+// than since
+func recordLoginFailure(ctx context.Context, q queryer, key string, now time.Time, since time.Time) (*models.LoginThrottle, error) {
+	stmt := `
+		INSERT INTO login_throttles (throttle_key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at > $3 THEN login_throttles.failures + 1 ELSE 1 END,
+			last_failure_at = $2
+		RETURNING throttle_key, failures, last_failure_at, locked_until
+	`
+
+	var throttle models.LoginThrottle
+	err := q.QueryRowContext(ctx, stmt, key, now, since).Scan(
+		&throttle.Key,
+		&throttle.Failures,
+		&throttle.LastFailureAt,
+		&throttle.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &throttle, nil
+}
+
+func returnLoginFailure(ctx context.Context, q queryer, key string) error {
+	_, err := q.ExecContext(ctx, `UPDATE login_throttles SET failures = failures - 1 WHERE throttle_key = $1 AND failures > 0`, key)
+	return err
+}
+
+func lockLogin(ctx context.Context, q queryer, key string, until time.Time) error {
+	_, err := q.ExecContext(ctx, `UPDATE login_throttles SET locked_until = $1 WHERE throttle_key = $2`, until, key)
+	return err
+}
+
+func clearLoginThrottle(ctx context.Context, q queryer, key string) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM login_throttles WHERE throttle_key = $1`, key)
+	return err
+}
+
+// RecordLoginAttempt adds a sign in attempt to the audit trail
+func (m *PostgresDBRepo) RecordLoginAttempt(attempt models.LoginAttempt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return recordLoginAttempt(ctx, m.DB, attempt, time.Now())
+}
+
+// GetLoginThrottle returns the recent failures counted for key, none if it has no throttle
+func (m *PostgresDBRepo) GetLoginThrottle(key string) (*models.LoginThrottle, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return getLoginThrottle(ctx, m.DB, key)
+}
+
+// RecordLoginFailure counts a failed sign in for key. Failures older than window are
+// forgotten, the count starts over.
+func (m *PostgresDBRepo) RecordLoginFailure(key string, window time.Duration) (*models.LoginThrottle, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	return recordLoginFailure(ctx, m.DB, key, now, now.Add(-window))
+}
+
+// ReturnLoginFailure takes back one failure counted for key, for an attempt that was
+// counted before it was checked and turned out not to be a failure
+func (m *PostgresDBRepo) ReturnLoginFailure(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return returnLoginFailure(ctx, m.DB, key)
+}
+
+// LockLogin rejects sign ins for key until the given time
+func (m *PostgresDBRepo) LockLogin(key string, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return lockLogin(ctx, m.DB, key, until)
+}
+
+// ClearLoginThrottle forgets the failures of key and lifts its lock
+func (m *PostgresDBRepo) ClearLoginThrottle(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return clearLoginThrottle(ctx, m.DB, key)
+}
@@ -0,0 +1,197 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TOTP enrolments use the same SQL on Postgres and SQLite, the repositories only
+// differ in how they pass the current time
+
+func getUserMFA(ctx context.Context, q queryer, username string) (*models.UserMFA, error) {
+	query := `SELECT username, totp_secret, created_at, enabled_at, last_step FROM user_mfa WHERE username = $1`
+
+	var mfa models.UserMFA
+	err := q.QueryRowContext(ctx, query, username).Scan(
+		&mfa.Username,
+		&mfa.Secret,
+		&mfa.CreatedAt,
+		&mfa.EnabledAt,
+		&mfa.LastStep,
+	)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// beginMFAEnrolment stores a new secret unless the user already enabled TOTP, a
+// pending enrolment is replaced
+func beginMFAEnrolment(ctx context.Context, q queryer, username string, secret string, now time.Time) error {
+	stmt := `
+		INSERT INTO user_mfa (username, totp_secret, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (username) DO UPDATE SET
+			totp_secret = excluded.totp_secret,
+			created_at = excluded.created_at,
+			last_step = 0
+		WHERE user_mfa.enabled_at IS NULL
+	`
+	result, err := q.ExecContext(ctx, stmt, username, secret, now)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrMFAAlreadyEnabled)
+}
+
+// enableMFA confirms a pending enrolment and replaces the user's recovery codes
+func enableMFA(ctx context.Context, db *sql.DB, username string, step int64, recoveryCodes []string, now time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE user_mfa SET enabled_at = $1, last_step = $2 WHERE username = $3 AND enabled_at IS NULL`,
+		now, step, username,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	err = requireAffected(result, repository.ErrMFANotEnrolled)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE username = $1`, username)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO recovery_codes (username, code_hash) VALUES ($1, $2)`,
+			username, hashSecret(code),
+		)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// useTOTPStep records the time step of an accepted code, failing for steps that are
+// not newer than the last accepted one
+func useTOTPStep(ctx context.Context, q queryer, username string, step int64) error {
+	result, err := q.ExecContext(ctx,
+		`UPDATE user_mfa SET last_step = $1 WHERE username = $2 AND enabled_at IS NOT NULL AND last_step < $1`,
+		step, username,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrTOTPCodeReused)
+}
+
+func useRecoveryCode(ctx context.Context, q queryer, username string, code string, now time.Time) error {
+	stmt := `
+		UPDATE recovery_codes SET used_at = $1
+		WHERE used_at IS NULL AND id = (
+			SELECT id FROM recovery_codes
+			WHERE username = $2 AND code_hash = $3 AND used_at IS NULL
+			LIMIT 1
+		)
+	`
+	result, err := q.ExecContext(ctx, stmt, now, username, hashSecret(code))
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrInvalidRecoveryCode)
+}
+
+func disableMFA(ctx context.Context, db *sql.DB, username string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE username = $1`, username)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE username = $1`, username)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUserMFA returns the TOTP enrolment of a user, ErrMFANotEnrolled if there is none
+func (m *PostgresDBRepo) GetUserMFA(username string) (*models.UserMFA, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return getUserMFA(ctx, m.DB, username)
+}
+
+// BeginMFAEnrolment stores the secret of a new TOTP enrolment, replacing an unconfirmed
+// one. It returns ErrMFAAlreadyEnabled if the user already enabled TOTP.
+func (m *PostgresDBRepo) BeginMFAEnrolment(username string, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return beginMFAEnrolment(ctx, m.DB, username, secret, time.Now())
+}
+
+// EnableMFA confirms the enrolment with the time step of the user's first code and
+// replaces their recovery codes
+func (m *PostgresDBRepo) EnableMFA(username string, step int64, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return enableMFA(ctx, m.DB, username, step, recoveryCodes, time.Now())
+}
+
+// UseTOTPStep records the time step of an accepted code. It returns ErrTOTPCodeReused
+// for a step that is not newer than the last accepted one, so a code cannot be replayed.
+func (m *PostgresDBRepo) UseTOTPStep(username string, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return useTOTPStep(ctx, m.DB, username, step)
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes
+func (m *PostgresDBRepo) UseRecoveryCode(username string, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return useRecoveryCode(ctx, m.DB, username, code, time.Now())
+}
+
+// DisableMFA removes the user's TOTP enrolment and recovery codes
+func (m *PostgresDBRepo) DisableMFA(username string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return disableMFA(ctx, m.DB, username)
+}
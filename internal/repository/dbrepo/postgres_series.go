@@ -0,0 +1,283 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"database/sql"
+	"time"
+)
+
+const seriesColumns = `id, username, name, unit_number, purpose, facility, start_time, end_time,
+	rrule, exdates, time_zone, created_at`
+
+func scanSeries(row scanner) (*models.BookingSeries, error) {
+	var series models.BookingSeries
+	var exdates string
+	err := row.Scan(
+		&series.ID,
+		&series.Username,
+		&series.Name,
+		&series.UnitNumber,
+		&series.Purpose,
+		&series.Facility,
+		&series.StartTime,
+		&series.EndTime,
+		&series.RRule,
+		&exdates,
+		&series.TimeZone,
+		&series.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrBookingSeriesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	series.ExDates, err = parseExDates(exdates)
+	if err != nil {
+		return nil, err
+	}
+
+	return &series, nil
+}
+
+// scanStoredOccurrences reads rows of id, start_time, end_time, original_start and purpose
+func scanStoredOccurrences(rows *sql.Rows) ([]storedOccurrence, error) {
+	var occurrences []storedOccurrence
+	for rows.Next() {
+		var occurrence storedOccurrence
+		err := rows.Scan(
+			&occurrence.ID,
+			&occurrence.StartTime,
+			&occurrence.EndTime,
+			&occurrence.OriginalStart,
+			&occurrence.Purpose,
+		)
+		if err != nil {
+			return nil, err
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	return occurrences, rows.Err()
+}
+
+func (m *PostgresDBRepo) insertSeries(ctx context.Context, q queryer, series *models.BookingSeries) error {
+	stmt := `INSERT INTO booking_series (username, name, unit_number, purpose, facility, start_time, end_time,
+		rrule, exdates, time_zone, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+
+	return q.QueryRowContext(ctx, stmt, series.Username, series.Name, series.UnitNumber, series.Purpose,
+		series.Facility, series.StartTime, series.EndTime, series.RRule, formatExDates(series.ExDates),
+		series.TimeZone, series.CreatedAt).Scan(&series.ID)
+}
+
+func (m *PostgresDBRepo) GetBookingSeries(id int) (*models.BookingSeries, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + seriesColumns + ` FROM booking_series WHERE id = $1`
+	series, err := scanSeries(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	occurrencesQuery := `
+		SELECT 
+			id, username, name, start_date, end_date, unit_number, 
+			start_time, end_time, purpose, facility, series_id 
+		FROM 
+			recurringbookings
+		WHERE
+			series_id = $1
+		ORDER BY 
+			start_time ASC
+	`
+	rows, err := m.DB.QueryContext(ctx, occurrencesQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var booking models.SubmittedBooking
+		err := rows.Scan(
+			&booking.ID,
+			&booking.Username,
+			&booking.Name,
+			&booking.StartDate,
+			&booking.EndDate,
+			&booking.UnitNumber,
+			&booking.StartTime,
+			&booking.EndTime,
+			&booking.Purpose,
+			&booking.Facility,
+			&booking.SeriesID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		series.Occurrences = append(series.Occurrences, &booking)
+	}
+
+	return series, rows.Err()
+}
+
+// seriesForChange locks a series and loads its occurrences and facility to plan a change against
+func (m *PostgresDBRepo) seriesForChange(ctx context.Context, tx *sql.Tx, id int) (*models.BookingSeries, []storedOccurrence, *models.Facility, error) {
+	query := `SELECT ` + seriesColumns + ` FROM booking_series WHERE id = $1 FOR UPDATE`
+	series, err := scanSeries(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	occurrencesQuery := `
+		SELECT id, start_time, end_time, original_start, purpose
+		FROM recurringbookings
+		WHERE series_id = $1
+		ORDER BY original_start ASC
+	`
+	rows, err := tx.QueryContext(ctx, occurrencesQuery, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	occurrences, err := scanStoredOccurrences(rows)
+	rows.Close()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	facility, err := m.facilityByName(ctx, tx, series.Facility)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return series, occurrences, facility, nil
+}
+
+// applySeriesPlan writes a planned change of the series with the given id. It rolls
+// back tx if any statement fails.
+func (m *PostgresDBRepo) applySeriesPlan(ctx context.Context, tx *sql.Tx, id int, facility string, plan *seriesPlan) error {
+	if plan.Series == nil {
+		// the series owns its occurrences, they are deleted with it
+		_, err := tx.ExecContext(ctx, `DELETE FROM booking_series WHERE id = $1`, id)
+		if err != nil {
+			_ = tx.Rollback()
+		}
+		return err
+	}
+
+	updateStmt := `UPDATE booking_series SET purpose = $1, start_time = $2, end_time = $3, rrule = $4, exdates = $5
+		WHERE id = $6`
+	_, err := tx.ExecContext(ctx, updateStmt, plan.Series.Purpose, plan.Series.StartTime, plan.Series.EndTime,
+		plan.Series.RRule, formatExDates(plan.Series.ExDates), id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	owner := id
+	if plan.Split != nil {
+		err = m.insertSeries(ctx, tx, plan.Split)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		owner = plan.Split.ID
+	}
+
+	for _, occurrenceID := range plan.Deleted {
+		_, err = tx.ExecContext(ctx, `DELETE FROM recurringbookings WHERE id = $1`, occurrenceID)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	// overlaps with other bookings are caught by the exclusion constraint on booking_slots
+	moveStmt := `UPDATE recurringbookings SET start_date = $1, end_date = $2, start_time = $3, end_time = $4,
+		purpose = $5, series_id = $6 WHERE id = $7`
+	for _, slot := range plan.Moved {
+		_, err = tx.ExecContext(ctx, moveStmt, slot.StartDate, slot.EndDate, slot.StartTime, slot.EndTime,
+			slot.Purpose, owner, slot.ID)
+		if err != nil {
+			_ = tx.Rollback()
+			return m.overlapError(ctx, err, facility, slot.StartTime, slot.EndTime)
+		}
+	}
+
+	return nil
+}
+
+func (m *PostgresDBRepo) UpdateSeriesOccurrence(change models.OccurrenceChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	series, occurrences, facility, err := m.seriesForChange(ctx, tx, change.SeriesID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	plan, err := planSeriesUpdate(series, occurrences, change, facility, time.Now())
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = m.applySeriesPlan(ctx, tx, series.ID, series.Facility, plan)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *PostgresDBRepo) CancelSeriesOccurrence(change models.OccurrenceChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	series, occurrences, _, err := m.seriesForChange(ctx, tx, change.SeriesID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	plan, err := planSeriesCancel(series, occurrences, change)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = m.applySeriesPlan(ctx, tx, series.ID, series.Facility, plan)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *PostgresDBRepo) DeleteBookingSeries(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// the series owns its occurrences, they are deleted with it
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM booking_series WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrBookingSeriesNotFound)
+}
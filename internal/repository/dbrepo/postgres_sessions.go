@@ -0,0 +1,126 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"time"
+)
+
+// Sessions are refresh token families with a token that can still be used, the
+// Postgres and SQLite repositories share their SQL
+
+// userSessions returns the active sessions of a user, the most recently used first
+func userSessions(ctx context.Context, q queryer, username string, now time.Time) ([]*models.Session, error) {
+	query := `
+		SELECT family_id, username, user_agent, ip_address, mfa, started_at, created_at, expires_at
+		FROM refresh_tokens
+		WHERE username = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := q.QueryContext(ctx, query, username, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.Username,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.MFA,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// revokeSession revokes a session of a user, ErrSessionNotFound if the user has no
+// active session with the id
+func revokeSession(ctx context.Context, q queryer, username string, sessionID string, now time.Time) error {
+	stmt := `
+		UPDATE refresh_tokens SET revoked_at = $1
+		WHERE family_id = $2 AND username = $3 AND revoked_at IS NULL
+		AND EXISTS (
+			SELECT 1 FROM refresh_tokens
+			WHERE family_id = $2 AND username = $3 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $1
+		)
+	`
+	result, err := q.ExecContext(ctx, stmt, now, sessionID, username)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrSessionNotFound)
+}
+
+// revokeUserSessions revokes every session of a user except keepSessionID, which may
+// be empty to sign the user out everywhere
+func revokeUserSessions(ctx context.Context, q queryer, username string, keepSessionID string, now time.Time) error {
+	_, err := q.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE username = $2 AND family_id <> $3 AND revoked_at IS NULL`,
+		now, username, keepSessionID,
+	)
+	return err
+}
+
+// sessionActive reports whether the user has an active session with the id
+func sessionActive(ctx context.Context, q queryer, username string, sessionID string, now time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM refresh_tokens
+			WHERE family_id = $1 AND username = $2 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $3
+		)
+	`
+
+	var active bool
+	err := q.QueryRowContext(ctx, query, sessionID, username, now).Scan(&active)
+	return active, err
+}
+
+// UserSessions returns the active sessions of a user, the most recently used first
+func (m *PostgresDBRepo) UserSessions(username string) ([]*models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return userSessions(ctx, m.DB, username, time.Now())
+}
+
+// RevokeSession ends a session of a user. It returns ErrSessionNotFound if the user
+// has no active session with the id.
+func (m *PostgresDBRepo) RevokeSession(username string, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return revokeSession(ctx, m.DB, username, sessionID, time.Now())
+}
+
+// RevokeUserSessions ends every session of a user except keepSessionID, which may be
+// empty to end them all
+func (m *PostgresDBRepo) RevokeUserSessions(username string, keepSessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return revokeUserSessions(ctx, m.DB, username, keepSessionID, time.Now())
+}
+
+// SessionActive reports whether the user has an active session with the id, so access
+// tokens of a session that was signed out can be rejected
+func (m *PostgresDBRepo) SessionActive(username string, sessionID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return sessionActive(ctx, m.DB, username, sessionID, time.Now())
+}
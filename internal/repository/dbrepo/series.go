@@ -0,0 +1,431 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/recurrence"
+	"booking-backend/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// seriesOccurrence is one occurrence of a recurring booking
+type seriesOccurrence struct {
+	StartDate time.Time
+	EndDate   time.Time
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// recurrenceRule returns the rule a recurring request repeats by. Requests that
+// predate recurrence rules only carry a number of weeks.
+func recurrenceRule(rrule string, recurringWeeks int) (*recurrence.Rule, error) {
+	if rrule == "" {
+		if recurringWeeks < 1 {
+			return nil, repository.InvalidInput(errors.New("recurring booking needs a recurrence rule or a number of weeks"))
+		}
+		return recurrence.EveryWeek(recurringWeeks), nil
+	}
+
+	rule, err := recurrence.Parse(rrule)
+	if err != nil {
+		return nil, repository.InvalidInput(fmt.Errorf("invalid recurrence rule: %w", err))
+	}
+
+	return rule, nil
+}
+
+// seriesTimeZone returns the time zone a series is expanded in, the facility's unless the booking names one
+func seriesTimeZone(timeZone string, facility *models.Facility) (*time.Location, string, error) {
+	if timeZone == "" {
+		timeZone = facility.Rules.TimeZone
+	}
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, "", repository.InvalidInput(fmt.Errorf("invalid time zone %q", timeZone))
+	}
+
+	return loc, timeZone, nil
+}
+
+// newSeries expands a recurring request into its series and occurrences. Each
+// occurrence starts at the wall clock time of the first one in the series' time
+// zone and lasts as long, so DST changes do not shift the booking.
+func newSeries(booking models.RequestedBooking, facility *models.Facility) (*models.BookingSeries, []seriesOccurrence, error) {
+	rule, err := recurrenceRule(booking.RRule, booking.RecurringWeeks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loc, timeZone, err := seriesTimeZone(booking.TimeZone, facility)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startTime, endTime, err := parseBookingTimes(booking.StartTime, booking.EndTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	length := endTime.Sub(startTime)
+
+	starts, err := rule.Expand(startTime.In(loc), booking.ExDates)
+	if err != nil {
+		return nil, nil, repository.InvalidInput(err)
+	}
+	if len(starts) == 0 {
+		return nil, nil, repository.InvalidInput(errors.New("recurrence rule does not produce any occurrence"))
+	}
+
+	var occurrences []seriesOccurrence
+	for _, occurrenceStart := range starts {
+		occurrenceEnd := occurrenceStart.Add(length)
+		occurrences = append(occurrences, seriesOccurrence{
+			StartDate: localDate(occurrenceStart),
+			EndDate:   localDate(occurrenceEnd),
+			StartTime: occurrenceStart,
+			EndTime:   occurrenceEnd,
+		})
+	}
+
+	series := &models.BookingSeries{
+		Username:   booking.Username,
+		Name:       booking.Name,
+		UnitNumber: booking.UnitNumber,
+		Purpose:    booking.Purpose,
+		Facility:   booking.Facility,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		RRule:      rule.String(),
+		ExDates:    booking.ExDates,
+		TimeZone:   timeZone,
+		CreatedAt:  time.Now(),
+	}
+
+	return series, occurrences, nil
+}
+
+// localDate is the calendar date of t in its own location, as stored in DATE columns
+func localDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// normaliseRecurrence checks the recurrence of a booking request before it is stored
+// and fills in the rule and time zone it will be expanded with on approval
+func normaliseRecurrence(booking *models.Booking, facility *models.Facility) error {
+	if !booking.Recurring {
+		booking.RRule = ""
+		booking.ExDates = nil
+		booking.TimeZone = ""
+		return nil
+	}
+
+	// expand once so rules that run too long or never match are rejected up front
+	series, _, err := newSeries(models.RequestedBooking{
+		StartTime:      booking.StartTime,
+		EndTime:        booking.EndTime,
+		RRule:          booking.RRule,
+		RecurringWeeks: booking.RecurringWeeks,
+		ExDates:        booking.ExDates,
+		TimeZone:       booking.TimeZone,
+	}, facility)
+	if err != nil {
+		return err
+	}
+
+	booking.RRule = series.RRule
+	booking.TimeZone = series.TimeZone
+
+	return nil
+}
+
+// formatExDates stores exdates as a comma separated list of UTC timestamps
+func formatExDates(exdates []time.Time) string {
+	var values []string
+	for _, exdate := range exdates {
+		values = append(values, exdate.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(values, ",")
+}
+
+func parseExDates(value string) ([]time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var exdates []time.Time
+	for _, item := range strings.Split(value, ",") {
+		exdate, err := time.Parse(time.RFC3339, item)
+		if err != nil {
+			return nil, err
+		}
+		exdates = append(exdates, exdate)
+	}
+	return exdates, nil
+}
+
+// storedOccurrence is an occurrence of a series as loaded to plan a change. OriginalStart
+// is where the rule put it, StartTime may differ once the occurrence has been moved.
+type storedOccurrence struct {
+	ID            int
+	StartTime     time.Time
+	EndTime       time.Time
+	OriginalStart time.Time
+	Purpose       string
+}
+
+// occurrenceSlot is the new slot of an occurrence touched by a change
+type occurrenceSlot struct {
+	seriesOccurrence
+	ID      int
+	Purpose string
+}
+
+// seriesPlan is how a change affects a series and its occurrences
+type seriesPlan struct {
+	// Series is the series with its updated rule, exdates and times, nil if it is deleted
+	Series *models.BookingSeries
+	// Split is a new series taking over the occurrences from the changed one on, it has no ID yet
+	Split *models.BookingSeries
+	// Moved are occurrences with their new slot, they belong to Split if there is one
+	Moved []occurrenceSlot
+	// Deleted are the ids of cancelled occurrences
+	Deleted []int
+}
+
+func copySeries(series *models.BookingSeries) *models.BookingSeries {
+	copied := *series
+	copied.ExDates = append([]time.Time(nil), series.ExDates...)
+	copied.Occurrences = nil
+	return &copied
+}
+
+// selectOccurrences returns the occurrence a change names and every occurrence its scope covers
+func selectOccurrences(occurrences []storedOccurrence, change models.OccurrenceChange) (storedOccurrence, []storedOccurrence, error) {
+	var target *storedOccurrence
+	for i := range occurrences {
+		if occurrences[i].ID == change.OccurrenceID {
+			target = &occurrences[i]
+		}
+	}
+	if target == nil {
+		return storedOccurrence{}, nil, repository.ErrOccurrenceNotFound
+	}
+
+	var selected []storedOccurrence
+	switch change.Scope {
+	case models.ScopeThis:
+		selected = []storedOccurrence{*target}
+	case models.ScopeFollowing:
+		for _, occurrence := range occurrences {
+			if !occurrence.OriginalStart.Before(target.OriginalStart) {
+				selected = append(selected, occurrence)
+			}
+		}
+	case models.ScopeAll:
+		selected = occurrences
+	default:
+		return storedOccurrence{}, nil, repository.InvalidInput(fmt.Errorf("scope must be %q, %q or %q",
+			models.ScopeThis, models.ScopeFollowing, models.ScopeAll))
+	}
+
+	return *target, selected, nil
+}
+
+// atClock returns the time of day of clock on the local date of day
+func atClock(day, clock time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, clock.Location())
+}
+
+// splitSeries ends a series before the occurrence the rule puts at at and returns
+// the series continuing from there, exdates go with the half they fall in
+func splitSeries(series *models.BookingSeries, at time.Time) (*models.BookingSeries, *models.BookingSeries, error) {
+	rule, err := recurrence.Parse(series.RRule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loc, err := time.LoadLocation(series.TimeZone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headRule := *rule
+	headRule.Count = 0
+	headRule.Until = at.Add(-time.Second).UTC()
+	headRule.FloatingUntil = false
+
+	tailRule := *rule
+	if rule.Count > 0 {
+		// the tail keeps the occurrences the head gives up, cancelled ones included
+		starts, err := rule.Expand(series.StartTime.In(loc), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, start := range starts {
+			if start.Before(at) {
+				tailRule.Count--
+			}
+		}
+	}
+
+	head := copySeries(series)
+	head.RRule = headRule.String()
+	head.ExDates = nil
+
+	tail := copySeries(series)
+	tail.ID = 0
+	tail.RRule = tailRule.String()
+	tail.ExDates = nil
+	tail.StartTime = at
+	tail.EndTime = at.Add(series.EndTime.Sub(series.StartTime))
+	tail.CreatedAt = time.Now()
+
+	atDate := localDate(at.In(loc))
+	for _, exdate := range series.ExDates {
+		if localDate(exdate.In(loc)).Before(atDate) {
+			head.ExDates = append(head.ExDates, exdate)
+		} else {
+			tail.ExDates = append(tail.ExDates, exdate)
+		}
+	}
+
+	return head, tail, nil
+}
+
+// planSeriesUpdate moves the occurrences a change covers to the new time and keeps the
+// series' metadata in step, a change without times only sets the purpose. Changing
+// following occurrences splits the series in two, like calendar apps do. Occurrences
+// that started before now stay as they were when following occurrences or the whole
+// series change; following ones still go to the split-off series, whose rule covers them.
+func planSeriesUpdate(series *models.BookingSeries, occurrences []storedOccurrence, change models.OccurrenceChange, facility *models.Facility, now time.Time) (*seriesPlan, error) {
+	target, selected, err := selectOccurrences(occurrences, change)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, _, err := seriesTimeZone(series.TimeZone, facility)
+	if err != nil {
+		return nil, err
+	}
+
+	keepTimes := change.StartTime == "" && change.EndTime == ""
+	if keepTimes && change.Purpose == "" {
+		return nil, repository.InvalidInput(errors.New("change the time or the purpose"))
+	}
+
+	var newStart time.Time
+	var length time.Duration
+	if !keepTimes {
+		startTime, endTime, err := parseBookingTimes(change.StartTime, change.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		if !endTime.After(startTime) {
+			return nil, repository.InvalidInput(errors.New("end time must be after start time"))
+		}
+		newStart = startTime.In(loc)
+		length = endTime.Sub(startTime)
+
+		if change.Scope != models.ScopeThis && !localDate(newStart).Equal(localDate(target.StartTime.In(loc))) {
+			return nil, repository.InvalidInput(errors.New("following occurrences or a whole series can only be moved within the day"))
+		}
+	}
+
+	plan := &seriesPlan{Series: copySeries(series)}
+	for _, occurrence := range selected {
+		slot := occurrenceSlot{ID: occurrence.ID, Purpose: occurrence.Purpose}
+		start, end := occurrence.StartTime.In(loc), occurrence.EndTime.In(loc)
+
+		if change.Scope != models.ScopeThis && occurrence.StartTime.Before(now) {
+			if change.Scope == models.ScopeAll {
+				continue
+			}
+		} else {
+			if change.Purpose != "" {
+				slot.Purpose = change.Purpose
+			}
+			if !keepTimes {
+				start = newStart
+				if change.Scope != models.ScopeThis {
+					start = atClock(occurrence.StartTime.In(loc), newStart)
+				}
+				end = start.Add(length)
+
+				// the moved occurrence has to respect the facility's current rules, including
+				// its lead time and how far ahead it can be booked
+				err = facility.Rules.Check(start, end, now)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		slot.seriesOccurrence = seriesOccurrence{
+			StartDate: localDate(start),
+			EndDate:   localDate(end),
+			StartTime: start,
+			EndTime:   end,
+		}
+		plan.Moved = append(plan.Moved, slot)
+	}
+
+	if change.Scope == models.ScopeThis {
+		return plan, nil
+	}
+
+	// changing the following occurrences from the first one on changes the whole series
+	updated := plan.Series
+	if change.Scope == models.ScopeFollowing && target.OriginalStart.After(series.StartTime) {
+		plan.Series, plan.Split, err = splitSeries(series, target.OriginalStart)
+		if err != nil {
+			return nil, err
+		}
+		updated = plan.Split
+	}
+
+	if !keepTimes {
+		updated.StartTime = atClock(updated.StartTime.In(loc), newStart)
+		updated.EndTime = updated.StartTime.Add(length)
+	}
+	if change.Purpose != "" {
+		updated.Purpose = change.Purpose
+	}
+
+	return plan, nil
+}
+
+// planSeriesCancel cancels the occurrences a change covers. A cancelled single occurrence
+// becomes an exdate, cancelling the following ones ends the series before it.
+func planSeriesCancel(series *models.BookingSeries, occurrences []storedOccurrence, change models.OccurrenceChange) (*seriesPlan, error) {
+	target, selected, err := selectOccurrences(occurrences, change)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &seriesPlan{}
+	for _, occurrence := range selected {
+		plan.Deleted = append(plan.Deleted, occurrence.ID)
+	}
+
+	switch change.Scope {
+	case models.ScopeThis:
+		plan.Series = copySeries(series)
+		plan.Series.ExDates = append(plan.Series.ExDates, target.OriginalStart)
+	case models.ScopeFollowing:
+		// cancelling from the first occurrence on leaves nothing of the series
+		if target.OriginalStart.After(series.StartTime) {
+			plan.Series, _, err = splitSeries(series, target.OriginalStart)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,114 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"testing"
+	"time"
+)
+
+func TestPlanSeriesUpdate(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	facility := &models.Facility{Name: "Function Room", Rules: models.FacilityRules{TimeZone: "Europe/London"}}
+
+	// four weekly occurrences at 19:00 from a Monday, the first two have started
+	first := time.Date(2026, time.November, 2, 19, 0, 0, 0, london)
+	week := func(n, hour int) time.Time { return first.AddDate(0, 0, 7*n).Add(time.Duration(hour-19) * time.Hour) }
+	now := week(1, 19).Add(30 * time.Minute)
+
+	series := &models.BookingSeries{
+		ID:        1,
+		Purpose:   "yoga",
+		Facility:  facility.Name,
+		StartTime: first,
+		EndTime:   first.Add(time.Hour),
+		RRule:     "FREQ=WEEKLY;COUNT=4",
+		TimeZone:  "Europe/London",
+	}
+	var occurrences []storedOccurrence
+	for i := 0; i < 4; i++ {
+		occurrences = append(occurrences, storedOccurrence{
+			ID:            10 + i,
+			StartTime:     week(i, 19),
+			EndTime:       week(i, 20),
+			OriginalStart: week(i, 19),
+			Purpose:       "yoga",
+		})
+	}
+
+	change := func(occurrence int, scope string, hour int) models.OccurrenceChange {
+		return models.OccurrenceChange{
+			SeriesID:     series.ID,
+			OccurrenceID: occurrences[occurrence].ID,
+			Scope:        scope,
+			StartTime:    week(occurrence, hour).Format(time.RFC3339),
+			EndTime:      week(occurrence, hour+1).Format(time.RFC3339),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change models.OccurrenceChange
+		// moved maps the ids of the occurrences in the plan to their new start
+		moved map[int]time.Time
+		split bool
+	}{
+		{
+			name:   "all skips started occurrences",
+			change: change(2, models.ScopeAll, 18),
+			moved:  map[int]time.Time{12: week(2, 18), 13: week(3, 18)},
+		},
+		{
+			name:   "following from an upcoming occurrence",
+			change: change(2, models.ScopeFollowing, 18),
+			moved:  map[int]time.Time{12: week(2, 18), 13: week(3, 18)},
+			split:  true,
+		},
+		{
+			// the started occurrence stays where it was but leaves the head series, whose
+			// rule ends before it
+			name:   "following from a started occurrence",
+			change: change(1, models.ScopeFollowing, 18),
+			moved:  map[int]time.Time{11: week(1, 19), 12: week(2, 18), 13: week(3, 18)},
+			split:  true,
+		},
+		{
+			name:   "purpose only",
+			change: models.OccurrenceChange{SeriesID: series.ID, OccurrenceID: 12, Scope: models.ScopeFollowing, Purpose: "pilates"},
+			moved:  map[int]time.Time{12: week(2, 19), 13: week(3, 19)},
+			split:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planSeriesUpdate(series, occurrences, tt.change, facility, now)
+			if err != nil {
+				t.Fatalf("planSeriesUpdate: %v", err)
+			}
+			if (plan.Split != nil) != tt.split {
+				t.Errorf("split = %v, want %v", plan.Split != nil, tt.split)
+			}
+
+			if len(plan.Moved) != len(tt.moved) {
+				t.Errorf("plan has %d occurrences, want %d", len(plan.Moved), len(tt.moved))
+			}
+			for _, slot := range plan.Moved {
+				want, ok := tt.moved[slot.ID]
+				if !ok {
+					t.Errorf("occurrence %d is in the plan", slot.ID)
+					continue
+				}
+				if !slot.StartTime.Equal(want) || !slot.EndTime.Equal(want.Add(time.Hour)) {
+					t.Errorf("occurrence %d at %s-%s, want %s for an hour", slot.ID, slot.StartTime, slot.EndTime, want)
+				}
+			}
+		})
+	}
+
+	if _, err := planSeriesUpdate(series, occurrences, models.OccurrenceChange{SeriesID: 1, OccurrenceID: 12, Scope: models.ScopeAll}, facility, now); err == nil {
+		t.Errorf("a change without times or purpose was accepted")
+	}
+}
@@ -0,0 +1,49 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"context"
+	"time"
+)
+
+// InsertAPIKey stores the hash of a newly minted API key and returns its id
+func (m *SQLiteDBRepo) InsertAPIKey(key models.APIKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertAPIKey(ctx, m.DB, key, time.Now().UTC())
+}
+
+// GetAPIKey returns the stored API key matching key, ErrInvalidAPIKey if there is
+// none. Revoked and expired keys are returned as well, see APIKey.Active.
+func (m *SQLiteDBRepo) GetAPIKey(key string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return getAPIKey(ctx, m.DB, key)
+}
+
+// AllAPIKeys lists every API key, the newest first
+func (m *SQLiteDBRepo) AllAPIKeys() ([]*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return allAPIKeys(ctx, m.DB)
+}
+
+// RevokeAPIKey stops an API key from working, ErrAPIKeyNotFound if there is no
+// unrevoked key with the id
+func (m *SQLiteDBRepo) RevokeAPIKey(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return revokeAPIKey(ctx, m.DB, id, time.Now().UTC())
+}
+
+// TouchAPIKey records that an API key was just used from ip
+func (m *SQLiteDBRepo) TouchAPIKey(id int, ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return touchAPIKey(ctx, m.DB, id, ip, time.Now().UTC())
+}
@@ -0,0 +1,868 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteDBRepo stores everything in a single SQLite file for small deployments.
+// The schema mirrors the Postgres one; timestamps are always written in UTC so that
+// SQLite's text comparisons order them correctly. The connection pool must be limited
+// to a single connection, which serialises transactions the way SQLite needs.
+type SQLiteDBRepo struct {
+	DB *sql.DB
+}
+
+func (m *SQLiteDBRepo) Connection() *sql.DB {
+	return m.DB
+}
+
+// isSQLiteUniqueViolation reports whether err is a UNIQUE constraint failure
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// isSQLiteOverlapViolation reports whether err was raised by the no_overlap triggers,
+// the SQLite stand-in for the booking_slots exclusion constraint
+func isSQLiteOverlapViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && strings.Contains(sqliteErr.Error(), "booking_slots_no_overlap")
+}
+
+func (m *SQLiteDBRepo) AllBookings() ([]*models.SubmittedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+	select
+		id, username, name, start_date, end_date, unit_number,
+		start_time, end_time, purpose, facility
+	from
+		approvedbookings
+	order by
+		start_date ASC, start_time ASC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSubmittedBookings(rows)
+}
+
+func (m *SQLiteDBRepo) TwoWeekBookings() ([]*models.SubmittedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// the Monday of the current week, like date_trunc('week', current_date)
+	today := toDate(time.Now())
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	weekEnd := weekStart.AddDate(0, 0, 14)
+
+	query := `
+		SELECT
+				id, username, name, start_date, end_date, unit_number,
+				start_time, end_time, purpose, facility
+		FROM
+				approvedbookings
+		WHERE
+				start_date >= $1 AND end_date < $2
+		UNION
+		SELECT
+				id, username, name, start_date, end_date, unit_number,
+				start_time, end_time, purpose, facility
+		FROM
+				recurringbookings
+		WHERE
+				start_date >= $1 AND end_date < $2
+		ORDER BY
+				start_date ASC, start_time ASC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, weekStart, weekEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSubmittedBookings(rows)
+}
+
+func (m *SQLiteDBRepo) AdminBookings() ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error) {
+	return m.bookings("")
+}
+
+func (m *SQLiteDBRepo) UserBookings(username string) ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error) {
+	return m.bookings(username)
+}
+
+// bookings returns the recurring, approved and requested bookings of a user, or of everyone if username is empty
+func (m *SQLiteDBRepo) bookings(username string) ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	filter := `WHERE $1 = '' OR username = $1`
+
+	recurringQuery := `
+		SELECT
+			id, username, name, start_date, end_date, unit_number,
+			start_time, end_time, purpose, facility, series_id
+		FROM
+			recurringbookings
+		` + filter + `
+		ORDER BY
+			start_date ASC, start_time ASC
+	`
+	recurringRows, err := m.DB.QueryContext(ctx, recurringQuery, username)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	recurringBookings, err := scanRecurringBookings(recurringRows)
+	recurringRows.Close()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	approvedQuery := `
+		SELECT
+			id, username, name, start_date, end_date, unit_number,
+			start_time, end_time, purpose, facility
+		FROM
+			approvedbookings
+		` + filter + `
+		ORDER BY
+			start_date ASC, start_time ASC
+	`
+	approvedRows, err := m.DB.QueryContext(ctx, approvedQuery, username)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	approvedBookings, err := scanSubmittedBookings(approvedRows)
+	approvedRows.Close()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	requestedQuery := `
+		SELECT
+			id, username, name, start_date, end_date, unit_number,
+			start_time, end_time, purpose, facility, is_recurring, recurring_weeks,
+			rrule, exdates, time_zone
+		FROM
+			requestedbookings
+		` + filter + `
+		ORDER BY
+			start_date ASC, start_time ASC
+	`
+	requestedRows, err := m.DB.QueryContext(ctx, requestedQuery, username)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer requestedRows.Close()
+
+	var requestedBookings []*models.RequestedBooking
+	for requestedRows.Next() {
+		var booking models.RequestedBooking
+		var exdates string
+		err := requestedRows.Scan(
+			&booking.ID,
+			&booking.Username,
+			&booking.Name,
+			&booking.StartDate,
+			&booking.EndDate,
+			&booking.UnitNumber,
+			&booking.StartTime,
+			&booking.EndTime,
+			&booking.Purpose,
+			&booking.Facility,
+			&booking.Recurring,
+			&booking.RecurringWeeks,
+			&booking.RRule,
+			&exdates,
+			&booking.TimeZone,
+		)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		booking.ExDates, err = parseExDates(exdates)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		requestedBookings = append(requestedBookings, &booking)
+	}
+
+	return recurringBookings, approvedBookings, requestedBookings, requestedRows.Err()
+}
+
+func scanSubmittedBookings(rows *sql.Rows) ([]*models.SubmittedBooking, error) {
+	var bookings []*models.SubmittedBooking
+	for rows.Next() {
+		var booking models.SubmittedBooking
+		err := rows.Scan(
+			&booking.ID,
+			&booking.Username,
+			&booking.Name,
+			&booking.StartDate,
+			&booking.EndDate,
+			&booking.UnitNumber,
+			&booking.StartTime,
+			&booking.EndTime,
+			&booking.Purpose,
+			&booking.Facility,
+		)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, &booking)
+	}
+
+	return bookings, rows.Err()
+}
+
+// scanRecurringBookings is scanSubmittedBookings for rows that end with the series_id column
+func scanRecurringBookings(rows *sql.Rows) ([]*models.SubmittedBooking, error) {
+	var bookings []*models.SubmittedBooking
+	for rows.Next() {
+		var booking models.SubmittedBooking
+		err := rows.Scan(
+			&booking.ID,
+			&booking.Username,
+			&booking.Name,
+			&booking.StartDate,
+			&booking.EndDate,
+			&booking.UnitNumber,
+			&booking.StartTime,
+			&booking.EndTime,
+			&booking.Purpose,
+			&booking.Facility,
+			&booking.SeriesID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, &booking)
+	}
+
+	return bookings, rows.Err()
+}
+
+// findOverlap returns the first approved or recurring booking of the given facility
+// that overlaps [start, end), or nil if the slot is free
+func (m *SQLiteDBRepo) findOverlap(ctx context.Context, q queryer, facility string, start, end time.Time) (*models.BookingConflict, error) {
+	query := `
+		SELECT id, kind, facility, start_time, end_time
+		FROM (
+			SELECT id, 'approved' AS kind, facility, start_time, end_time
+			FROM approvedbookings
+			UNION ALL
+			SELECT id, 'recurring' AS kind, facility, start_time, end_time
+			FROM recurringbookings
+		) AS all_bookings
+		WHERE
+			facility = $1
+			AND ($2 < end_time AND $3 > start_time)
+		ORDER BY
+			start_time ASC
+		LIMIT 1;
+	`
+
+	var conflict models.BookingConflict
+	err := q.QueryRowContext(ctx, query, facility, start.UTC(), end.UTC()).Scan(
+		&conflict.BookingID,
+		&conflict.Kind,
+		&conflict.Facility,
+		&conflict.StartTime,
+		&conflict.EndTime,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &conflict, nil
+}
+
+func (m *SQLiteDBRepo) checkOverlap(ctx context.Context, q queryer, facility string, start, end time.Time) error {
+	conflict, err := m.findOverlap(ctx, q, facility, start, end)
+	if err != nil {
+		return err
+	}
+
+	if conflict != nil {
+		return &repository.ConflictError{Conflict: *conflict}
+	}
+
+	return nil
+}
+
+// overlapError turns a failure of the no_overlap triggers into a ConflictError.
+// Other errors are returned as is. The transaction must already be rolled back.
+func (m *SQLiteDBRepo) overlapError(ctx context.Context, err error, facility string, start, end time.Time) error {
+	if !isSQLiteOverlapViolation(err) {
+		return err
+	}
+
+	conflict, findErr := m.findOverlap(ctx, m.DB, facility, start, end)
+	if findErr != nil || conflict == nil {
+		return &repository.ConflictError{Conflict: models.BookingConflict{
+			Facility:  facility,
+			StartTime: start,
+			EndTime:   end,
+		}}
+	}
+
+	return &repository.ConflictError{Conflict: *conflict}
+}
+
+func (m *SQLiteDBRepo) InsertBookingRequest(booking models.Booking) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// only active facilities in the catalogue can be booked
+	facility, err := m.facilityByName(ctx, m.DB, booking.Facility)
+	if err != nil {
+		return err
+	}
+	if !facility.Active {
+		return repository.ErrFacilityArchived
+	}
+
+	startTime, endTime, err := parseBookingTimes(booking.StartTime, booking.EndTime)
+	if err != nil {
+		return err
+	}
+
+	// the booking has to respect the facility's opening hours and booking window
+	err = facility.Rules.Check(startTime, endTime, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// a recurring request must have a rule that expands to a bounded series
+	err = normaliseRecurrence(&booking, facility)
+	if err != nil {
+		return err
+	}
+
+	// check for overlaps with bookings of the same facility
+	err = m.checkOverlap(ctx, m.DB, booking.Facility, startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into requestedbookings (username, name, start_date, end_date, unit_number, start_time,
+		end_time, purpose, facility, is_recurring, recurring_weeks, rrule, exdates, time_zone)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+
+	_, err = m.DB.ExecContext(ctx, stmt,
+		booking.Username,
+		booking.Name,
+		toDate(booking.StartDate),
+		toDate(booking.EndDate),
+		booking.UnitNumber,
+		startTime.UTC(),
+		endTime.UTC(),
+		booking.Purpose,
+		booking.Facility,
+		booking.Recurring,
+		booking.RecurringWeeks,
+		booking.RRule,
+		formatExDates(booking.ExDates),
+		booking.TimeZone,
+	)
+
+	return err
+}
+
+func (m *SQLiteDBRepo) ApproveBookingRequest(booking models.RequestedBooking) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	facility, err := m.facilityByName(ctx, m.DB, booking.Facility)
+	if err != nil {
+		return err
+	}
+
+	startTime, endTime, err := parseBookingTimes(booking.StartTime, booking.EndTime)
+	if err != nil {
+		return err
+	}
+
+	// the facility's rules may have changed since the booking was requested
+	err = facility.Rules.CheckSlot(startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = m.checkOverlap(ctx, tx, booking.Facility, startTime, endTime)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// Copy the booking from requestedbookings to approvedbookings
+	copyStmt := `INSERT INTO approvedbookings (username, name, start_date, end_date, unit_number, start_time, end_time, purpose, facility)
+		SELECT username, name, start_date, end_date, unit_number, start_time, end_time, purpose, facility FROM requestedbookings WHERE id = $1`
+	result, err := tx.ExecContext(ctx, copyStmt, booking.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return m.overlapError(ctx, err, booking.Facility, startTime, endTime)
+	}
+
+	err = requireAffected(result, repository.ErrBookingRequestNotFound)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// Delete the booking from requestedbookings
+	_, err = tx.ExecContext(ctx, `DELETE FROM requestedbookings WHERE id = $1`, booking.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *SQLiteDBRepo) ApproveRecurringBookingRequest(booking models.RequestedBooking, failOnConflict bool) (*models.ApprovalReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	facility, err := m.facilityByName(ctx, m.DB, booking.Facility)
+	if err != nil {
+		return nil, err
+	}
+
+	series, occurrences, err := newSeries(booking, facility)
+	if err != nil {
+		return nil, err
+	}
+
+	// every occurrence has to respect the facility's current rules
+	for _, occurrence := range occurrences {
+		err = facility.Rules.CheckSlot(occurrence.StartTime, occurrence.EndTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.insertSeries(ctx, tx, series)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	report := &models.ApprovalReport{SeriesID: series.ID}
+	for _, occurrence := range occurrences {
+		result := models.OccurrenceResult{
+			StartTime: occurrence.StartTime,
+			EndTime:   occurrence.EndTime,
+		}
+
+		// occurrences overlapping an existing booking are skipped unless the approval has to fail
+		conflict, err := m.findOverlap(ctx, tx, booking.Facility, occurrence.StartTime, occurrence.EndTime)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		if conflict != nil {
+			if failOnConflict {
+				_ = tx.Rollback()
+				return nil, &repository.ConflictError{Conflict: *conflict}
+			}
+
+			result.Status = models.OccurrenceSkipped
+			result.Conflict = conflict
+			report.Add(result)
+			continue
+		}
+
+		insertStmt := `INSERT INTO recurringbookings (username, name, start_date, end_date, unit_number, start_time, end_time, purpose, facility, series_id, original_start)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $6) RETURNING id`
+		err = tx.QueryRowContext(ctx, insertStmt, booking.Username, booking.Name, occurrence.StartDate, occurrence.EndDate,
+			booking.UnitNumber, occurrence.StartTime.UTC(), occurrence.EndTime.UTC(), booking.Purpose, booking.Facility, series.ID).Scan(&result.BookingID)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, m.overlapError(ctx, err, booking.Facility, occurrence.StartTime, occurrence.EndTime)
+		}
+
+		result.Status = models.OccurrenceCreated
+		report.Add(result)
+	}
+
+	// Delete the booking from requestedbookings
+	result, err := tx.ExecContext(ctx, `DELETE FROM requestedbookings WHERE id = $1`, booking.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	err = requireAffected(result, repository.ErrBookingRequestNotFound)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// GetBookingRequest returns a pending booking request
+func (m *SQLiteDBRepo) GetBookingRequest(id int) (*models.RequestedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return bookingRequestByID(ctx, m.DB, id)
+}
+
+// GetApprovedBooking returns a one-off approved booking
+func (m *SQLiteDBRepo) GetApprovedBooking(id int) (*models.SubmittedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return submittedBookingByID(ctx, m.DB, "approvedbookings", id)
+}
+
+// GetRecurringBooking returns a single occurrence of a recurring booking
+func (m *SQLiteDBRepo) GetRecurringBooking(id int) (*models.SubmittedBooking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return submittedBookingByID(ctx, m.DB, "recurringbookings", id)
+}
+
+func (m *SQLiteDBRepo) deleteByID(table string, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM `+table+` WHERE id = $1`, id)
+	return err
+}
+
+func (m *SQLiteDBRepo) DeleteBookingRequest(booking models.RequestedBooking) error {
+	return m.deleteByID("requestedbookings", booking.ID)
+}
+
+func (m *SQLiteDBRepo) DeleteApprovedBooking(booking models.SubmittedBooking) error {
+	return m.deleteByID("approvedbookings", booking.ID)
+}
+
+func (m *SQLiteDBRepo) DeleteRecurringBooking(booking models.SubmittedBooking) error {
+	return m.deleteByID("recurringbookings", booking.ID)
+}
+
+func (m *SQLiteDBRepo) loadOpeningHours(ctx context.Context, q queryer, facilities ...*models.Facility) error {
+	query := `
+		SELECT
+			weekday, opens_minute, closes_minute
+		FROM
+			facility_opening_hours
+		WHERE
+			facility_id = $1
+		ORDER BY
+			weekday, opens_minute
+	`
+
+	for _, facility := range facilities {
+		rows, err := q.QueryContext(ctx, query, facility.ID)
+		if err != nil {
+			return err
+		}
+
+		facility.Rules.OpeningHours = []models.OpeningHours{}
+		for rows.Next() {
+			var weekday, opens, closes int
+			err := rows.Scan(&weekday, &opens, &closes)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			facility.Rules.OpeningHours = append(facility.Rules.OpeningHours, models.OpeningHours{
+				Weekday: time.Weekday(weekday),
+				Opens:   models.FormatClock(opens),
+				Closes:  models.FormatClock(closes),
+			})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *SQLiteDBRepo) AllFacilities(includeArchived bool) ([]*models.Facility, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + facilityColumns + `
+		FROM
+			facilities
+		WHERE
+			is_active OR $1
+		ORDER BY
+			name ASC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	var facilities []*models.Facility
+	for rows.Next() {
+		facility, err := scanFacility(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		facilities = append(facilities, facility)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.loadOpeningHours(ctx, m.DB, facilities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return facilities, nil
+}
+
+func (m *SQLiteDBRepo) GetFacilityByID(id int) (*models.Facility, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + facilityColumns + ` FROM facilities WHERE id = $1`
+
+	facility, err := scanFacility(m.DB.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrFacilityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadOpeningHours(ctx, m.DB, facility)
+	if err != nil {
+		return nil, err
+	}
+
+	return facility, nil
+}
+
+func (m *SQLiteDBRepo) GetFacilityByName(name string) (*models.Facility, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return m.facilityByName(ctx, m.DB, name)
+}
+
+func (m *SQLiteDBRepo) facilityByName(ctx context.Context, q queryer, name string) (*models.Facility, error) {
+	query := `SELECT ` + facilityColumns + ` FROM facilities WHERE name = $1`
+
+	facility, err := scanFacility(q.QueryRowContext(ctx, query, name))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrFacilityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadOpeningHours(ctx, q, facility)
+	if err != nil {
+		return nil, err
+	}
+
+	return facility, nil
+}
+
+func (m *SQLiteDBRepo) saveOpeningHours(ctx context.Context, q queryer, facilityID int, hours []models.OpeningHours) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM facility_opening_hours WHERE facility_id = $1`, facilityID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into facility_opening_hours (facility_id, weekday, opens_minute, closes_minute)
+		values ($1, $2, $3, $4)`
+
+	for _, h := range hours {
+		opens, err := models.ParseClock(h.Opens)
+		if err != nil {
+			return err
+		}
+		closes, err := models.ParseClock(h.Closes)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, stmt, facilityID, int(h.Weekday), opens, closes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *SQLiteDBRepo) InsertFacility(facility models.Facility) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into facilities (name, description, capacity, location, is_active, image_url, booking_rules,
+		time_zone, min_slot_minutes, max_slot_minutes, slot_granularity_minutes, lead_time_minutes, max_advance_days,
+		created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $14) returning id`
+
+	var newID int
+	err = tx.QueryRowContext(ctx, stmt,
+		facility.Name,
+		facility.Description,
+		facility.Capacity,
+		facility.Location,
+		facility.Active,
+		facility.ImageURL,
+		facility.BookingRules,
+		facility.Rules.TimeZone,
+		facility.Rules.MinSlotMinutes,
+		facility.Rules.MaxSlotMinutes,
+		facility.Rules.SlotGranularityMinutes,
+		facility.Rules.LeadTimeMinutes,
+		facility.Rules.MaxAdvanceDays,
+		time.Now().UTC(),
+	).Scan(&newID)
+
+	if err != nil {
+		_ = tx.Rollback()
+		if isSQLiteUniqueViolation(err) {
+			return 0, repository.ErrDuplicateFacility
+		}
+		return 0, err
+	}
+
+	err = m.saveOpeningHours(ctx, tx, newID, facility.Rules.OpeningHours)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateFacility overwrites every editable field of the facility, including its rules.
+// Renaming a facility cascades to the bookings that reference it.
+func (m *SQLiteDBRepo) UpdateFacility(facility models.Facility) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		UPDATE facilities SET
+			name = $1, description = $2, capacity = $3, location = $4, is_active = $5,
+			image_url = $6, booking_rules = $7, time_zone = $8, min_slot_minutes = $9,
+			max_slot_minutes = $10, slot_granularity_minutes = $11, lead_time_minutes = $12,
+			max_advance_days = $13, updated_at = $14
+		WHERE id = $15
+	`
+
+	result, err := tx.ExecContext(ctx, stmt,
+		facility.Name,
+		facility.Description,
+		facility.Capacity,
+		facility.Location,
+		facility.Active,
+		facility.ImageURL,
+		facility.BookingRules,
+		facility.Rules.TimeZone,
+		facility.Rules.MinSlotMinutes,
+		facility.Rules.MaxSlotMinutes,
+		facility.Rules.SlotGranularityMinutes,
+		facility.Rules.LeadTimeMinutes,
+		facility.Rules.MaxAdvanceDays,
+		time.Now().UTC(),
+		facility.ID,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		if isSQLiteUniqueViolation(err) {
+			return repository.ErrDuplicateFacility
+		}
+		return err
+	}
+
+	err = requireAffected(result, repository.ErrFacilityNotFound)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = m.saveOpeningHours(ctx, tx, facility.ID, facility.Rules.OpeningHours)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ArchiveFacility hides the facility from residents and stops new bookings for it.
+// Existing bookings are left untouched.
+func (m *SQLiteDBRepo) ArchiveFacility(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `UPDATE facilities SET is_active = FALSE, updated_at = $1 WHERE id = $2`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrFacilityNotFound)
+}
@@ -0,0 +1,40 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/migrations"
+	"booking-backend/internal/repository"
+	"booking-backend/internal/repository/repotest"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// openSQLite migrates a new database file with the pragmas the API opens SQLite with
+func openSQLite(t *testing.T) *sql.DB {
+	source := "file:" + filepath.Join(t.TempDir(), "booking.db") +
+		"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+	db, err := sql.Open("sqlite", source)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrations.New(db, migrations.SQLite)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return db
+}
+
+func TestSQLiteDBRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		return &SQLiteDBRepo{DB: openSQLite(t)}
+	})
+}
@@ -0,0 +1,52 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"context"
+	"time"
+)
+
+// GetUserByIdentity returns the user linked to a subject of an identity provider,
+// ErrUserNotFound if there is none
+func (m *SQLiteDBRepo) GetUserByIdentity(issuer string, subject string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return getUserByIdentity(ctx, m.DB, issuer, subject)
+}
+
+// InsertUserIdentity links an identity provider account to an existing user. It
+// returns ErrDuplicateIdentity if the account is already linked.
+func (m *SQLiteDBRepo) InsertUserIdentity(identity models.UserIdentity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertUserIdentity(ctx, m.DB, identity, time.Now().UTC(), isSQLiteUniqueViolation)
+}
+
+// ProvisionIdentityUser creates a resident named identity.Username for the first
+// single sign-on of an identity. Provisioned users have no password.
+func (m *SQLiteDBRepo) ProvisionIdentityUser(identity models.UserIdentity, unitNumber string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return provisionIdentityUser(ctx, m.DB, identity, unitNumber, time.Now().UTC(), isSQLiteUniqueViolation)
+}
+
+// InsertOIDCLogin stores the state, nonce and PKCE verifier of a single sign-on
+// until the identity provider redirects back
+func (m *SQLiteDBRepo) InsertOIDCLogin(login models.OIDCLogin) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertOIDCLogin(ctx, m.DB, login, time.Now().UTC())
+}
+
+// TakeOIDCLogin uses up the single sign-on with the state, ErrInvalidOIDCState if it
+// is unknown, expired or already completed
+func (m *SQLiteDBRepo) TakeOIDCLogin(state string) (*models.OIDCLogin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return takeOIDCLogin(ctx, m.DB, state, time.Now().UTC())
+}
@@ -0,0 +1,58 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"context"
+	"time"
+)
+
+// RecordLoginAttempt adds a sign in attempt to the audit trail
+func (m *SQLiteDBRepo) RecordLoginAttempt(attempt models.LoginAttempt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return recordLoginAttempt(ctx, m.DB, attempt, time.Now().UTC())
+}
+
+// GetLoginThrottle returns the recent failures counted for key, none if it has no throttle
+func (m *SQLiteDBRepo) GetLoginThrottle(key string) (*models.LoginThrottle, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return getLoginThrottle(ctx, m.DB, key)
+}
+
+// RecordLoginFailure counts a failed sign in for key. Failures older than window are
+// forgotten, the count starts over.
+func (m *SQLiteDBRepo) RecordLoginFailure(key string, window time.Duration) (*models.LoginThrottle, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	return recordLoginFailure(ctx, m.DB, key, now, now.Add(-window))
+}
+
+// ReturnLoginFailure takes back one failure counted for key, for an attempt that was
+// counted before it was checked and turned out not to be a failure
+func (m *SQLiteDBRepo) ReturnLoginFailure(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return returnLoginFailure(ctx, m.DB, key)
+}
+
+// LockLogin rejects sign ins for key until the given time
+func (m *SQLiteDBRepo) LockLogin(key string, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return lockLogin(ctx, m.DB, key, until.UTC())
+}
+
+// ClearLoginThrottle forgets the failures of key and lifts its lock
+func (m *SQLiteDBRepo) ClearLoginThrottle(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return clearLoginThrottle(ctx, m.DB, key)
+}
@@ -0,0 +1,58 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"context"
+	"time"
+)
+
+// GetUserMFA returns the TOTP enrolment of a user, ErrMFANotEnrolled if there is none
+func (m *SQLiteDBRepo) GetUserMFA(username string) (*models.UserMFA, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return getUserMFA(ctx, m.DB, username)
+}
+
+// BeginMFAEnrolment stores the secret of a new TOTP enrolment, replacing an unconfirmed
+// one. It returns ErrMFAAlreadyEnabled if the user already enabled TOTP.
+func (m *SQLiteDBRepo) BeginMFAEnrolment(username string, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return beginMFAEnrolment(ctx, m.DB, username, secret, time.Now().UTC())
+}
+
+// EnableMFA confirms the enrolment with the time step of the user's first code and
+// replaces their recovery codes
+func (m *SQLiteDBRepo) EnableMFA(username string, step int64, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return enableMFA(ctx, m.DB, username, step, recoveryCodes, time.Now().UTC())
+}
+
+// UseTOTPStep records the time step of an accepted code. It returns ErrTOTPCodeReused
+// for a step that is not newer than the last accepted one, so a code cannot be replayed.
+func (m *SQLiteDBRepo) UseTOTPStep(username string, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return useTOTPStep(ctx, m.DB, username, step)
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes
+func (m *SQLiteDBRepo) UseRecoveryCode(username string, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return useRecoveryCode(ctx, m.DB, username, code, time.Now().UTC())
+}
+
+// DisableMFA removes the user's TOTP enrolment and recovery codes
+func (m *SQLiteDBRepo) DisableMFA(username string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return disableMFA(ctx, m.DB, username)
+}
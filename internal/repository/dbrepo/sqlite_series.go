@@ -0,0 +1,211 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (m *SQLiteDBRepo) insertSeries(ctx context.Context, q queryer, series *models.BookingSeries) error {
+	stmt := `INSERT INTO booking_series (username, name, unit_number, purpose, facility, start_time, end_time,
+		rrule, exdates, time_zone, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+
+	return q.QueryRowContext(ctx, stmt, series.Username, series.Name, series.UnitNumber, series.Purpose,
+		series.Facility, series.StartTime.UTC(), series.EndTime.UTC(), series.RRule, formatExDates(series.ExDates),
+		series.TimeZone, series.CreatedAt.UTC()).Scan(&series.ID)
+}
+
+func (m *SQLiteDBRepo) GetBookingSeries(id int) (*models.BookingSeries, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT ` + seriesColumns + ` FROM booking_series WHERE id = $1`
+	series, err := scanSeries(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	occurrencesQuery := `
+		SELECT
+			id, username, name, start_date, end_date, unit_number,
+			start_time, end_time, purpose, facility, series_id
+		FROM
+			recurringbookings
+		WHERE
+			series_id = $1
+		ORDER BY
+			start_time ASC
+	`
+	rows, err := m.DB.QueryContext(ctx, occurrencesQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series.Occurrences, err = scanRecurringBookings(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+// seriesForChange loads a series with its occurrences and facility to plan a change against
+func (m *SQLiteDBRepo) seriesForChange(ctx context.Context, tx *sql.Tx, id int) (*models.BookingSeries, []storedOccurrence, *models.Facility, error) {
+	query := `SELECT ` + seriesColumns + ` FROM booking_series WHERE id = $1`
+	series, err := scanSeries(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	occurrencesQuery := `
+		SELECT id, start_time, end_time, original_start, purpose
+		FROM recurringbookings
+		WHERE series_id = $1
+		ORDER BY original_start ASC
+	`
+	rows, err := tx.QueryContext(ctx, occurrencesQuery, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	occurrences, err := scanStoredOccurrences(rows)
+	rows.Close()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	facility, err := m.facilityByName(ctx, tx, series.Facility)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return series, occurrences, facility, nil
+}
+
+// applySeriesPlan writes a planned change of the series with the given id. It rolls
+// back tx if any statement fails.
+func (m *SQLiteDBRepo) applySeriesPlan(ctx context.Context, tx *sql.Tx, id int, facility string, plan *seriesPlan) error {
+	if plan.Series == nil {
+		// the series owns its occurrences, they are deleted with it
+		_, err := tx.ExecContext(ctx, `DELETE FROM booking_series WHERE id = $1`, id)
+		if err != nil {
+			_ = tx.Rollback()
+		}
+		return err
+	}
+
+	updateStmt := `UPDATE booking_series SET purpose = $1, start_time = $2, end_time = $3, rrule = $4, exdates = $5
+		WHERE id = $6`
+	_, err := tx.ExecContext(ctx, updateStmt, plan.Series.Purpose, plan.Series.StartTime.UTC(), plan.Series.EndTime.UTC(),
+		plan.Series.RRule, formatExDates(plan.Series.ExDates), id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	owner := id
+	if plan.Split != nil {
+		err = m.insertSeries(ctx, tx, plan.Split)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		owner = plan.Split.ID
+	}
+
+	for _, occurrenceID := range plan.Deleted {
+		_, err = tx.ExecContext(ctx, `DELETE FROM recurringbookings WHERE id = $1`, occurrenceID)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	// overlaps with other bookings are caught by the no_overlap triggers
+	moveStmt := `UPDATE recurringbookings SET start_date = $1, end_date = $2, start_time = $3, end_time = $4,
+		purpose = $5, series_id = $6 WHERE id = $7`
+	for _, slot := range plan.Moved {
+		_, err = tx.ExecContext(ctx, moveStmt, slot.StartDate, slot.EndDate, slot.StartTime.UTC(), slot.EndTime.UTC(),
+			slot.Purpose, owner, slot.ID)
+		if err != nil {
+			_ = tx.Rollback()
+			return m.overlapError(ctx, err, facility, slot.StartTime, slot.EndTime)
+		}
+	}
+
+	return nil
+}
+
+func (m *SQLiteDBRepo) UpdateSeriesOccurrence(change models.OccurrenceChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	series, occurrences, facility, err := m.seriesForChange(ctx, tx, change.SeriesID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	plan, err := planSeriesUpdate(series, occurrences, change, facility, time.Now())
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = m.applySeriesPlan(ctx, tx, series.ID, series.Facility, plan)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *SQLiteDBRepo) CancelSeriesOccurrence(change models.OccurrenceChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	series, occurrences, _, err := m.seriesForChange(ctx, tx, change.SeriesID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	plan, err := planSeriesCancel(series, occurrences, change)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = m.applySeriesPlan(ctx, tx, series.ID, series.Facility, plan)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *SQLiteDBRepo) DeleteBookingSeries(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// the series owns its occurrences, they are deleted with it
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM booking_series WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrBookingSeriesNotFound)
+}
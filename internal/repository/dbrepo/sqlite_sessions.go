@@ -0,0 +1,42 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"context"
+	"time"
+)
+
+// UserSessions returns the active sessions of a user, the most recently used first
+func (m *SQLiteDBRepo) UserSessions(username string) ([]*models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return userSessions(ctx, m.DB, username, time.Now().UTC())
+}
+
+// RevokeSession ends a session of a user. It returns ErrSessionNotFound if the user
+// has no active session with the id.
+func (m *SQLiteDBRepo) RevokeSession(username string, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return revokeSession(ctx, m.DB, username, sessionID, time.Now().UTC())
+}
+
+// RevokeUserSessions ends every session of a user except keepSessionID, which may be
+// empty to end them all
+func (m *SQLiteDBRepo) RevokeUserSessions(username string, keepSessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return revokeUserSessions(ctx, m.DB, username, keepSessionID, time.Now().UTC())
+}
+
+// SessionActive reports whether the user has an active session with the id, so access
+// tokens of a session that was signed out can be rejected
+func (m *SQLiteDBRepo) SessionActive(username string, sessionID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return sessionActive(ctx, m.DB, username, sessionID, time.Now().UTC())
+}
@@ -0,0 +1,309 @@
+package dbrepo
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/repository"
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (m *SQLiteDBRepo) GetUserByName(username string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, username, password, role, unit_number from users where username = $1`
+	var user models.User
+	row := m.DB.QueryRowContext(ctx, query, username)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.Role,
+		&user.UnitNumber,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// RegisterUser creates a resident with the unit number of the invite code, which is
+// used up by the registration
+func (m *SQLiteDBRepo) RegisterUser(username string, passwordHash string, inviteCode string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var inviteID int
+	var unitNumber string
+	query := `
+		SELECT id, unit_number FROM invite_codes
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > $2
+	`
+	err = tx.QueryRowContext(ctx, query, hashSecret(inviteCode), now).Scan(&inviteID, &unitNumber)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
+		return nil, repository.ErrInvalidInviteCode
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	stmt := `insert into users (username, password, role, unit_number) values ($1, $2, $3, $4) returning id`
+
+	var newID int
+	err = tx.QueryRowContext(ctx, stmt, username, passwordHash, models.RoleResident, unitNumber).Scan(&newID)
+	if err != nil {
+		_ = tx.Rollback()
+		if isSQLiteUniqueViolation(err) {
+			return nil, repository.ErrDuplicateUsername
+		}
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE invite_codes SET used_by = $1, used_at = $2 WHERE id = $3`, username, now, inviteID)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User = models.User{
+		ID:         newID,
+		Username:   username,
+		Password:   passwordHash,
+		Role:       models.RoleResident,
+		UnitNumber: unitNumber,
+	}
+
+	return &user, nil
+}
+
+// UpdateUserRole promotes or demotes a user
+func (m *SQLiteDBRepo) UpdateUserRole(username string, role models.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE users SET role = $1 WHERE username = $2`, role, username)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrUserNotFound)
+}
+
+// InsertInviteCode stores the hash of a new invite code and returns its id
+func (m *SQLiteDBRepo) InsertInviteCode(invite models.InviteCode) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO invite_codes (code_hash, unit_number, created_by, created_at, expires_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+		RETURNING id
+	`
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt,
+		hashSecret(invite.Code), invite.UnitNumber, invite.CreatedBy, time.Now().UTC(), invite.ExpiresAt.UTC(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// InsertRefreshToken stores the first refresh token of a new family
+func (m *SQLiteDBRepo) InsertRefreshToken(token models.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	token.CreatedAt = time.Now()
+	token.StartedAt = token.CreatedAt
+	return insertRefreshToken(ctx, m.DB, token)
+}
+
+// RotateRefreshToken uses up a refresh token and stores next in its family for the same
+// user. Replaying a token that was already used revokes the whole family and returns
+// ErrRefreshTokenReused.
+func (m *SQLiteDBRepo) RotateRefreshToken(token string, next models.RefreshToken) (*models.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var current models.RefreshToken
+	query := `
+		SELECT id, family_id, username, expires_at, used_at, revoked_at, mfa, started_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	err = tx.QueryRowContext(ctx, query, hashSecret(token)).Scan(
+		&current.ID,
+		&current.FamilyID,
+		&current.Username,
+		&current.ExpiresAt,
+		&current.UsedAt,
+		&current.RevokedAt,
+		&current.MFA,
+		&current.StartedAt,
+	)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
+		return nil, repository.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if current.RevokedAt != nil || !current.ExpiresAt.After(now) {
+		_ = tx.Rollback()
+		return nil, repository.ErrInvalidRefreshToken
+	}
+
+	if current.UsedAt != nil {
+		// a copy of a rotated token is in use, end the session for whoever holds it
+		_, err = tx.ExecContext(ctx,
+			`UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`,
+			now, current.FamilyID,
+		)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+		return nil, repository.ErrRefreshTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = $1 WHERE id = $2`, now, current.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	next.FamilyID = current.FamilyID
+	next.Username = current.Username
+	next.MFA = current.MFA
+	next.StartedAt = current.StartedAt
+	next.CreatedAt = now
+	err = insertRefreshToken(ctx, tx, next)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &next, nil
+}
+
+// RevokeRefreshToken revokes the family of a refresh token, ending its session.
+// Unknown and already revoked tokens are ignored.
+func (m *SQLiteDBRepo) RevokeRefreshToken(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+		UPDATE refresh_tokens SET revoked_at = $1
+		WHERE revoked_at IS NULL
+		AND family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $2)
+	`
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now().UTC(), hashSecret(token))
+	return err
+}
+
+// UpdatePassword sets a new password and revokes the user's refresh tokens, signing
+// them out everywhere
+func (m *SQLiteDBRepo) UpdatePassword(username string, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return updatePassword(ctx, m.DB, username, passwordHash, time.Now().UTC())
+}
+
+// RehashPassword replaces the stored hash of an unchanged password, e.g. after the
+// bcrypt cost was raised. Unlike UpdatePassword it keeps the user's sessions.
+func (m *SQLiteDBRepo) RehashPassword(username string, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE users SET password = $1 WHERE username = $2`, passwordHash, username)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result, repository.ErrUserNotFound)
+}
+
+// InsertPasswordReset stores the hash of a new reset token. Earlier unused tokens of
+// the user are used up so only the latest one works.
+func (m *SQLiteDBRepo) InsertPasswordReset(reset models.PasswordReset) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertPasswordReset(ctx, m.DB, reset, time.Now().UTC())
+}
+
+// ResetPassword uses up a reset token, sets the password of its user and revokes the
+// user's refresh tokens
+func (m *SQLiteDBRepo) ResetPassword(token string, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var resetID int
+	var username string
+	query := `
+		SELECT id, username FROM password_resets
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+	`
+	err = tx.QueryRowContext(ctx, query, hashSecret(token), now).Scan(&resetID, &username)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
+		return repository.ErrInvalidResetToken
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = resetPassword(ctx, tx, resetID, username, passwordHash, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
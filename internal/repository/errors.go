@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"booking-backend/internal/models"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrFacilityNotFound  = errors.New("facility not found")
+	ErrFacilityArchived  = errors.New("facility is archived and cannot be booked")
+	ErrDuplicateFacility = errors.New("a facility with this name already exists")
+
+	ErrUserNotFound      = errors.New("user not found")
+	ErrDuplicateUsername = errors.New("username already exists")
+	ErrInvalidInviteCode = errors.New("invite code is invalid, expired or already used")
+	ErrDuplicateIdentity = errors.New("this identity provider account is already linked to a user")
+
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid, expired or revoked")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, its session has been revoked")
+	ErrSessionNotFound     = errors.New("session not found or already ended")
+	ErrInvalidResetToken   = errors.New("password reset token is invalid, expired or already used")
+	ErrInvalidOIDCState    = errors.New("single sign-on is invalid, expired or already completed")
+	ErrInvalidAPIKey       = errors.New("API key is invalid, expired or revoked")
+	ErrAPIKeyNotFound      = errors.New("API key not found or already revoked")
+
+	ErrMFANotEnrolled      = errors.New("two-factor authentication is not set up")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTOTPCodeReused      = errors.New("this code was already used, wait for the next one")
+	ErrInvalidRecoveryCode = errors.New("recovery code is invalid or already used")
+
+	ErrBookingRequestNotFound = errors.New("booking request not found")
+	ErrBookingNotFound        = errors.New("booking not found")
+	ErrBookingSeriesNotFound  = errors.New("booking series not found")
+	ErrOccurrenceNotFound     = errors.New("occurrence not found in this booking series")
+)
+
+// InvalidInputError is returned when data passed to the repository cannot be stored as
+// it is, e.g. a malformed time or recurrence rule. Its message is meant for the user.
+type InvalidInputError struct {
+	Err error
+}
+
+// InvalidInput marks err as caused by the caller's input
+func InvalidInput(err error) error {
+	return &InvalidInputError{Err: err}
+}
+
+func (e *InvalidInputError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidInputError) Unwrap() error {
+	return e.Err
+}
+
+// ConflictError is returned when a booking overlaps an existing booking of the same facility.
+type ConflictError struct {
+	Conflict models.BookingConflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf(
+		"booking time overlaps with %s booking %d for %s (%s - %s)",
+		e.Conflict.Kind,
+		e.Conflict.BookingID,
+		e.Conflict.Facility,
+		e.Conflict.StartTime.Format("2006-01-02 15:04"),
+		e.Conflict.EndTime.Format("15:04"),
+	)
+}
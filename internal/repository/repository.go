@@ -3,6 +3,7 @@ package repository
 import (
 	"booking-backend/internal/models"
 	"database/sql"
+	"time"
 )
 
 type DatabaseRepo interface {
@@ -11,13 +12,60 @@ type DatabaseRepo interface {
 	UserBookings(username string) ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error)
 	AdminBookings() ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error)
 	TwoWeekBookings() ([]*models.SubmittedBooking, error)
-	ManageBookings(username string) ([]*models.SubmittedBooking, []*models.SubmittedBooking, []*models.RequestedBooking, error)
 	InsertBookingRequest(booking models.Booking) error
 	ApproveBookingRequest(booking models.RequestedBooking) error
-	ApproveRecurringBookingRequest(booking models.RequestedBooking) error
+	ApproveRecurringBookingRequest(booking models.RequestedBooking, failOnConflict bool) (*models.ApprovalReport, error)
+	GetBookingRequest(id int) (*models.RequestedBooking, error)
+	GetApprovedBooking(id int) (*models.SubmittedBooking, error)
+	GetRecurringBooking(id int) (*models.SubmittedBooking, error)
 	DeleteBookingRequest(booking models.RequestedBooking) error
 	DeleteApprovedBooking(booking models.SubmittedBooking) error
 	DeleteRecurringBooking(booking models.SubmittedBooking) error
+	GetBookingSeries(id int) (*models.BookingSeries, error)
+	UpdateSeriesOccurrence(change models.OccurrenceChange) error
+	CancelSeriesOccurrence(change models.OccurrenceChange) error
+	DeleteBookingSeries(id int) error
 	GetUserByName(username string) (*models.User, error)
-	RegisterUser(username string, password string, admin bool) (*models.User, error)
+	RegisterUser(username string, passwordHash string, inviteCode string) (*models.User, error)
+	UpdateUserRole(username string, role models.Role) error
+	GetUserByIdentity(issuer string, subject string) (*models.User, error)
+	InsertUserIdentity(identity models.UserIdentity) error
+	ProvisionIdentityUser(identity models.UserIdentity, unitNumber string) (*models.User, error)
+	InsertOIDCLogin(login models.OIDCLogin) error
+	TakeOIDCLogin(state string) (*models.OIDCLogin, error)
+	InsertInviteCode(invite models.InviteCode) (int, error)
+	InsertRefreshToken(token models.RefreshToken) error
+	RotateRefreshToken(token string, next models.RefreshToken) (*models.RefreshToken, error)
+	RevokeRefreshToken(token string) error
+	UserSessions(username string) ([]*models.Session, error)
+	RevokeSession(username string, sessionID string) error
+	RevokeUserSessions(username string, keepSessionID string) error
+	SessionActive(username string, sessionID string) (bool, error)
+	InsertAPIKey(key models.APIKey) (int, error)
+	GetAPIKey(key string) (*models.APIKey, error)
+	AllAPIKeys() ([]*models.APIKey, error)
+	RevokeAPIKey(id int) error
+	TouchAPIKey(id int, ip string) error
+	UpdatePassword(username string, passwordHash string) error
+	RehashPassword(username string, passwordHash string) error
+	InsertPasswordReset(reset models.PasswordReset) error
+	ResetPassword(token string, passwordHash string) error
+	RecordLoginAttempt(attempt models.LoginAttempt) error
+	GetLoginThrottle(key string) (*models.LoginThrottle, error)
+	RecordLoginFailure(key string, window time.Duration) (*models.LoginThrottle, error)
+	ReturnLoginFailure(key string) error
+	LockLogin(key string, until time.Time) error
+	ClearLoginThrottle(key string) error
+	GetUserMFA(username string) (*models.UserMFA, error)
+	BeginMFAEnrolment(username string, secret string) error
+	EnableMFA(username string, step int64, recoveryCodes []string) error
+	UseTOTPStep(username string, step int64) error
+	UseRecoveryCode(username string, code string) error
+	DisableMFA(username string) error
+	AllFacilities(includeArchived bool) ([]*models.Facility, error)
+	GetFacilityByID(id int) (*models.Facility, error)
+	GetFacilityByName(name string) (*models.Facility, error)
+	InsertFacility(facility models.Facility) (int, error)
+	UpdateFacility(facility models.Facility) error
+	ArchiveFacility(id int) error
 }
@@ -0,0 +1,1353 @@
+// Package repotest is a conformance suite for repository.DatabaseRepo implementations.
+//
+// A backend's test calls Run with a constructor that returns an empty repository:
+//
+//	func TestMemoryDBRepo(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+//			return dbrepo.NewMemoryDBRepo()
+//		})
+//	}
+package repotest
+
+import (
+	"booking-backend/internal/models"
+	"booking-backend/internal/passwords"
+	"booking-backend/internal/repository"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Run exercises repo semantics shared by every backend. newRepo is called once per
+// subtest and must return a repository without any users, facilities or bookings.
+func Run(t *testing.T, newRepo func(t *testing.T) repository.DatabaseRepo) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepo(t)) })
+	t.Run("RefreshTokens", func(t *testing.T) { testRefreshTokens(t, newRepo(t)) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, newRepo(t)) })
+	t.Run("Passwords", func(t *testing.T) { testPasswords(t, newRepo(t)) })
+	t.Run("LoginThrottles", func(t *testing.T) { testLoginThrottles(t, newRepo(t)) })
+	t.Run("MFA", func(t *testing.T) { testMFA(t, newRepo(t)) })
+	t.Run("Identities", func(t *testing.T) { testIdentities(t, newRepo(t)) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeys(t, newRepo(t)) })
+	t.Run("Facilities", func(t *testing.T) { testFacilities(t, newRepo(t)) })
+	t.Run("BookingRequests", func(t *testing.T) { testBookingRequests(t, newRepo(t)) })
+	t.Run("Approval", func(t *testing.T) { testApproval(t, newRepo(t)) })
+	t.Run("RecurringApproval", func(t *testing.T) { testRecurringApproval(t, newRepo(t)) })
+	t.Run("BookingSeries", func(t *testing.T) { testBookingSeries(t, newRepo(t)) })
+	t.Run("SeriesChanges", func(t *testing.T) { testSeriesChanges(t, newRepo(t)) })
+	t.Run("Deletion", func(t *testing.T) { testDeletion(t, newRepo(t)) })
+	t.Run("ManageBookings", func(t *testing.T) { testManageBookings(t, newRepo(t)) })
+}
+
+// nextMonday returns 10:00 UTC on the Monday after next, far enough ahead for any lead time
+func nextMonday() time.Time {
+	now := time.Now().UTC()
+	daysAhead := (8-int(now.Weekday()))%7 + 7
+	day := now.AddDate(0, 0, daysAhead)
+	return time.Date(day.Year(), day.Month(), day.Day(), 10, 0, 0, 0, time.UTC)
+}
+
+func booking(username, facility string, start time.Time, length time.Duration) models.Booking {
+	return models.Booking{
+		Username:   username,
+		Name:       "Resident " + username,
+		UnitNumber: "#01-01",
+		StartDate:  start,
+		EndDate:    start.Add(length),
+		StartTime:  start.Format(time.RFC3339),
+		EndTime:    start.Add(length).Format(time.RFC3339),
+		Purpose:    "gathering",
+		Facility:   facility,
+	}
+}
+
+// mustHash hashes a password with the lowest bcrypt cost to keep the suite fast
+func mustHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := passwords.Hash(password, bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return hash
+}
+
+// mustInvite creates an invite code for a unit, as if from the command line
+func mustInvite(t *testing.T, repo repository.DatabaseRepo, code, unitNumber string) {
+	t.Helper()
+	_, err := repo.InsertInviteCode(models.InviteCode{
+		Code:       code,
+		UnitNumber: unitNumber,
+		ExpiresAt:  time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("InsertInviteCode(%q): %v", unitNumber, err)
+	}
+}
+
+// mustRegister registers a resident with a fresh invite and promotes admins
+func mustRegister(t *testing.T, repo repository.DatabaseRepo, username string, admin bool) {
+	t.Helper()
+	mustInvite(t, repo, "invite-"+username, "#01-01")
+	_, err := repo.RegisterUser(username, mustHash(t, "password"), "invite-"+username)
+	if err != nil {
+		t.Fatalf("RegisterUser(%q): %v", username, err)
+	}
+	if admin {
+		err = repo.UpdateUserRole(username, models.RoleAdmin)
+		if err != nil {
+			t.Fatalf("UpdateUserRole(%q): %v", username, err)
+		}
+	}
+}
+
+func mustFacility(t *testing.T, repo repository.DatabaseRepo, facility models.Facility) int {
+	t.Helper()
+	facility.Active = true
+	id, err := repo.InsertFacility(facility)
+	if err != nil {
+		t.Fatalf("InsertFacility(%q): %v", facility.Name, err)
+	}
+	return id
+}
+
+func mustRequest(t *testing.T, repo repository.DatabaseRepo, b models.Booking) *models.RequestedBooking {
+	t.Helper()
+	err := repo.InsertBookingRequest(b)
+	if err != nil {
+		t.Fatalf("InsertBookingRequest: %v", err)
+	}
+
+	_, _, requested, err := repo.UserBookings(b.Username)
+	if err != nil {
+		t.Fatalf("UserBookings: %v", err)
+	}
+	for _, r := range requested {
+		if r.Facility == b.Facility && r.Purpose == b.Purpose && sameInstant(t, r.StartTime, b.StartTime) {
+			return r
+		}
+	}
+
+	t.Fatalf("inserted request not returned by UserBookings")
+	return nil
+}
+
+func sameInstant(t *testing.T, a, b string) bool {
+	t.Helper()
+	ta, err := time.Parse(time.RFC3339, a)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", a, err)
+	}
+	tb, err := time.Parse(time.RFC3339, b)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", b, err)
+	}
+	return ta.Equal(tb)
+}
+
+func testUsers(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+
+	user, err := repo.GetUserByName("alice")
+	if err != nil {
+		t.Fatalf("GetUserByName: %v", err)
+	}
+	if user.Username != "alice" || user.Role != models.RoleResident {
+		t.Errorf("GetUserByName = %+v, want resident alice", user)
+	}
+	if ok, err := user.PasswordMatches("password"); err != nil || !ok {
+		t.Errorf("PasswordMatches(correct) = %v, %v", ok, err)
+	}
+	if ok, _ := user.PasswordMatches("wrong"); ok {
+		t.Errorf("PasswordMatches(wrong) = true")
+	}
+
+	if user.UnitNumber != "#01-01" {
+		t.Errorf("alice has unit %q, want the unit of her invite", user.UnitNumber)
+	}
+
+	if _, err := repo.RegisterUser("bob", mustHash(t, "password"), "invite-alice"); !errors.Is(err, repository.ErrInvalidInviteCode) {
+		t.Errorf("reusing an invite code error = %v, want ErrInvalidInviteCode", err)
+	}
+	if _, err := repo.RegisterUser("bob", mustHash(t, "password"), "unknown"); !errors.Is(err, repository.ErrInvalidInviteCode) {
+		t.Errorf("unknown invite code error = %v, want ErrInvalidInviteCode", err)
+	}
+
+	_, err = repo.InsertInviteCode(models.InviteCode{Code: "expired", UnitNumber: "#02-02", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("InsertInviteCode(expired): %v", err)
+	}
+	if _, err := repo.RegisterUser("bob", mustHash(t, "password"), "expired"); !errors.Is(err, repository.ErrInvalidInviteCode) {
+		t.Errorf("expired invite code error = %v, want ErrInvalidInviteCode", err)
+	}
+
+	mustInvite(t, repo, "second", "#02-02")
+	if _, err := repo.RegisterUser("alice", mustHash(t, "other"), "second"); !errors.Is(err, repository.ErrDuplicateUsername) {
+		t.Errorf("registering a duplicate username error = %v, want ErrDuplicateUsername", err)
+	}
+	// the failed registration must not use up the invite
+	if _, err := repo.RegisterUser("bob", mustHash(t, "password"), "second"); err != nil {
+		t.Errorf("RegisterUser with an invite of a failed registration: %v", err)
+	}
+	if _, err := repo.GetUserByName("nobody"); err == nil {
+		t.Errorf("GetUserByName(unknown) succeeded")
+	}
+
+	if err := repo.UpdateUserRole("bob", models.RoleFacilityManager); err != nil {
+		t.Fatalf("UpdateUserRole: %v", err)
+	}
+	bob, err := repo.GetUserByName("bob")
+	if err != nil {
+		t.Fatalf("GetUserByName(bob): %v", err)
+	}
+	if bob.Role != models.RoleFacilityManager || bob.UnitNumber != "#02-02" {
+		t.Errorf("bob = %+v, want a facility manager of #02-02", bob)
+	}
+	if err := repo.UpdateUserRole("nobody", models.RoleAdmin); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("UpdateUserRole(unknown) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func testRefreshTokens(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+
+	expiresAt := time.Now().Add(time.Hour)
+	err := repo.InsertRefreshToken(models.RefreshToken{Token: "first", FamilyID: "family", Username: "alice", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("InsertRefreshToken: %v", err)
+	}
+
+	rotated, err := repo.RotateRefreshToken("first", models.RefreshToken{Token: "second", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if rotated.Username != "alice" || rotated.FamilyID != "family" || rotated.Token != "second" {
+		t.Errorf("RotateRefreshToken = %+v, want alice's second token in the same family", rotated)
+	}
+
+	if _, err := repo.RotateRefreshToken("unknown", models.RefreshToken{Token: "x", ExpiresAt: expiresAt}); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		t.Errorf("rotating an unknown token error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// replaying the used token revokes the family, including the token it was rotated into
+	if _, err := repo.RotateRefreshToken("first", models.RefreshToken{Token: "stolen", ExpiresAt: expiresAt}); !errors.Is(err, repository.ErrRefreshTokenReused) {
+		t.Errorf("replaying a used token error = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := repo.RotateRefreshToken("second", models.RefreshToken{Token: "third", ExpiresAt: expiresAt}); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		t.Errorf("rotating a token of a revoked family error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	err = repo.InsertRefreshToken(models.RefreshToken{Token: "other", FamilyID: "other", Username: "alice", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("InsertRefreshToken: %v", err)
+	}
+	if err := repo.RevokeRefreshToken("other"); err != nil {
+		t.Fatalf("RevokeRefreshToken: %v", err)
+	}
+	if _, err := repo.RotateRefreshToken("other", models.RefreshToken{Token: "x", ExpiresAt: expiresAt}); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		t.Errorf("rotating a revoked token error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if err := repo.RevokeRefreshToken("unknown"); err != nil {
+		t.Errorf("RevokeRefreshToken(unknown): %v", err)
+	}
+
+	err = repo.InsertRefreshToken(models.RefreshToken{Token: "expired", FamilyID: "expired", Username: "alice", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("InsertRefreshToken: %v", err)
+	}
+	if _, err := repo.RotateRefreshToken("expired", models.RefreshToken{Token: "x", ExpiresAt: expiresAt}); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		t.Errorf("rotating an expired token error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func testSessions(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+	mustRegister(t, repo, "bob", false)
+
+	expiresAt := time.Now().Add(time.Hour)
+	for _, token := range []models.RefreshToken{
+		{Token: "laptop", FamilyID: "laptop", Username: "alice", ExpiresAt: expiresAt, UserAgent: "Firefox", IPAddress: "192.0.2.1"},
+		{Token: "phone", FamilyID: "phone", Username: "alice", ExpiresAt: expiresAt, UserAgent: "Safari", IPAddress: "192.0.2.2", MFA: true},
+		{Token: "tablet", FamilyID: "tablet", Username: "alice", ExpiresAt: expiresAt},
+		{Token: "old", FamilyID: "old", Username: "alice", ExpiresAt: time.Now().Add(-time.Minute)},
+		{Token: "bob", FamilyID: "bob", Username: "bob", ExpiresAt: expiresAt},
+	} {
+		if err := repo.InsertRefreshToken(token); err != nil {
+			t.Fatalf("InsertRefreshToken(%s): %v", token.Token, err)
+		}
+	}
+
+	// a refresh keeps the session and records where it was last used from
+	_, err := repo.RotateRefreshToken("laptop", models.RefreshToken{
+		Token: "laptop-2", ExpiresAt: expiresAt, UserAgent: "Firefox 2", IPAddress: "198.51.100.1",
+	})
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+
+	sessions, err := repo.UserSessions("alice")
+	if err != nil {
+		t.Fatalf("UserSessions: %v", err)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("UserSessions = %d sessions, want 3 without the expired one", len(sessions))
+	}
+	laptop := sessions[0]
+	if laptop.ID != "laptop" || laptop.UserAgent != "Firefox 2" || laptop.IPAddress != "198.51.100.1" {
+		t.Errorf("most recently used session = %+v, want laptop as of its refresh", laptop)
+	}
+	if laptop.LastUsedAt.Before(laptop.CreatedAt) {
+		t.Errorf("session last used at %v, before it was created at %v", laptop.LastUsedAt, laptop.CreatedAt)
+	}
+	for _, session := range sessions {
+		if session.ID == "phone" && !session.MFA {
+			t.Errorf("phone session lost its second factor")
+		}
+	}
+
+	// a refreshed session stays active, expired ones and those of other users are not
+	for _, tt := range []struct {
+		username, sessionID string
+		want                bool
+	}{
+		{"alice", "laptop", true},
+		{"alice", "phone", true},
+		{"alice", "old", false},
+		{"bob", "phone", false},
+		{"alice", "", false},
+	} {
+		active, err := repo.SessionActive(tt.username, tt.sessionID)
+		if err != nil {
+			t.Fatalf("SessionActive: %v", err)
+		}
+		if active != tt.want {
+			t.Errorf("SessionActive(%s, %q) = %v, want %v", tt.username, tt.sessionID, active, tt.want)
+		}
+	}
+
+	// sessions can only be ended by their own user
+	if err := repo.RevokeSession("bob", "phone"); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("revoking another user's session error = %v, want ErrSessionNotFound", err)
+	}
+	if err := repo.RevokeSession("alice", "phone"); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if err := repo.RevokeSession("alice", "phone"); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("revoking an ended session error = %v, want ErrSessionNotFound", err)
+	}
+	if err := repo.RevokeSession("alice", "old"); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("revoking an expired session error = %v, want ErrSessionNotFound", err)
+	}
+	if _, err := repo.RotateRefreshToken("phone", models.RefreshToken{Token: "x", ExpiresAt: expiresAt}); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		t.Errorf("refreshing an ended session error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if active, err := repo.SessionActive("alice", "phone"); err != nil || active {
+		t.Errorf("SessionActive of an ended session = %v, %v, want false", active, err)
+	}
+
+	// signing out everywhere else keeps the current session and other users' sessions
+	if err := repo.RevokeUserSessions("alice", "laptop"); err != nil {
+		t.Fatalf("RevokeUserSessions: %v", err)
+	}
+	sessions, err = repo.UserSessions("alice")
+	if err != nil {
+		t.Fatalf("UserSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != "laptop" {
+		t.Errorf("sessions after signing out elsewhere = %+v, want only laptop", sessions)
+	}
+	if err := repo.RevokeUserSessions("alice", ""); err != nil {
+		t.Fatalf("RevokeUserSessions: %v", err)
+	}
+	if sessions, _ := repo.UserSessions("alice"); len(sessions) != 0 {
+		t.Errorf("alice has %d sessions after signing out everywhere, want 0", len(sessions))
+	}
+	if active, err := repo.SessionActive("alice", "laptop"); err != nil || active {
+		t.Errorf("SessionActive after signing out everywhere = %v, %v, want false", active, err)
+	}
+	if sessions, _ := repo.UserSessions("bob"); len(sessions) != 1 {
+		t.Errorf("bob has %d sessions after alice signed out everywhere, want 1", len(sessions))
+	}
+}
+
+// passwordMatches reports whether the stored password of username is password
+func passwordMatches(t *testing.T, repo repository.DatabaseRepo, username, password string) bool {
+	t.Helper()
+
+	user, err := repo.GetUserByName(username)
+	if err != nil {
+		t.Fatalf("GetUserByName(%s): %v", username, err)
+	}
+	valid, err := user.PasswordMatches(password)
+	if err != nil {
+		t.Fatalf("PasswordMatches: %v", err)
+	}
+	return valid
+}
+
+func testPasswords(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+
+	expiresAt := time.Now().Add(time.Hour)
+	err := repo.InsertRefreshToken(models.RefreshToken{Token: "session", FamilyID: "session", Username: "alice", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("InsertRefreshToken: %v", err)
+	}
+
+	// changing the password signs the user out everywhere
+	if err := repo.UpdatePassword("alice", mustHash(t, "changed")); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	if !passwordMatches(t, repo, "alice", "changed") {
+		t.Errorf("password was not changed")
+	}
+	if _, err := repo.RotateRefreshToken("session", models.RefreshToken{Token: "x", ExpiresAt: expiresAt}); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		t.Errorf("rotating a token issued before the password change error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if err := repo.UpdatePassword("nobody", mustHash(t, "changed")); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("UpdatePassword(unknown) error = %v, want ErrUserNotFound", err)
+	}
+
+	// rehashing keeps the user's sessions
+	err = repo.InsertRefreshToken(models.RefreshToken{Token: "kept", FamilyID: "kept", Username: "alice", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("InsertRefreshToken: %v", err)
+	}
+	if err := repo.RehashPassword("alice", mustHash(t, "changed")); err != nil {
+		t.Fatalf("RehashPassword: %v", err)
+	}
+	if !passwordMatches(t, repo, "alice", "changed") {
+		t.Errorf("password changed on rehash")
+	}
+	if _, err := repo.RotateRefreshToken("kept", models.RefreshToken{Token: "kept-2", ExpiresAt: expiresAt}); err != nil {
+		t.Errorf("rotating a token issued before a rehash: %v", err)
+	}
+	if err := repo.RehashPassword("nobody", mustHash(t, "changed")); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("RehashPassword(unknown) error = %v, want ErrUserNotFound", err)
+	}
+
+	// a newer reset token voids the older one
+	for _, token := range []string{"older", "reset"} {
+		err = repo.InsertPasswordReset(models.PasswordReset{Token: token, Username: "alice", ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatalf("InsertPasswordReset: %v", err)
+		}
+	}
+	if err := repo.ResetPassword("older", mustHash(t, "older")); !errors.Is(err, repository.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword with a superseded token error = %v, want ErrInvalidResetToken", err)
+	}
+
+	err = repo.InsertRefreshToken(models.RefreshToken{Token: "later", FamilyID: "later", Username: "alice", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("InsertRefreshToken: %v", err)
+	}
+	if err := repo.ResetPassword("reset", mustHash(t, "forgotten")); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if !passwordMatches(t, repo, "alice", "forgotten") {
+		t.Errorf("password was not reset")
+	}
+	if _, err := repo.RotateRefreshToken("later", models.RefreshToken{Token: "x", ExpiresAt: expiresAt}); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		t.Errorf("rotating a token issued before the reset error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	if err := repo.ResetPassword("reset", mustHash(t, "again")); !errors.Is(err, repository.ErrInvalidResetToken) {
+		t.Errorf("reusing a reset token error = %v, want ErrInvalidResetToken", err)
+	}
+	if err := repo.ResetPassword("unknown", mustHash(t, "again")); !errors.Is(err, repository.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword(unknown) error = %v, want ErrInvalidResetToken", err)
+	}
+
+	err = repo.InsertPasswordReset(models.PasswordReset{Token: "expired", Username: "alice", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("InsertPasswordReset: %v", err)
+	}
+	if err := repo.ResetPassword("expired", mustHash(t, "again")); !errors.Is(err, repository.ErrInvalidResetToken) {
+		t.Errorf("ResetPassword with an expired token error = %v, want ErrInvalidResetToken", err)
+	}
+}
+
+func testLoginThrottles(t *testing.T, repo repository.DatabaseRepo) {
+	err := repo.RecordLoginAttempt(models.LoginAttempt{Username: "nobody", IPAddress: "192.0.2.1", Outcome: models.LoginFailed})
+	if err != nil {
+		t.Fatalf("RecordLoginAttempt: %v", err)
+	}
+
+	throttle, err := repo.GetLoginThrottle("user:alice")
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if throttle.Key != "user:alice" || throttle.Failures != 0 || throttle.LockedUntil != nil {
+		t.Errorf("GetLoginThrottle without failures = %+v, want an empty throttle", throttle)
+	}
+
+	for i := 1; i <= 3; i++ {
+		throttle, err = repo.RecordLoginFailure("user:alice", time.Hour)
+		if err != nil {
+			t.Fatalf("RecordLoginFailure: %v", err)
+		}
+		if throttle.Failures != i {
+			t.Errorf("failures after %d failed sign ins = %d", i, throttle.Failures)
+		}
+	}
+
+	// a failure taken back no longer counts, and the count never goes below zero
+	if err := repo.ReturnLoginFailure("user:alice"); err != nil {
+		t.Fatalf("ReturnLoginFailure: %v", err)
+	}
+	throttle, err = repo.GetLoginThrottle("user:alice")
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if throttle.Failures != 2 {
+		t.Errorf("failures after taking one back = %d, want 2", throttle.Failures)
+	}
+	if throttle, err = repo.RecordLoginFailure("user:alice", time.Hour); err != nil || throttle.Failures != 3 {
+		t.Fatalf("RecordLoginFailure after taking one back = %+v, %v, want 3 failures", throttle, err)
+	}
+	if err := repo.ReturnLoginFailure("user:nobody"); err != nil {
+		t.Fatalf("ReturnLoginFailure without failures: %v", err)
+	}
+
+	until := time.Now().Add(15 * time.Minute).Truncate(time.Second)
+	if err := repo.LockLogin("user:alice", until); err != nil {
+		t.Fatalf("LockLogin: %v", err)
+	}
+	throttle, err = repo.GetLoginThrottle("user:alice")
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if throttle.Failures != 3 || throttle.LockedUntil == nil || !throttle.LockedUntil.Equal(until) {
+		t.Errorf("locked throttle = %+v, want 3 failures locked until %v", throttle, until)
+	}
+
+	// failures outside the window are forgotten
+	throttle, err = repo.RecordLoginFailure("user:alice", 0)
+	if err != nil {
+		t.Fatalf("RecordLoginFailure: %v", err)
+	}
+	if throttle.Failures != 1 {
+		t.Errorf("failures after the window = %d, want 1", throttle.Failures)
+	}
+
+	if _, err := repo.RecordLoginFailure("ip:192.0.2.1", time.Hour); err != nil {
+		t.Fatalf("RecordLoginFailure: %v", err)
+	}
+	if err := repo.ClearLoginThrottle("user:alice"); err != nil {
+		t.Fatalf("ClearLoginThrottle: %v", err)
+	}
+	throttle, err = repo.GetLoginThrottle("user:alice")
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if throttle.Failures != 0 || throttle.LockedUntil != nil {
+		t.Errorf("cleared throttle = %+v, want no failures", throttle)
+	}
+	throttle, err = repo.GetLoginThrottle("ip:192.0.2.1")
+	if err != nil {
+		t.Fatalf("GetLoginThrottle: %v", err)
+	}
+	if throttle.Failures != 1 {
+		t.Errorf("failures of another key after a clear = %d, want 1", throttle.Failures)
+	}
+}
+
+func testMFA(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", true)
+
+	if _, err := repo.GetUserMFA("alice"); !errors.Is(err, repository.ErrMFANotEnrolled) {
+		t.Errorf("GetUserMFA before enrolment error = %v, want ErrMFANotEnrolled", err)
+	}
+	if err := repo.EnableMFA("alice", 1, nil); !errors.Is(err, repository.ErrMFANotEnrolled) {
+		t.Errorf("EnableMFA before enrolment error = %v, want ErrMFANotEnrolled", err)
+	}
+
+	// a pending enrolment is replaced by a new one
+	for _, secret := range []string{"FIRSTSECRET", "SECONDSECRET"} {
+		if err := repo.BeginMFAEnrolment("alice", secret); err != nil {
+			t.Fatalf("BeginMFAEnrolment: %v", err)
+		}
+	}
+	mfa, err := repo.GetUserMFA("alice")
+	if err != nil {
+		t.Fatalf("GetUserMFA: %v", err)
+	}
+	if mfa.Secret != "SECONDSECRET" || mfa.Enabled() {
+		t.Errorf("pending enrolment = %+v, want the second secret, not enabled", mfa)
+	}
+	if err := repo.UseTOTPStep("alice", 100); !errors.Is(err, repository.ErrTOTPCodeReused) {
+		t.Errorf("UseTOTPStep before enabling error = %v, want ErrTOTPCodeReused", err)
+	}
+
+	if err := repo.EnableMFA("alice", 100, []string{"code-1", "code-2"}); err != nil {
+		t.Fatalf("EnableMFA: %v", err)
+	}
+	mfa, err = repo.GetUserMFA("alice")
+	if err != nil {
+		t.Fatalf("GetUserMFA: %v", err)
+	}
+	if !mfa.Enabled() || mfa.LastStep != 100 {
+		t.Errorf("enabled enrolment = %+v, want enabled at step 100", mfa)
+	}
+	if err := repo.BeginMFAEnrolment("alice", "THIRDSECRET"); !errors.Is(err, repository.ErrMFAAlreadyEnabled) {
+		t.Errorf("BeginMFAEnrolment after enabling error = %v, want ErrMFAAlreadyEnabled", err)
+	}
+
+	// codes of a step cannot be used again, nor codes of earlier steps
+	if err := repo.UseTOTPStep("alice", 100); !errors.Is(err, repository.ErrTOTPCodeReused) {
+		t.Errorf("reusing a step error = %v, want ErrTOTPCodeReused", err)
+	}
+	if err := repo.UseTOTPStep("alice", 101); err != nil {
+		t.Errorf("UseTOTPStep: %v", err)
+	}
+	if err := repo.UseTOTPStep("alice", 99); !errors.Is(err, repository.ErrTOTPCodeReused) {
+		t.Errorf("using an earlier step error = %v, want ErrTOTPCodeReused", err)
+	}
+
+	if err := repo.UseRecoveryCode("alice", "code-1"); err != nil {
+		t.Errorf("UseRecoveryCode: %v", err)
+	}
+	if err := repo.UseRecoveryCode("alice", "code-1"); !errors.Is(err, repository.ErrInvalidRecoveryCode) {
+		t.Errorf("reusing a recovery code error = %v, want ErrInvalidRecoveryCode", err)
+	}
+	if err := repo.UseRecoveryCode("alice", "unknown"); !errors.Is(err, repository.ErrInvalidRecoveryCode) {
+		t.Errorf("UseRecoveryCode(unknown) error = %v, want ErrInvalidRecoveryCode", err)
+	}
+
+	if err := repo.DisableMFA("alice"); err != nil {
+		t.Fatalf("DisableMFA: %v", err)
+	}
+	if _, err := repo.GetUserMFA("alice"); !errors.Is(err, repository.ErrMFANotEnrolled) {
+		t.Errorf("GetUserMFA after disabling error = %v, want ErrMFANotEnrolled", err)
+	}
+	if err := repo.UseRecoveryCode("alice", "code-2"); !errors.Is(err, repository.ErrInvalidRecoveryCode) {
+		t.Errorf("UseRecoveryCode after disabling error = %v, want ErrInvalidRecoveryCode", err)
+	}
+
+	// sessions remember whether they were started with a second factor
+	expiresAt := time.Now().Add(time.Hour)
+	err = repo.InsertRefreshToken(models.RefreshToken{Token: "mfa", FamilyID: "mfa", Username: "alice", ExpiresAt: expiresAt, MFA: true})
+	if err != nil {
+		t.Fatalf("InsertRefreshToken: %v", err)
+	}
+	rotated, err := repo.RotateRefreshToken("mfa", models.RefreshToken{Token: "mfa-2", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if !rotated.MFA {
+		t.Errorf("rotated token of a session with a second factor has MFA unset")
+	}
+}
+
+func testIdentities(t *testing.T, repo repository.DatabaseRepo) {
+	const issuer = "https://idp.example.com"
+	mustRegister(t, repo, "alice", false)
+
+	if _, err := repo.GetUserByIdentity(issuer, "sub-1"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetUserByIdentity(unlinked) error = %v, want ErrUserNotFound", err)
+	}
+
+	// existing users can be linked to an identity
+	err := repo.InsertUserIdentity(models.UserIdentity{Issuer: issuer, Subject: "sub-1", Username: "alice"})
+	if err != nil {
+		t.Fatalf("InsertUserIdentity: %v", err)
+	}
+	user, err := repo.GetUserByIdentity(issuer, "sub-1")
+	if err != nil {
+		t.Fatalf("GetUserByIdentity: %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("GetUserByIdentity user = %q, want alice", user.Username)
+	}
+	err = repo.InsertUserIdentity(models.UserIdentity{Issuer: issuer, Subject: "sub-1", Username: "alice"})
+	if !errors.Is(err, repository.ErrDuplicateIdentity) {
+		t.Errorf("linking an identity twice error = %v, want ErrDuplicateIdentity", err)
+	}
+	err = repo.InsertUserIdentity(models.UserIdentity{Issuer: issuer, Subject: "sub-2", Username: "nobody"})
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("InsertUserIdentity(unknown user) error = %v, want ErrUserNotFound", err)
+	}
+	// subjects are only unique per issuer
+	if _, err := repo.GetUserByIdentity("https://other.example.com", "sub-1"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("GetUserByIdentity(other issuer) error = %v, want ErrUserNotFound", err)
+	}
+
+	// provisioned users are residents without a password
+	bob, err := repo.ProvisionIdentityUser(models.UserIdentity{Issuer: issuer, Subject: "sub-2", Username: "bob"}, "12-34")
+	if err != nil {
+		t.Fatalf("ProvisionIdentityUser: %v", err)
+	}
+	if bob.Role != models.RoleResident || bob.UnitNumber != "12-34" {
+		t.Errorf("provisioned user = %+v, want a resident of unit 12-34", bob)
+	}
+	stored, err := repo.GetUserByName("bob")
+	if err != nil {
+		t.Fatalf("GetUserByName(bob): %v", err)
+	}
+	if valid, err := stored.PasswordMatches(""); err == nil && valid {
+		t.Errorf("provisioned user signs in with an empty password")
+	}
+	user, err = repo.GetUserByIdentity(issuer, "sub-2")
+	if err != nil || user.ID != bob.ID {
+		t.Errorf("GetUserByIdentity(provisioned) = %+v, %v, want user %d", user, err, bob.ID)
+	}
+
+	_, err = repo.ProvisionIdentityUser(models.UserIdentity{Issuer: issuer, Subject: "sub-3", Username: "alice"}, "")
+	if !errors.Is(err, repository.ErrDuplicateUsername) {
+		t.Errorf("provisioning a taken username error = %v, want ErrDuplicateUsername", err)
+	}
+	_, err = repo.ProvisionIdentityUser(models.UserIdentity{Issuer: issuer, Subject: "sub-2", Username: "carol"}, "")
+	if !errors.Is(err, repository.ErrDuplicateIdentity) {
+		t.Errorf("provisioning a linked identity error = %v, want ErrDuplicateIdentity", err)
+	}
+	if _, err := repo.GetUserByName("carol"); err == nil {
+		t.Errorf("failed provisioning left user carol behind")
+	}
+
+	// single sign-ons in progress can be taken once, until they expire
+	err = repo.InsertOIDCLogin(models.OIDCLogin{
+		State:        "state-1",
+		Nonce:        "nonce-1",
+		CodeVerifier: "verifier-1",
+		ReturnTo:     "/bookings",
+		ExpiresAt:    time.Now().Add(10 * time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("InsertOIDCLogin: %v", err)
+	}
+	err = repo.InsertOIDCLogin(models.OIDCLogin{State: "expired", Nonce: "n", CodeVerifier: "v", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("InsertOIDCLogin(expired): %v", err)
+	}
+
+	login, err := repo.TakeOIDCLogin("state-1")
+	if err != nil {
+		t.Fatalf("TakeOIDCLogin: %v", err)
+	}
+	if login.Nonce != "nonce-1" || login.CodeVerifier != "verifier-1" || login.ReturnTo != "/bookings" {
+		t.Errorf("TakeOIDCLogin = %+v, want the stored nonce, verifier and return path", login)
+	}
+	for _, state := range []string{"state-1", "expired", "unknown"} {
+		if _, err := repo.TakeOIDCLogin(state); !errors.Is(err, repository.ErrInvalidOIDCState) {
+			t.Errorf("TakeOIDCLogin(%q) error = %v, want ErrInvalidOIDCState", state, err)
+		}
+	}
+}
+
+func testAPIKeys(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+
+	id, err := repo.InsertAPIKey(models.APIKey{
+		Name:      "Door access",
+		Prefix:    "abcd1234",
+		Key:       "b4u_abcd1234_secret",
+		Username:  "alice",
+		Scopes:    []models.Permission{models.PermViewAllBookings, models.PermManageFacilities},
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("InsertAPIKey: %v", err)
+	}
+	expiredID, err := repo.InsertAPIKey(models.APIKey{
+		Name:      "Old",
+		Prefix:    "efgh5678",
+		Key:       "b4u_efgh5678_secret",
+		Username:  "alice",
+		ExpiresAt: time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("InsertAPIKey(expired): %v", err)
+	}
+	_, err = repo.InsertAPIKey(models.APIKey{Name: "Clash", Prefix: "abcd1234", Key: "b4u_abcd1234_other", Username: "alice", ExpiresAt: time.Now().Add(time.Hour)})
+	if err == nil {
+		t.Errorf("InsertAPIKey with a taken prefix succeeded")
+	}
+
+	// keys are looked up by their full value only
+	key, err := repo.GetAPIKey("b4u_abcd1234_secret")
+	if err != nil {
+		t.Fatalf("GetAPIKey: %v", err)
+	}
+	if key.ID != id || key.Username != "alice" || key.Prefix != "abcd1234" || key.Key != "" {
+		t.Errorf("GetAPIKey = %+v", key)
+	}
+	if !key.HasScope(models.PermManageFacilities) || key.HasScope(models.PermManageUsers) || !key.Active(time.Now()) {
+		t.Errorf("GetAPIKey scopes = %v, active = %v", key.Scopes, key.Active(time.Now()))
+	}
+	for _, value := range []string{"b4u_abcd1234_wrong", "abcd1234", ""} {
+		if _, err := repo.GetAPIKey(value); !errors.Is(err, repository.ErrInvalidAPIKey) {
+			t.Errorf("GetAPIKey(%q) error = %v, want ErrInvalidAPIKey", value, err)
+		}
+	}
+	expired, err := repo.GetAPIKey("b4u_efgh5678_secret")
+	if err != nil {
+		t.Fatalf("GetAPIKey(expired): %v", err)
+	}
+	if expired.ID != expiredID || expired.Active(time.Now()) || len(expired.Scopes) != 0 {
+		t.Errorf("expired key = %+v, want an inactive key without scopes", expired)
+	}
+
+	if err := repo.TouchAPIKey(id, "203.0.113.7"); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+	key, _ = repo.GetAPIKey("b4u_abcd1234_secret")
+	if key.LastUsedAt == nil || key.LastUsedIP != "203.0.113.7" {
+		t.Errorf("touched key last used = %v from %q", key.LastUsedAt, key.LastUsedIP)
+	}
+
+	keys, err := repo.AllAPIKeys()
+	if err != nil {
+		t.Fatalf("AllAPIKeys: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("AllAPIKeys returned %d keys, want 2", len(keys))
+	}
+
+	// revoked keys stop being active and cannot be revoked again
+	if err := repo.RevokeAPIKey(id); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	key, _ = repo.GetAPIKey("b4u_abcd1234_secret")
+	if key.RevokedAt == nil || key.Active(time.Now()) {
+		t.Errorf("revoked key = %+v, want it inactive", key)
+	}
+	for _, revoke := range []int{id, 9999} {
+		if err := repo.RevokeAPIKey(revoke); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+			t.Errorf("RevokeAPIKey(%d) error = %v, want ErrAPIKeyNotFound", revoke, err)
+		}
+	}
+}
+
+func testFacilities(t *testing.T, repo repository.DatabaseRepo) {
+	id := mustFacility(t, repo, models.Facility{
+		Name:     "Function Room",
+		Capacity: 30,
+		Rules: models.FacilityRules{
+			TimeZone:     "Asia/Singapore",
+			OpeningHours: []models.OpeningHours{{Weekday: time.Monday, Opens: "09:00", Closes: "22:00"}},
+		},
+	})
+	bbq := mustFacility(t, repo, models.Facility{Name: "BBQ Pit"})
+
+	if _, err := repo.InsertFacility(models.Facility{Name: "Function Room", Active: true}); !errors.Is(err, repository.ErrDuplicateFacility) {
+		t.Errorf("duplicate InsertFacility error = %v, want ErrDuplicateFacility", err)
+	}
+
+	facility, err := repo.GetFacilityByID(id)
+	if err != nil {
+		t.Fatalf("GetFacilityByID: %v", err)
+	}
+	if facility.Name != "Function Room" || facility.Capacity != 30 || !facility.Active {
+		t.Errorf("GetFacilityByID = %+v", facility)
+	}
+	if len(facility.Rules.OpeningHours) != 1 || facility.Rules.OpeningHours[0].Closes != "22:00" {
+		t.Errorf("opening hours = %+v", facility.Rules.OpeningHours)
+	}
+
+	if err := repo.ArchiveFacility(bbq); err != nil {
+		t.Fatalf("ArchiveFacility: %v", err)
+	}
+	active, err := repo.AllFacilities(false)
+	if err != nil {
+		t.Fatalf("AllFacilities: %v", err)
+	}
+	if len(active) != 1 || active[0].ID != id {
+		t.Errorf("AllFacilities(false) = %d facilities, want only the function room", len(active))
+	}
+	all, err := repo.AllFacilities(true)
+	if err != nil {
+		t.Fatalf("AllFacilities: %v", err)
+	}
+	if len(all) != 2 || all[0].Name != "BBQ Pit" {
+		t.Errorf("AllFacilities(true) should list both facilities ordered by name")
+	}
+
+	facility.Name = "Multipurpose Hall"
+	facility.Rules.OpeningHours = nil
+	if err := repo.UpdateFacility(*facility); err != nil {
+		t.Fatalf("UpdateFacility: %v", err)
+	}
+	renamed, err := repo.GetFacilityByName("Multipurpose Hall")
+	if err != nil {
+		t.Fatalf("GetFacilityByName after rename: %v", err)
+	}
+	if len(renamed.Rules.OpeningHours) != 0 {
+		t.Errorf("opening hours were not replaced: %+v", renamed.Rules.OpeningHours)
+	}
+
+	facility.Name = "BBQ Pit"
+	if err := repo.UpdateFacility(*facility); !errors.Is(err, repository.ErrDuplicateFacility) {
+		t.Errorf("renaming onto an existing name: error = %v, want ErrDuplicateFacility", err)
+	}
+	if err := repo.UpdateFacility(models.Facility{ID: 9999, Name: "Ghost"}); !errors.Is(err, repository.ErrFacilityNotFound) {
+		t.Errorf("UpdateFacility(unknown) error = %v, want ErrFacilityNotFound", err)
+	}
+	if err := repo.ArchiveFacility(9999); !errors.Is(err, repository.ErrFacilityNotFound) {
+		t.Errorf("ArchiveFacility(unknown) error = %v, want ErrFacilityNotFound", err)
+	}
+	if _, err := repo.GetFacilityByID(9999); !errors.Is(err, repository.ErrFacilityNotFound) {
+		t.Errorf("GetFacilityByID(unknown) error = %v, want ErrFacilityNotFound", err)
+	}
+}
+
+func testBookingRequests(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+	mustFacility(t, repo, models.Facility{
+		Name:  "Function Room",
+		Rules: models.FacilityRules{MinSlotMinutes: 30, SlotGranularityMinutes: 30},
+	})
+	archived := mustFacility(t, repo, models.Facility{Name: "Old Gym"})
+	if err := repo.ArchiveFacility(archived); err != nil {
+		t.Fatalf("ArchiveFacility: %v", err)
+	}
+
+	start := nextMonday()
+
+	err := repo.InsertBookingRequest(booking("alice", "Tennis Court", start, time.Hour))
+	if !errors.Is(err, repository.ErrFacilityNotFound) {
+		t.Errorf("unknown facility error = %v, want ErrFacilityNotFound", err)
+	}
+
+	err = repo.InsertBookingRequest(booking("alice", "Old Gym", start, time.Hour))
+	if !errors.Is(err, repository.ErrFacilityArchived) {
+		t.Errorf("archived facility error = %v, want ErrFacilityArchived", err)
+	}
+
+	var violation *models.RuleViolation
+	err = repo.InsertBookingRequest(booking("alice", "Function Room", start, 15*time.Minute))
+	if !errors.As(err, &violation) || violation.Rule != models.RuleMinSlotLength {
+		t.Errorf("short booking error = %v, want %s violation", err, models.RuleMinSlotLength)
+	}
+
+	err = repo.InsertBookingRequest(booking("alice", "Function Room", time.Now().Add(-48*time.Hour).Truncate(time.Hour), time.Hour))
+	if !errors.As(err, &violation) || violation.Rule != models.RuleLeadTime {
+		t.Errorf("past booking error = %v, want %s violation", err, models.RuleLeadTime)
+	}
+
+	request := mustRequest(t, repo, booking("alice", "Function Room", start, time.Hour))
+	if request.Username != "alice" || request.UnitNumber != "#01-01" {
+		t.Errorf("stored request = %+v", request)
+	}
+}
+
+func testApproval(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+	mustRegister(t, repo, "bob", false)
+	mustFacility(t, repo, models.Facility{Name: "Function Room"})
+	mustFacility(t, repo, models.Facility{Name: "BBQ Pit"})
+
+	start := nextMonday()
+	request := mustRequest(t, repo, booking("alice", "Function Room", start, time.Hour))
+
+	if err := repo.ApproveBookingRequest(*request); err != nil {
+		t.Fatalf("ApproveBookingRequest: %v", err)
+	}
+	if err := repo.ApproveBookingRequest(*request); err == nil {
+		t.Errorf("approving the same request twice succeeded")
+	}
+
+	withdrawn := mustRequest(t, repo, booking("alice", "BBQ Pit", start.Add(-2*time.Hour), time.Hour))
+	if err := repo.DeleteBookingRequest(*withdrawn); err != nil {
+		t.Fatalf("DeleteBookingRequest: %v", err)
+	}
+	if err := repo.ApproveBookingRequest(*withdrawn); !errors.Is(err, repository.ErrBookingRequestNotFound) {
+		t.Errorf("approving a deleted request error = %v, want ErrBookingRequestNotFound", err)
+	}
+
+	approved, err := repo.AllBookings()
+	if err != nil {
+		t.Fatalf("AllBookings: %v", err)
+	}
+	if len(approved) != 1 || approved[0].Username != "alice" || !sameInstant(t, approved[0].StartTime, request.StartTime) {
+		t.Fatalf("AllBookings after approval = %+v", approved)
+	}
+
+	// the same slot of another facility is free
+	mustRequest(t, repo, booking("bob", "BBQ Pit", start, time.Hour))
+
+	// an overlapping slot of the same facility is not
+	err = repo.InsertBookingRequest(booking("bob", "Function Room", start.Add(30*time.Minute), time.Hour))
+	var conflict *repository.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("overlapping request error = %v, want ConflictError", err)
+	}
+	if conflict.Conflict.BookingID != approved[0].ID || conflict.Conflict.Kind != "approved" || conflict.Conflict.Facility != "Function Room" {
+		t.Errorf("conflict = %+v", conflict.Conflict)
+	}
+
+	// back to back bookings do not overlap
+	mustRequest(t, repo, booking("bob", "Function Room", start.Add(time.Hour), time.Hour))
+}
+
+func testRecurringApproval(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+	mustRegister(t, repo, "bob", false)
+	mustFacility(t, repo, models.Facility{Name: "Function Room"})
+
+	start := nextMonday()
+
+	// bob already holds the second week
+	blocker := mustRequest(t, repo, booking("bob", "Function Room", start.AddDate(0, 0, 7), time.Hour))
+	if err := repo.ApproveBookingRequest(*blocker); err != nil {
+		t.Fatalf("ApproveBookingRequest: %v", err)
+	}
+
+	weekly := booking("alice", "Function Room", start, time.Hour)
+	weekly.Recurring = true
+	weekly.RecurringWeeks = 3
+	request := mustRequest(t, repo, weekly)
+
+	// failing on conflicts leaves the request pending
+	var conflict *repository.ConflictError
+	if _, err := repo.ApproveRecurringBookingRequest(*request, true); !errors.As(err, &conflict) {
+		t.Fatalf("ApproveRecurringBookingRequest failing on conflicts: got %v, want a ConflictError", err)
+	}
+	if recurring, _, requested, _ := repo.UserBookings("alice"); len(recurring) != 0 || len(requested) != 1 {
+		t.Fatalf("a failed approval left %d occurrences and %d requests", len(recurring), len(requested))
+	}
+
+	report, err := repo.ApproveRecurringBookingRequest(*request, false)
+	if err != nil {
+		t.Fatalf("ApproveRecurringBookingRequest: %v", err)
+	}
+	if report.Created != 2 || report.Skipped != 1 || len(report.Occurrences) != 3 {
+		t.Fatalf("report has %d created and %d skipped of %d occurrences, want 2, 1 and 3",
+			report.Created, report.Skipped, len(report.Occurrences))
+	}
+	skipped := report.Occurrences[1]
+	if skipped.Status != models.OccurrenceSkipped || skipped.Conflict == nil || skipped.Conflict.BookingID != conflict.Conflict.BookingID {
+		t.Errorf("second week reported as %q with conflict %+v, want skipped for booking %d",
+			skipped.Status, skipped.Conflict, conflict.Conflict.BookingID)
+	}
+	if report.Occurrences[0].Status != models.OccurrenceCreated || report.Occurrences[0].BookingID == 0 {
+		t.Errorf("first week reported as %q with booking %d", report.Occurrences[0].Status, report.Occurrences[0].BookingID)
+	}
+
+	recurring, _, requested, err := repo.UserBookings("alice")
+	if err != nil {
+		t.Fatalf("UserBookings: %v", err)
+	}
+	if len(requested) != 0 {
+		t.Errorf("request was not removed after approval")
+	}
+	if len(recurring) != 2 {
+		t.Fatalf("got %d recurring occurrences, want 2 (the blocked week is skipped)", len(recurring))
+	}
+	if !sameInstant(t, recurring[1].StartTime, start.AddDate(0, 0, 14).Format(time.RFC3339)) {
+		t.Errorf("second occurrence starts at %s, want the third week", recurring[1].StartTime)
+	}
+}
+
+func testBookingSeries(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+	mustFacility(t, repo, models.Facility{Name: "Function Room", Rules: models.FacilityRules{TimeZone: "Europe/London"}})
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	monday := nextMonday()
+	start := time.Date(monday.Year(), monday.Month(), monday.Day(), 19, 0, 0, 0, london)
+
+	invalid := booking("alice", "Function Room", start, time.Hour)
+	invalid.Recurring = true
+	invalid.RRule = "FREQ=WEEKLY"
+	if err := repo.InsertBookingRequest(invalid); err == nil {
+		t.Errorf("a rule without COUNT or UNTIL was accepted")
+	}
+
+	// every other week, four times, skipping the third occurrence
+	biweekly := booking("alice", "Function Room", start, time.Hour)
+	biweekly.Recurring = true
+	biweekly.RRule = "FREQ=WEEKLY;INTERVAL=2;COUNT=4"
+	biweekly.ExDates = []time.Time{start.AddDate(0, 0, 28)}
+	request := mustRequest(t, repo, biweekly)
+	if request.TimeZone != "Europe/London" || len(request.ExDates) != 1 {
+		t.Errorf("request stored time zone %q and %d exdates", request.TimeZone, len(request.ExDates))
+	}
+
+	if _, err := repo.ApproveRecurringBookingRequest(*request, false); err != nil {
+		t.Fatalf("ApproveRecurringBookingRequest: %v", err)
+	}
+
+	recurring, _, _, err := repo.UserBookings("alice")
+	if err != nil {
+		t.Fatalf("UserBookings: %v", err)
+	}
+	if len(recurring) != 3 || recurring[0].SeriesID == nil {
+		t.Fatalf("got %d recurring occurrences, want 3 belonging to a series", len(recurring))
+	}
+
+	series, err := repo.GetBookingSeries(*recurring[0].SeriesID)
+	if err != nil {
+		t.Fatalf("GetBookingSeries: %v", err)
+	}
+	if series.RRule != "FREQ=WEEKLY;INTERVAL=2;COUNT=4" || series.TimeZone != "Europe/London" {
+		t.Errorf("series has rule %q in %q", series.RRule, series.TimeZone)
+	}
+	if len(series.Occurrences) != 3 {
+		t.Fatalf("series has %d occurrences, want 3", len(series.Occurrences))
+	}
+
+	for i, weeks := range []int{0, 2, 6} {
+		want := time.Date(start.Year(), start.Month(), start.Day()+7*weeks, 19, 0, 0, 0, london)
+		if !sameInstant(t, series.Occurrences[i].StartTime, want.Format(time.RFC3339)) {
+			t.Errorf("occurrence %d starts at %s, want %s", i, series.Occurrences[i].StartTime, want.Format(time.RFC3339))
+		}
+	}
+
+	if _, err := repo.GetBookingSeries(series.ID + 1); !errors.Is(err, repository.ErrBookingSeriesNotFound) {
+		t.Errorf("GetBookingSeries of an unknown id: got %v, want ErrBookingSeriesNotFound", err)
+	}
+}
+
+func testSeriesChanges(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+	mustRegister(t, repo, "bob", false)
+	mustFacility(t, repo, models.Facility{Name: "Function Room", Rules: models.FacilityRules{TimeZone: "Europe/London"}})
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	monday := nextMonday()
+	at := func(week, hour int) time.Time {
+		return time.Date(monday.Year(), monday.Month(), monday.Day()+7*week, hour, 0, 0, 0, london)
+	}
+
+	weekly := booking("alice", "Function Room", at(0, 19), time.Hour)
+	weekly.Recurring = true
+	weekly.RRule = "FREQ=WEEKLY;COUNT=5"
+	request := mustRequest(t, repo, weekly)
+	if _, err := repo.ApproveRecurringBookingRequest(*request, false); err != nil {
+		t.Fatalf("ApproveRecurringBookingRequest: %v", err)
+	}
+
+	occurrences := func(seriesID int) []*models.SubmittedBooking {
+		t.Helper()
+		series, err := repo.GetBookingSeries(seriesID)
+		if err != nil {
+			t.Fatalf("GetBookingSeries(%d): %v", seriesID, err)
+		}
+		return series.Occurrences
+	}
+	change := func(seriesID int, occurrence *models.SubmittedBooking, scope string, start time.Time) models.OccurrenceChange {
+		return models.OccurrenceChange{
+			SeriesID:     seriesID,
+			OccurrenceID: occurrence.ID,
+			Scope:        scope,
+			StartTime:    start.Format(time.RFC3339),
+			EndTime:      start.Add(time.Hour).Format(time.RFC3339),
+		}
+	}
+
+	recurring, _, _, err := repo.UserBookings("alice")
+	if err != nil || len(recurring) != 5 {
+		t.Fatalf("UserBookings: got %d occurrences, %v", len(recurring), err)
+	}
+	seriesID := *recurring[0].SeriesID
+	all := occurrences(seriesID)
+
+	// moved occurrences are checked against the booking window like new requests
+	var violation *models.RuleViolation
+	if err := repo.UpdateSeriesOccurrence(change(seriesID, all[1], models.ScopeThis, at(-2, 19))); !errors.As(err, &violation) || violation.Rule != models.RuleLeadTime {
+		t.Errorf("moving an occurrence into the past error = %v, want a lead time violation", err)
+	}
+
+	// move only the second occurrence
+	if err := repo.UpdateSeriesOccurrence(change(seriesID, all[1], models.ScopeThis, at(1, 20))); err != nil {
+		t.Fatalf("UpdateSeriesOccurrence(this): %v", err)
+	}
+	all = occurrences(seriesID)
+	if !sameInstant(t, all[1].StartTime, at(1, 20).Format(time.RFC3339)) || !sameInstant(t, all[2].StartTime, at(2, 19).Format(time.RFC3339)) {
+		t.Errorf("editing one occurrence moved %s and %s", all[1].StartTime, all[2].StartTime)
+	}
+
+	// cancel only the third occurrence, it becomes an exdate
+	if err := repo.CancelSeriesOccurrence(change(seriesID, all[2], models.ScopeThis, at(2, 19))); err != nil {
+		t.Fatalf("CancelSeriesOccurrence(this): %v", err)
+	}
+	series, err := repo.GetBookingSeries(seriesID)
+	if err != nil {
+		t.Fatalf("GetBookingSeries: %v", err)
+	}
+	if len(series.Occurrences) != 4 || len(series.ExDates) != 1 {
+		t.Fatalf("after cancelling one occurrence: %d occurrences, %d exdates", len(series.Occurrences), len(series.ExDates))
+	}
+	all = series.Occurrences
+
+	// bob holds 18:00 in the fourth week, so moving the following occurrences there fails as a whole
+	blocker := mustRequest(t, repo, booking("bob", "Function Room", at(3, 18), time.Hour))
+	if err := repo.ApproveBookingRequest(*blocker); err != nil {
+		t.Fatalf("ApproveBookingRequest: %v", err)
+	}
+	var conflict *repository.ConflictError
+	if err := repo.UpdateSeriesOccurrence(change(seriesID, all[2], models.ScopeFollowing, at(3, 18))); !errors.As(err, &conflict) {
+		t.Fatalf("moving onto bob's booking: got %v, want a ConflictError", err)
+	}
+	if !sameInstant(t, occurrences(seriesID)[3].StartTime, at(4, 19).Format(time.RFC3339)) {
+		t.Errorf("a failed edit moved the fifth occurrence")
+	}
+
+	// moving the fourth week on splits the series
+	following := change(seriesID, all[2], models.ScopeFollowing, at(3, 17))
+	following.Purpose = "choir"
+	if err := repo.UpdateSeriesOccurrence(following); err != nil {
+		t.Fatalf("UpdateSeriesOccurrence(following): %v", err)
+	}
+	head, err := repo.GetBookingSeries(seriesID)
+	if err != nil {
+		t.Fatalf("GetBookingSeries: %v", err)
+	}
+	if len(head.Occurrences) != 2 || head.RRule == "FREQ=WEEKLY;COUNT=5" || len(head.ExDates) != 1 {
+		t.Errorf("after a split the series keeps %d occurrences with rule %q and %d exdates",
+			len(head.Occurrences), head.RRule, len(head.ExDates))
+	}
+
+	recurring, _, _, err = repo.UserBookings("alice")
+	if err != nil {
+		t.Fatalf("UserBookings: %v", err)
+	}
+	tailID := *recurring[len(recurring)-1].SeriesID
+	tail, err := repo.GetBookingSeries(tailID)
+	if err != nil {
+		t.Fatalf("GetBookingSeries(tail): %v", err)
+	}
+	if tailID == seriesID || tail.RRule != "FREQ=WEEKLY;COUNT=2" || tail.Purpose != "choir" || len(tail.Occurrences) != 2 {
+		t.Fatalf("split series %d has rule %q, purpose %q and %d occurrences", tailID, tail.RRule, tail.Purpose, len(tail.Occurrences))
+	}
+	if !sameInstant(t, tail.Occurrences[1].StartTime, at(4, 17).Format(time.RFC3339)) || tail.Occurrences[1].Purpose != "choir" {
+		t.Errorf("split occurrence at %s for %q", tail.Occurrences[1].StartTime, tail.Occurrences[1].Purpose)
+	}
+
+	// cancelling from the second occurrence on leaves the first one
+	if err := repo.CancelSeriesOccurrence(change(seriesID, head.Occurrences[1], models.ScopeFollowing, at(1, 20))); err != nil {
+		t.Fatalf("CancelSeriesOccurrence(following): %v", err)
+	}
+	if n := len(occurrences(seriesID)); n != 1 {
+		t.Errorf("after cancelling the following occurrences %d remain, want 1", n)
+	}
+
+	if err := repo.UpdateSeriesOccurrence(change(seriesID, tail.Occurrences[0], models.ScopeThis, at(3, 17))); !errors.Is(err, repository.ErrOccurrenceNotFound) {
+		t.Errorf("changing another series' occurrence: got %v, want ErrOccurrenceNotFound", err)
+	}
+	if err := repo.CancelSeriesOccurrence(change(tailID, tail.Occurrences[0], "some", at(3, 17))); err == nil {
+		t.Errorf("an unknown scope was accepted")
+	}
+
+	// cancelling the whole series removes its occurrences
+	if err := repo.DeleteBookingSeries(tailID); err != nil {
+		t.Fatalf("DeleteBookingSeries: %v", err)
+	}
+	if _, err := repo.GetBookingSeries(tailID); !errors.Is(err, repository.ErrBookingSeriesNotFound) {
+		t.Errorf("GetBookingSeries after delete: got %v, want ErrBookingSeriesNotFound", err)
+	}
+	recurring, _, _, err = repo.UserBookings("alice")
+	if err != nil || len(recurring) != 1 {
+		t.Errorf("after cancelling the split series alice has %d occurrences, want 1 (%v)", len(recurring), err)
+	}
+}
+
+func testDeletion(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+	mustFacility(t, repo, models.Facility{Name: "Function Room"})
+
+	start := nextMonday()
+	pending := mustRequest(t, repo, booking("alice", "Function Room", start, time.Hour))
+	stored, err := repo.GetBookingRequest(pending.ID)
+	if err != nil {
+		t.Fatalf("GetBookingRequest: %v", err)
+	}
+	if stored.Username != "alice" || stored.Facility != "Function Room" {
+		t.Errorf("GetBookingRequest = %+v, want alice's Function Room request", stored)
+	}
+	if err := repo.DeleteBookingRequest(*pending); err != nil {
+		t.Fatalf("DeleteBookingRequest: %v", err)
+	}
+	if _, err := repo.GetBookingRequest(pending.ID); !errors.Is(err, repository.ErrBookingRequestNotFound) {
+		t.Errorf("GetBookingRequest(deleted) error = %v, want ErrBookingRequestNotFound", err)
+	}
+
+	request := mustRequest(t, repo, booking("alice", "Function Room", start, time.Hour))
+	if err := repo.ApproveBookingRequest(*request); err != nil {
+		t.Fatalf("ApproveBookingRequest: %v", err)
+	}
+	approved, err := repo.AllBookings()
+	if err != nil || len(approved) != 1 {
+		t.Fatalf("AllBookings = %d bookings, %v", len(approved), err)
+	}
+	found, err := repo.GetApprovedBooking(approved[0].ID)
+	if err != nil {
+		t.Fatalf("GetApprovedBooking: %v", err)
+	}
+	if found.Username != "alice" || found.SeriesID != nil {
+		t.Errorf("GetApprovedBooking = %+v, want alice's booking without a series", found)
+	}
+	if err := repo.DeleteApprovedBooking(*approved[0]); err != nil {
+		t.Fatalf("DeleteApprovedBooking: %v", err)
+	}
+	if _, err := repo.GetApprovedBooking(approved[0].ID); !errors.Is(err, repository.ErrBookingNotFound) {
+		t.Errorf("GetApprovedBooking(deleted) error = %v, want ErrBookingNotFound", err)
+	}
+
+	recurringRequest := booking("alice", "Function Room", start, time.Hour)
+	recurringRequest.Recurring = true
+	recurringRequest.RecurringWeeks = 2
+	request = mustRequest(t, repo, recurringRequest)
+	if _, err := repo.ApproveRecurringBookingRequest(*request, false); err != nil {
+		t.Fatalf("ApproveRecurringBookingRequest: %v", err)
+	}
+	recurring, _, _, err := repo.UserBookings("alice")
+	if err != nil || len(recurring) != 2 {
+		t.Fatalf("UserBookings = %d recurring bookings, %v", len(recurring), err)
+	}
+	found, err = repo.GetRecurringBooking(recurring[0].ID)
+	if err != nil {
+		t.Fatalf("GetRecurringBooking: %v", err)
+	}
+	if found.Username != "alice" || found.SeriesID == nil {
+		t.Errorf("GetRecurringBooking = %+v, want alice's occurrence with a series", found)
+	}
+	if err := repo.DeleteRecurringBooking(*recurring[0]); err != nil {
+		t.Fatalf("DeleteRecurringBooking: %v", err)
+	}
+	if _, err := repo.GetRecurringBooking(recurring[0].ID); !errors.Is(err, repository.ErrBookingNotFound) {
+		t.Errorf("GetRecurringBooking(deleted) error = %v, want ErrBookingNotFound", err)
+	}
+
+	recurring, approved, requested, err := repo.UserBookings("alice")
+	if err != nil {
+		t.Fatalf("UserBookings: %v", err)
+	}
+	if len(recurring) != 1 || len(approved) != 0 || len(requested) != 0 {
+		t.Errorf("after deletion: %d recurring, %d approved, %d requested, want 1, 0, 0",
+			len(recurring), len(approved), len(requested))
+	}
+}
+
+func testManageBookings(t *testing.T, repo repository.DatabaseRepo) {
+	mustRegister(t, repo, "alice", false)
+	mustRegister(t, repo, "bob", false)
+	mustFacility(t, repo, models.Facility{Name: "Function Room"})
+
+	start := nextMonday()
+	mustRequest(t, repo, booking("alice", "Function Room", start, time.Hour))
+	mustRequest(t, repo, booking("bob", "Function Room", start.Add(2*time.Hour), time.Hour))
+
+	_, _, requested, err := repo.UserBookings("alice")
+	if err != nil {
+		t.Fatalf("UserBookings(alice): %v", err)
+	}
+	if len(requested) != 1 || requested[0].Username != "alice" {
+		t.Errorf("UserBookings should only return alice's requests, got %d", len(requested))
+	}
+
+	_, _, requested, err = repo.AdminBookings()
+	if err != nil {
+		t.Fatalf("AdminBookings: %v", err)
+	}
+	if len(requested) != 2 {
+		t.Errorf("AdminBookings should return every request, got %d", len(requested))
+	}
+}
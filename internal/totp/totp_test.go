@@ -0,0 +1,112 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of RFC 6238 Appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// the RFC lists 8 digit codes, 6 digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+
+		step, ok := Validate(rfcSecret, tt.want, time.Unix(tt.unix, 0), 0)
+		if !ok || step != Step(time.Unix(tt.unix, 0)) {
+			t.Errorf("Validate(%s) at %d = %d, %v, want step %d", tt.want, tt.unix, step, ok, Step(time.Unix(tt.unix, 0)))
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Errorf("Code with an invalid secret succeeded")
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		skew   int
+		ok     bool
+	}{
+		{"current step", 0, 1, true},
+		{"previous step", -1, 1, true},
+		{"next step", 1, 1, true},
+		{"two steps behind", -2, 1, false},
+		{"two steps ahead", 2, 1, false},
+		{"previous step without skew", -1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, step+tt.offset)
+			if err != nil {
+				t.Fatalf("Code: %v", err)
+			}
+
+			got, ok := Validate(rfcSecret, code, now, tt.skew)
+			if ok != tt.ok {
+				t.Fatalf("Validate of a code %d steps off with skew %d = %v, want %v", tt.offset, tt.skew, ok, tt.ok)
+			}
+			// the step of the code is returned, not the current one, so that callers
+			// can tell a code was used before
+			if ok && got != step+tt.offset {
+				t.Errorf("Validate returned step %d, want %d", got, step+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateReusedStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	// a code accepted now and again in the next period maps to the same step, which
+	// the repository refuses the second time
+	first, ok := Validate(rfcSecret, code, now, 1)
+	if !ok {
+		t.Fatalf("Validate rejected the current code")
+	}
+	second, ok := Validate(rfcSecret, code, now.Add(Period*time.Second), 1)
+	if !ok || second != first {
+		t.Errorf("Validate of the same code a period later = %d, %v, want step %d", second, ok, first)
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef", "94287082"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("Validate(%q) accepted a malformed code", code)
+		}
+	}
+	if _, ok := Validate(rfcSecret, " 287 082 ", now, 0); !ok {
+		t.Errorf("Validate rejected a code with spaces")
+	}
+}